@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/config"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of privileged actions",
+	Args:  cobra.NoArgs,
+	RunE:  runAudit,
+}
+
+var (
+	flagAuditActor   string
+	flagAuditChannel string
+	flagAuditChat    string
+	flagAuditSession string
+	flagAuditAction  string
+	flagAuditOutcome string
+	flagAuditSince   string
+	flagAuditUntil   string
+	flagAuditLimit   int
+	flagAuditFormat  string
+)
+
+func init() {
+	f := auditCmd.Flags()
+	f.StringVar(&flagAuditActor, "actor", "", "only this sender ID, or control / cli")
+	f.StringVar(&flagAuditChannel, "channel", "", "only this channel, e.g. telegram")
+	f.StringVar(&flagAuditChat, "chat", "", "only this chat ID")
+	f.StringVar(&flagAuditSession, "session", "", "only this tmux session")
+	f.StringVar(&flagAuditAction, "action", "", "only this action, e.g. attach or grant")
+	f.StringVar(&flagAuditOutcome, "outcome", "", "only this outcome: ok, denied or failed")
+	f.StringVar(&flagAuditSince, "since", "", "only newer events: a duration (24h) or a date (2006-01-02, RFC 3339)")
+	f.StringVar(&flagAuditUntil, "until", "", "only older events, in the same forms as --since")
+	f.IntVar(&flagAuditLimit, "limit", 50, "show the most recent n events; 0 = all")
+	f.StringVar(&flagAuditFormat, "format", "table", "output format: table, json or csv")
+}
+
+// auditLogPath returns the configured audit log, defaulting to
+// ~/.im2code/audit.jsonl.
+func auditLogPath(cfg *config.Config) string {
+	if cfg.AuditLog != "" {
+		return cfg.AuditLog
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.im2code/audit.jsonl"
+}
+
+// auditCLI records an action the CLI took itself because no daemon was
+// running. A failure is only logged: the action already happened.
+func auditCLI(e audit.Event) {
+	e.Actor = "cli"
+	l, err := audit.Open(auditLogPath(loadConfigOrDefaults()))
+	if err == nil {
+		err = l.Write(e)
+		l.Close()
+	}
+	if err != nil {
+		slog.Warn("audit: write failed", "action", e.Action, "err", err)
+	}
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	filter := audit.Filter{
+		Actor:   flagAuditActor,
+		Channel: strings.ToLower(flagAuditChannel),
+		ChatID:  flagAuditChat,
+		Session: flagAuditSession,
+		Action:  strings.ToLower(flagAuditAction),
+		Outcome: strings.ToLower(flagAuditOutcome),
+		Limit:   flagAuditLimit,
+	}
+	now := time.Now()
+	for _, t := range []struct {
+		flag string
+		dst  *time.Time
+	}{{flagAuditSince, &filter.Since}, {flagAuditUntil, &filter.Until}} {
+		if t.flag == "" {
+			continue
+		}
+		v, err := parseSince(t.flag, now)
+		if err != nil {
+			return err
+		}
+		*t.dst = v
+	}
+	switch flagAuditFormat {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("unknown format %q: use table, json or csv", flagAuditFormat)
+	}
+	cmd.SilenceUsage = true
+
+	path := auditLogPath(loadConfigOrDefaults())
+	events, skipped, err := audit.Read(path, filter)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no audit log at %s", path)
+	}
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d unreadable lines in %s\n", skipped, path)
+	}
+
+	switch flagAuditFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if events == nil {
+			events = []audit.Event{}
+		}
+		return enc.Encode(events)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"time", "actor", "channel", "chat_id", "session", "action", "args", "outcome", "detail"})
+		for _, e := range events {
+			w.Write([]string{e.Time.Format(time.RFC3339), e.Actor, e.Channel, e.ChatID, e.Session, e.Action, strings.Join(e.Args, " "), e.Outcome, e.Detail})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	if len(events) == 0 {
+		fmt.Println("No matching events.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tCHAT\tSESSION\tACTION\tOUTCOME\tDETAIL")
+	for _, e := range events {
+		chat := e.Channel
+		if e.ChatID != "" {
+			chat += ":" + e.ChatID
+		}
+		action := strings.Join(append([]string{e.Action}, e.Args...), " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"),
+			e.Actor, chat, e.Session, action, e.Outcome, e.Detail)
+	}
+	return w.Flush()
+}
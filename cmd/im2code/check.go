@@ -2,10 +2,16 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/dfbb/im2code/internal/channel/discord"
+	emailch "github.com/dfbb/im2code/internal/channel/email"
+	ircch "github.com/dfbb/im2code/internal/channel/irc"
+	matrixch "github.com/dfbb/im2code/internal/channel/matrix"
+	mattermostch "github.com/dfbb/im2code/internal/channel/mattermost"
 	slackch "github.com/dfbb/im2code/internal/channel/slack"
 	"github.com/dfbb/im2code/internal/channel/telegram"
+	webhookch "github.com/dfbb/im2code/internal/channel/webhook"
 	"github.com/dfbb/im2code/internal/config"
 	"github.com/spf13/cobra"
 )
@@ -36,6 +42,10 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			func() (string, error) { return checkDiscordToken(cfg.Channels.Discord.Token) }},
 		{"slack", func() bool { return cfg.Channels.Slack.BotToken != "" },
 			func() (string, error) { return checkSlackToken(cfg.Channels.Slack.BotToken) }},
+		{"mattermost", func() bool { return cfg.Channels.Mattermost.Token != "" },
+			func() (string, error) {
+				return checkMattermostToken(cfg.Channels.Mattermost.URL, cfg.Channels.Mattermost.Token)
+			}},
 		{"whatsapp", func() bool { return true },
 			func() (string, error) { return "session-based (run start to check)", nil }},
 		{"feishu", func() bool { return cfg.Channels.Feishu.AppID != "" },
@@ -44,6 +54,20 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			func() (string, error) { return "configured", nil }},
 		{"qq", func() bool { return cfg.Channels.QQ.AppID != "" && cfg.Channels.QQ.Secret != "" },
 			func() (string, error) { return "configured (secret set)", nil }},
+		{"matrix", func() bool { return cfg.Channels.Matrix.AccessToken != "" },
+			func() (string, error) {
+				return matrixch.CheckToken(cfg.Channels.Matrix.Homeserver, cfg.Channels.Matrix.AccessToken)
+			}},
+		{"irc", func() bool { return cfg.Channels.IRC.Server != "" && cfg.Channels.IRC.Nick != "" },
+			func() (string, error) { return ircch.Check(ircOptions(cfg.Channels.IRC)) }},
+		{"email", func() bool { return cfg.Channels.Email.IMAPServer != "" && cfg.Channels.Email.SMTPServer != "" },
+			func() (string, error) { return emailch.Check(emailOptions(cfg.Channels.Email)) }},
+		{"web", func() bool { return cfg.Channels.Web.Listen != "" },
+			func() (string, error) {
+				return fmt.Sprintf("listen %s, %d user tokens", cfg.Channels.Web.Listen, len(cfg.Channels.Web.Tokens)), nil
+			}},
+		{"webhook", func() bool { return cfg.Channels.Webhook.Listen != "" },
+			func() (string, error) { return checkWebhook(cfg.Channels.Webhook) }},
 	}
 
 	filter := ""
@@ -85,3 +109,57 @@ func checkDiscordToken(token string) (string, error) {
 func checkSlackToken(token string) (string, error) {
 	return slackch.CheckToken(token)
 }
+
+func checkMattermostToken(serverURL, token string) (string, error) {
+	return mattermostch.CheckToken(serverURL, token)
+}
+
+func ircOptions(c config.IRCConfig) ircch.Options {
+	return ircch.Options{
+		Server:   c.Server,
+		TLS:      c.TLS,
+		Nick:     c.Nick,
+		Username: c.Username,
+		Password: c.Password,
+		Auth:     c.Auth,
+		Channels: c.Channels,
+	}
+}
+
+func emailOptions(c config.EmailConfig) emailch.Options {
+	return emailch.Options{
+		IMAPServer: c.IMAPServer,
+		IMAPTLS:    c.IMAPTLS,
+		SMTPServer: c.SMTPServer,
+		SMTPTLS:    c.SMTPTLS,
+		Username:   c.Username,
+		Password:   c.Password,
+		Address:    c.Address,
+		Mailbox:    c.Mailbox,
+		AuthServID: c.AuthServID,
+		Secret:     c.Secret,
+	}
+}
+
+func webhookOptions(c config.WebhookConfig) webhookch.Options {
+	return webhookch.Options{
+		Listen:      c.Listen,
+		Path:        c.Path,
+		Secret:      c.Secret,
+		CallbackURL: c.CallbackURL,
+	}
+}
+
+func checkWebhook(c config.WebhookConfig) (string, error) {
+	if c.Secret == "" {
+		return "", fmt.Errorf("secret is not set")
+	}
+	if c.CallbackURL == "" {
+		return "listen " + c.Listen + ", no callback_url (inbound only)", nil
+	}
+	u, err := url.Parse(c.CallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid callback_url %q", c.CallbackURL)
+	}
+	return "listen " + c.Listen + " → " + c.CallbackURL, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/config"
+	"github.com/dfbb/im2code/internal/control"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <channel:chatID> <session[:window[.pane]]>",
+	Short: "Bind a chat to a tmux session or pane in the running daemon",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return callDaemon(cmd, control.Request{Action: "attach", Chat: args[0], Session: args[1]},
+			fmt.Sprintf("Attached %s to session %s.", args[0], args[1]))
+	},
+}
+
+var detachCmd = &cobra.Command{
+	Use:   "detach <channel:chatID>",
+	Short: "Remove a chat's binding in the running daemon",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return callDaemon(cmd, control.Request{Action: "detach", Chat: args[0]}, "Detached "+args[0]+".")
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <channel:chatID> on|off",
+	Short: "Toggle watch mode for a chat in the running daemon",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var on bool
+		switch strings.ToLower(args[1]) {
+		case "on":
+			on = true
+		case "off":
+		default:
+			return fmt.Errorf("expected on or off, got %q", args[1])
+		}
+		return callDaemon(cmd, control.Request{Action: "watch", Chat: args[0], On: on},
+			fmt.Sprintf("Watch mode %s for %s.", strings.ToLower(args[1]), args[0]))
+	},
+}
+
+func callDaemon(cmd *cobra.Command, req control.Request, success string) error {
+	// Arguments are valid by now; errors come from the daemon.
+	cmd.SilenceUsage = true
+	if _, err := control.Call(controlSocketPath(loadConfigOrDefaults()), req); err != nil {
+		return err
+	}
+	fmt.Println(success)
+	return nil
+}
+
+func loadConfigOrDefaults() *config.Config {
+	cfg, err := config.Load(configPath())
+	if err != nil {
+		return config.Defaults()
+	}
+	return cfg
+}
+
+// controlSocketPath returns the configured control socket, defaulting to
+// ~/.im2code/im2code.sock.
+func controlSocketPath(cfg *config.Config) string {
+	if cfg.ControlSock != "" {
+		return cfg.ControlSock
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.im2code/im2code.sock"
+}
+
+// detectorRegistry records the running idle detectors for the control API.
+type detectorRegistry struct {
+	mu sync.Mutex
+	m  map[detectorKey]control.Detector
+}
+
+func (d *detectorRegistry) set(k detectorKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.m[k] = control.Detector{Session: k.session, Min: k.min.String(), Max: k.max.String()}
+}
+
+func (d *detectorRegistry) remove(k detectorKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.m, k)
+}
+
+func (d *detectorRegistry) snapshot() []control.Detector {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]control.Detector, 0, len(d.m))
+	for _, det := range d.m {
+		out = append(out, det)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Session != out[j].Session {
+			return out[i].Session < out[j].Session
+		}
+		return out[i].Min < out[j].Min
+	})
+	return out
+}
+
+// daemonControl answers control socket requests from the live daemon state.
+type daemonControl struct {
+	mgr       *channel.Manager
+	rtr       *router.Router
+	detectors *detectorRegistry
+	startedAt time.Time
+}
+
+func (d *daemonControl) Status() control.Status {
+	in, out := d.mgr.QueueDepths()
+	return control.Status{
+		PID:       os.Getpid(),
+		StartedAt: d.startedAt,
+		Channels:  d.mgr.Status(),
+		Bindings:  d.rtr.Bindings(),
+		Detectors: d.detectors.snapshot(),
+		Queues:    control.Queues{Inbound: in, Outbound: out},
+	}
+}
+
+func (d *daemonControl) Attach(chat, target string) error {
+	session, err := d.rtr.CheckTarget(target)
+	if err != nil {
+		d.audit(chat, target, "attach", nil, audit.Denied, err.Error())
+		return fmt.Errorf("cannot attach to %s: %w", target, err)
+	}
+	if !d.rtr.SessionAllowed(chat, "", session) {
+		d.audit(chat, session, "attach", nil, audit.Denied, "session ACL")
+		return fmt.Errorf("session %q is not allowed for %s by session_acl", session, chat)
+	}
+	d.rtr.Attach(chat, session)
+	d.audit(chat, session, "attach", nil, audit.OK, "")
+	return nil
+}
+
+func (d *daemonControl) Detach(chat string) error {
+	session := d.boundSession(chat)
+	d.rtr.Detach(chat)
+	d.audit(chat, session, "detach", nil, audit.OK, "")
+	return nil
+}
+
+func (d *daemonControl) Watch(chat string, on bool) error {
+	session := d.boundSession(chat)
+	if on && session == "" {
+		return fmt.Errorf("%s is not attached to a session", chat)
+	}
+	d.rtr.SetWatch(chat, on)
+	arg := "off"
+	if on {
+		arg = "on"
+	}
+	d.audit(chat, session, "watch", []string{arg}, audit.OK, "")
+	return nil
+}
+
+func (d *daemonControl) Revoke(sender string) error {
+	ch, id, _ := strings.Cut(sender, ":")
+	if !d.rtr.Revoke(ch, id) {
+		return fmt.Errorf("%s has no role granted from chat", sender)
+	}
+	d.rtr.Audit(audit.Event{Actor: "control", Channel: ch, Action: "revoke", Args: []string{id}, Outcome: audit.OK})
+	return nil
+}
+
+// boundSession returns the session chat is attached to, or "".
+func (d *daemonControl) boundSession(chat string) string {
+	for _, b := range d.rtr.Bindings() {
+		if b.Chat == chat {
+			return b.Session
+		}
+	}
+	return ""
+}
+
+// audit records an action taken through the control socket on chat
+// ("channel:chatID").
+func (d *daemonControl) audit(chat, session, action string, args []string, outcome, detail string) {
+	ch, chatID, _ := strings.Cut(chat, ":")
+	d.rtr.Audit(audit.Event{Actor: "control", Channel: ch, ChatID: chatID, Session: session, Action: action, Args: args, Outcome: outcome, Detail: detail})
+}
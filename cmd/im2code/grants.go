@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/control"
+	"github.com/dfbb/im2code/internal/state"
+)
+
+var grantsCmd = &cobra.Command{
+	Use:   "grants",
+	Short: "List or revoke roles given from chat (#im2code, #grant)",
+}
+
+var grantsListCmd = &cobra.Command{
+	Use:   "list [channel]",
+	Short: "List senders with a role, from chat and from config",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runGrantsList,
+}
+
+var grantsRevokeCmd = &cobra.Command{
+	Use:   "revoke <channel:senderID>",
+	Short: "Remove a role given from chat",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runGrantsRevoke,
+}
+
+func init() {
+	grantsCmd.AddCommand(grantsListCmd)
+	grantsCmd.AddCommand(grantsRevokeCmd)
+}
+
+func grantsPath() string {
+	home, _ := os.UserHomeDir()
+	return home + "/.im2code/grants.json"
+}
+
+func runGrantsList(cmd *cobra.Command, args []string) error {
+	grants, err := state.NewGrants(grantsPath())
+	if err != nil {
+		return err
+	}
+	match := func(key string) bool {
+		return len(args) == 0 || strings.HasPrefix(key, strings.ToLower(args[0])+":")
+	}
+
+	var lines []string
+	granted := make(map[string]bool)
+	for _, g := range grants.List() {
+		granted[g.Key] = true
+		if match(g.Key) {
+			lines = append(lines, fmt.Sprintf("  %-32s %-9s since %s", g.Key, g.Role, g.GrantedAt.Local().Format("2006-01-02 15:04")))
+		}
+	}
+	for key, role := range loadConfigOrDefaults().Roles {
+		if !granted[key] && match(key) {
+			lines = append(lines, fmt.Sprintf("  %-32s %-9s (config.yaml)", key, role))
+		}
+	}
+	if len(lines) == 0 {
+		fmt.Println("No roles assigned.")
+		return nil
+	}
+	sort.Strings(lines)
+	fmt.Println("Roles:")
+	fmt.Println(strings.Join(lines, "\n"))
+	return nil
+}
+
+func runGrantsRevoke(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	if ch, id, ok := strings.Cut(key, ":"); !ok || ch == "" || id == "" {
+		return fmt.Errorf("expected channel:senderID, got %q", key)
+	}
+	cmd.SilenceUsage = true
+
+	// A running daemon holds the grants in memory and would write them back,
+	// so it has to make the change itself.
+	_, err := control.Call(controlSocketPath(loadConfigOrDefaults()), control.Request{Action: "revoke", Chat: key})
+	if errors.Is(err, control.ErrNotRunning) {
+		grants, err := state.NewGrants(grantsPath())
+		if err != nil {
+			return err
+		}
+		ok, err := grants.Delete(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s has no role granted from chat", key)
+		}
+		ch, id, _ := strings.Cut(key, ":")
+		auditCLI(audit.Event{Channel: ch, Action: "revoke", Args: []string{id}, Outcome: audit.OK})
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("Revoked %s.\n", key)
+	if role, ok := loadConfigOrDefaults().Roles[key]; ok {
+		fmt.Printf("Note: roles in config.yaml still make %s %s.\n", key, role)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/config"
+	"github.com/dfbb/im2code/internal/history"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show recorded chat inputs",
+	Args:  cobra.NoArgs,
+	RunE:  runHistory,
+}
+
+var (
+	flagHistChannel string
+	flagHistChat    string
+	flagHistSender  string
+	flagHistSince   string
+	flagHistGrep    string
+	flagHistLimit   int
+	flagHistFormat  string
+)
+
+func init() {
+	f := historyCmd.Flags()
+	f.StringVar(&flagHistChannel, "channel", "", "only this channel, e.g. telegram")
+	f.StringVar(&flagHistChat, "chat", "", "only this chat ID")
+	f.StringVar(&flagHistSender, "sender", "", "only this sender ID")
+	f.StringVar(&flagHistSince, "since", "", "only newer entries: a duration (24h) or a date (2006-01-02, RFC 3339)")
+	f.StringVar(&flagHistGrep, "grep", "", "only entries whose text contains this string")
+	f.IntVar(&flagHistLimit, "limit", 50, "show the most recent n entries; 0 = all")
+	f.StringVar(&flagHistFormat, "format", "table", "output format: table, json or csv")
+}
+
+// historyDBPath returns the configured command history database: the path of
+// a sqlite entry in history.backends, else cmd_history_db, defaulting to
+// ~/.im2code/cmd_history.db.
+func historyDBPath(cfg *config.Config) string {
+	for _, b := range cfg.History.Backends {
+		if b.Type == "sqlite" && b.Path != "" {
+			return b.Path
+		}
+	}
+	if cfg.CmdHistoryDB != "" {
+		return cfg.CmdHistoryDB
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.im2code/cmd_history.db"
+}
+
+// openHistory opens the backends in history.backends, or only the SQLite
+// database if there are none. pruners are the backends that history.max_age
+// and history.max_rows apply to: sqlite and jsonl, not syslog.
+func openHistory(cfg *config.Config) (backend history.Backend, pruners []history.Pruner, err error) {
+	specs := cfg.History.Backends
+	if len(specs) == 0 {
+		specs = []config.HistoryBackend{{Type: "sqlite"}}
+	}
+	var backends []history.Backend
+	defer func() {
+		if err != nil {
+			for _, b := range backends {
+				b.Close()
+			}
+		}
+	}()
+	var db *history.History
+	for _, spec := range specs {
+		var b history.Backend
+		switch spec.Type {
+		case "sqlite":
+			if db != nil {
+				return nil, nil, fmt.Errorf("history.backends: only one sqlite backend is supported")
+			}
+			db, err = history.New(historyDBPath(cfg))
+			b = db
+		case "jsonl":
+			if spec.Path == "" {
+				return nil, nil, fmt.Errorf("history.backends: jsonl needs a path")
+			}
+			var j *history.JSONL
+			j, err = history.NewJSONL(spec.Path)
+			b = j
+		case "syslog":
+			b, err = history.NewSyslog(spec.Network, spec.Address, spec.Tag, spec.Facility)
+		default:
+			return nil, nil, fmt.Errorf("history.backends: unknown type %q: use sqlite, jsonl or syslog", spec.Type)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		backends = append(backends, b)
+		if p, ok := b.(history.Pruner); ok {
+			pruners = append(pruners, p)
+		}
+	}
+	if len(pruners) == 0 && (cfg.History.MaxAge != "" || cfg.History.MaxRows > 0) {
+		return nil, nil, fmt.Errorf("history.max_age and history.max_rows need a sqlite or jsonl backend; syslog cannot be pruned")
+	}
+	if len(backends) == 1 {
+		return backends[0], pruners, nil
+	}
+	return history.NewMulti(backends...), pruners, nil
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	filter := history.Filter{
+		Channel:  strings.ToLower(flagHistChannel),
+		ChatID:   flagHistChat,
+		SenderID: flagHistSender,
+		Grep:     flagHistGrep,
+		Limit:    flagHistLimit,
+	}
+	if flagHistSince != "" {
+		since, err := parseSince(flagHistSince, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = since
+	}
+	switch flagHistFormat {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("unknown format %q: use table, json or csv", flagHistFormat)
+	}
+	cmd.SilenceUsage = true
+
+	path := historyDBPath(loadConfigOrDefaults())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no command history at %s", path)
+	}
+	h, err := history.New(path)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	entries, err := h.Query(filter)
+	if err != nil {
+		return err
+	}
+
+	switch flagHistFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		return enc.Encode(entries)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "time", "channel", "chat_id", "sender_id", "text"})
+		for _, e := range entries {
+			w.Write([]string{strconv.FormatInt(e.ID, 10), e.Time.Format(time.RFC3339), e.Channel, e.ChatID, e.SenderID, e.Text})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	if len(entries) == 0 {
+		fmt.Println("No matching entries.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tCHAT\tSENDER\tTEXT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s:%s\t%s\t%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"),
+			e.Channel, e.ChatID, e.SenderID, strings.ReplaceAll(e.Text, "\n", "⏎"))
+	}
+	return w.Flush()
+}
+
+// parseSince accepts a duration back from now or an absolute date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a duration like 24h or a date like 2006-01-02", s)
+}
+
+var transcriptCmd = &cobra.Command{
+	Use:   "transcript",
+	Short: "Export the inputs and pane output of a chat or session",
+	Args:  cobra.NoArgs,
+	RunE:  runTranscript,
+}
+
+var (
+	flagTransChat    string
+	flagTransSession string
+	flagTransSince   string
+	flagTransUntil   string
+	flagTransFormat  string
+	flagTransOutput  string
+)
+
+func init() {
+	f := transcriptCmd.Flags()
+	f.StringVar(&flagTransChat, "chat", "", "the chat to export, as channel:chatID")
+	f.StringVar(&flagTransSession, "session", "", "the tmux session to export")
+	f.StringVar(&flagTransSince, "since", "", "start: a duration (24h) or a date (2006-01-02, RFC 3339)")
+	f.StringVar(&flagTransUntil, "until", "", "end, in the same forms as --since")
+	f.StringVar(&flagTransFormat, "format", "md", "output format: md, html or cast (asciicast v2)")
+	f.StringVarP(&flagTransOutput, "output", "o", "", "write to this file instead of stdout")
+}
+
+func runTranscript(cmd *cobra.Command, args []string) error {
+	var filter history.TranscriptFilter
+	var title string
+	switch {
+	case flagTransChat != "" && flagTransSession != "":
+		return fmt.Errorf("use either --chat or --session")
+	case flagTransChat != "":
+		ch, id, ok := strings.Cut(flagTransChat, ":")
+		if !ok || ch == "" || id == "" {
+			return fmt.Errorf("--chat must be channel:chatID, got %q", flagTransChat)
+		}
+		filter.Channel, filter.ChatID = strings.ToLower(ch), id
+		title = "im2code transcript: chat " + flagTransChat
+	case flagTransSession != "":
+		filter.Session = flagTransSession
+		title = "im2code transcript: session " + flagTransSession
+	default:
+		return fmt.Errorf("--chat or --session is required")
+	}
+	now := time.Now()
+	for _, t := range []struct {
+		flag string
+		dst  *time.Time
+	}{{flagTransSince, &filter.Since}, {flagTransUntil, &filter.Until}} {
+		if t.flag == "" {
+			continue
+		}
+		v, err := parseSince(t.flag, now)
+		if err != nil {
+			return err
+		}
+		*t.dst = v
+	}
+	write := map[string]func(io.Writer, string, []history.Event) error{
+		"md":   history.WriteMarkdown,
+		"html": history.WriteHTML,
+		"cast": history.WriteAsciicast,
+	}[flagTransFormat]
+	if write == nil {
+		return fmt.Errorf("unknown format %q: use md, html or cast", flagTransFormat)
+	}
+	cmd.SilenceUsage = true
+
+	path := historyDBPath(loadConfigOrDefaults())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no command history at %s", path)
+	}
+	h, err := history.New(path)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	events, err := h.Transcript(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("nothing recorded for this selection")
+	}
+
+	if flagTransOutput == "" {
+		return write(os.Stdout, title, events)
+	}
+	f, err := os.OpenFile(flagTransOutput, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := write(f, title, events); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d events to %s\n", len(events), flagTransOutput)
+	return nil
+}
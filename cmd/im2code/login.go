@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
@@ -12,10 +14,15 @@ import (
 
 	"github.com/dfbb/im2code/internal/channel/dingtalk"
 	"github.com/dfbb/im2code/internal/channel/discord"
+	emailch "github.com/dfbb/im2code/internal/channel/email"
 	feishuch "github.com/dfbb/im2code/internal/channel/feishu"
+	ircch "github.com/dfbb/im2code/internal/channel/irc"
+	matrixch "github.com/dfbb/im2code/internal/channel/matrix"
+	mattermostch "github.com/dfbb/im2code/internal/channel/mattermost"
 	qqch "github.com/dfbb/im2code/internal/channel/qq"
 	slackch "github.com/dfbb/im2code/internal/channel/slack"
 	"github.com/dfbb/im2code/internal/channel/telegram"
+	"github.com/dfbb/im2code/internal/config"
 )
 
 var loginCmd = &cobra.Command{
@@ -26,9 +33,11 @@ var loginCmd = &cobra.Command{
 }
 
 func runLogin(cmd *cobra.Command, args []string) error {
-	ch := strings.ToLower(args[0])
-	cfgPath := configPath()
+	return loginChannel(strings.ToLower(args[0]), configPath())
+}
 
+// loginChannel runs the interactive credential flow for ch.
+func loginChannel(ch, cfgPath string) error {
 	switch ch {
 	case "telegram":
 		return loginToken(cfgPath, "telegram", "Bot Token")
@@ -36,6 +45,8 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		return loginToken(cfgPath, "discord", "Bot Token")
 	case "slack":
 		return loginSlack(cfgPath)
+	case "mattermost":
+		return loginMattermost(cfgPath)
 	case "whatsapp":
 		return loginWhatsApp()
 	case "feishu":
@@ -44,8 +55,18 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		return loginDingTalk(cfgPath)
 	case "qq":
 		return loginQQ(cfgPath)
+	case "web":
+		return loginWeb(cfgPath)
+	case "matrix":
+		return loginMatrix(cfgPath)
+	case "irc":
+		return loginIRC(cfgPath)
+	case "email":
+		return loginEmail(cfgPath)
+	case "webhook":
+		return loginWebhook(cfgPath)
 	default:
-		return fmt.Errorf("unknown channel: %s\nSupported: telegram, discord, slack, whatsapp, feishu, dingtalk, qq", ch)
+		return fmt.Errorf("unknown channel: %s\nSupported: telegram, discord, slack, mattermost, whatsapp, feishu, dingtalk, qq, web, matrix, irc, email, webhook", ch)
 	}
 }
 
@@ -93,6 +114,25 @@ func loginSlack(cfgPath string) error {
 	})
 }
 
+func loginMattermost(cfgPath string) error {
+	fmt.Print("Server URL (e.g. https://mattermost.example.com): ")
+	serverURL, _ := readLine()
+	fmt.Print("Personal Access Token: ")
+	token, _ := readSecret()
+	fmt.Print("Verifying... ")
+	identity, err := mattermostch.CheckToken(serverURL, token)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	fmt.Printf("OK (%s)\n", identity)
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channels := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channels, "mattermost")
+		ch["url"] = serverURL
+		ch["token"] = token
+	})
+}
+
 func loginFeishu(cfgPath string) error {
 	fmt.Print("App ID: ")
 	appID, _ := readLine()
@@ -159,6 +199,202 @@ func loginQQ(cfgPath string) error {
 	})
 }
 
+func loginMatrix(cfgPath string) error {
+	fmt.Print("Homeserver URL (e.g. https://matrix.example.org): ")
+	homeserver, _ := readLine()
+	fmt.Print("User ID (e.g. @im2code:example.org): ")
+	userID, _ := readLine()
+	fmt.Print("Access Token: ")
+	token, _ := readSecret()
+	fmt.Print("Verifying... ")
+	identity, err := matrixch.CheckToken(homeserver, token)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if identity != userID {
+		return fmt.Errorf("login failed: token belongs to %s, not %s", identity, userID)
+	}
+	fmt.Printf("OK (%s)\n", identity)
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channels := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channels, "matrix")
+		ch["homeserver"] = homeserver
+		ch["user_id"] = userID
+		ch["access_token"] = token
+	})
+}
+
+func loginIRC(cfgPath string) error {
+	fmt.Print("Server (host:port, e.g. irc.libera.chat:6697): ")
+	server, _ := readLine()
+	fmt.Print("Use TLS? [Y/n]: ")
+	tlsAnswer, _ := readLine()
+	useTLS := !strings.HasPrefix(strings.ToLower(tlsAnswer), "n")
+	fmt.Print("Nick: ")
+	nick, _ := readLine()
+	fmt.Print("Authentication (sasl, nickserv, none) [sasl]: ")
+	auth, _ := readLine()
+	auth = strings.ToLower(auth)
+	switch auth {
+	case "":
+		auth = "sasl"
+	case "none":
+		auth = ""
+	case "sasl", "nickserv":
+	default:
+		return fmt.Errorf("unknown authentication method %q", auth)
+	}
+	password := ""
+	if auth != "" {
+		fmt.Print("Password: ")
+		password, _ = readSecret()
+	}
+	fmt.Print("Channels to join (comma-separated, empty for queries only): ")
+	chanLine, _ := readLine()
+	var channels []any
+	for _, c := range strings.Split(chanLine, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			channels = append(channels, c)
+		}
+	}
+	fmt.Print("Verifying... ")
+	identity, err := ircch.Check(ircch.Options{Server: server, TLS: useTLS, Nick: nick, Password: password, Auth: auth})
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	fmt.Printf("OK (%s)\n", identity)
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channelsMap := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channelsMap, "irc")
+		ch["server"] = server
+		ch["tls"] = useTLS
+		ch["nick"] = nick
+		ch["auth"] = auth
+		ch["password"] = password
+		ch["channels"] = channels
+	})
+}
+
+func loginEmail(cfgPath string) error {
+	fmt.Print("IMAP server (host:port, e.g. imap.example.com:993): ")
+	imapServer, _ := readLine()
+	fmt.Print("IMAP over TLS? [Y/n]: ")
+	imapTLS, _ := readLine()
+	fmt.Print("SMTP server (host:port, e.g. smtp.example.com:587): ")
+	smtpServer, _ := readLine()
+	fmt.Print("SMTP implicit TLS (port 465)? [y/N]: ")
+	smtpTLS, _ := readLine()
+	fmt.Print("Username: ")
+	username, _ := readLine()
+	fmt.Print("Password: ")
+	password, _ := readSecret()
+	fmt.Println("The From header can be forged, so senders must also be authenticated.")
+	fmt.Print("Trusted authserv-id of your mail server, as in its Authentication-Results headers (empty for a shared secret instead): ")
+	authServID, _ := readLine()
+	var secret string
+	if authServID == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		secret = hex.EncodeToString(buf)
+		fmt.Printf("Generated secret: %s — include it in the subject or body of every mail to the bot.\n", secret)
+	}
+	opts := emailch.Options{
+		IMAPServer: imapServer,
+		IMAPTLS:    !strings.HasPrefix(strings.ToLower(imapTLS), "n"),
+		SMTPServer: smtpServer,
+		SMTPTLS:    strings.HasPrefix(strings.ToLower(smtpTLS), "y"),
+		Username:   username,
+		Password:   password,
+	}
+	fmt.Print("Verifying... ")
+	identity, err := emailch.Check(opts)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	fmt.Printf("OK (%s)\n", identity)
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channels := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channels, "email")
+		ch["imap_server"] = opts.IMAPServer
+		ch["imap_tls"] = opts.IMAPTLS
+		ch["smtp_server"] = opts.SMTPServer
+		ch["smtp_tls"] = opts.SMTPTLS
+		ch["username"] = opts.Username
+		ch["password"] = opts.Password
+		if authServID != "" {
+			ch["authserv_id"] = authServID
+		} else {
+			ch["secret"] = secret
+		}
+	})
+}
+
+func loginWeb(cfgPath string) error {
+	fmt.Print("Listen address [127.0.0.1:8787]: ")
+	listen, _ := readLine()
+	if listen == "" {
+		listen = "127.0.0.1:8787"
+	}
+	fmt.Print("User ID to issue an access token for (required unless listening on 127.0.0.1): ")
+	user, _ := readLine()
+	var token string
+	if user != "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(buf)
+		fmt.Printf("Token for %s: %s\nOpen http://%s/?token=%s\n", user, token, listen, token)
+	}
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channels := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channels, "web")
+		ch["listen"] = listen
+		delete(ch, "token") // the shared token was replaced by per-user tokens
+		if token != "" {
+			tokens := getOrCreateMap(ch, "tokens")
+			tokens[user] = token
+		}
+	})
+}
+
+func loginWebhook(cfgPath string) error {
+	fmt.Print("Listen address [127.0.0.1:8788]: ")
+	listen, _ := readLine()
+	if listen == "" {
+		listen = "127.0.0.1:8788"
+	}
+	fmt.Print("Callback URL for replies (empty for inbound only): ")
+	callbackURL, _ := readLine()
+	fmt.Print("Signing secret (empty to generate one): ")
+	secret, _ := readSecret()
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		secret = hex.EncodeToString(buf)
+		fmt.Printf("Generated secret: %s\n", secret)
+	}
+	cfg := config.WebhookConfig{Listen: listen, Secret: secret, CallbackURL: callbackURL}
+	if _, err := checkWebhook(cfg); err != nil {
+		return err
+	}
+	return saveConfig(cfgPath, func(raw map[string]any) {
+		channels := getOrCreateMap(raw, "channels")
+		ch := getOrCreateMap(channels, "webhook")
+		ch["listen"] = listen
+		ch["secret"] = secret
+		if callbackURL != "" {
+			ch["callback_url"] = callbackURL
+		} else {
+			delete(ch, "callback_url")
+		}
+	})
+}
+
 func loginWhatsApp() error {
 	fmt.Println("WhatsApp login: run the daemon with whatsapp enabled.")
 	fmt.Println("A QR code will be printed on first run.")
@@ -1,65 +1,137 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/control"
+	"github.com/dfbb/im2code/internal/state"
 )
 
 var rebindCmd = &cobra.Command{
 	Use:   "rebind <channel>",
 	Short: "Reset channel binding and force re-authentication",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runRebind,
+	Long: `Forget who activated a channel so the next #im2code claims it again.
+
+Clears the channel's allow_from and roles in config, its grants from
+#im2code and #grant, and its chat bindings. With --login the channel's
+credentials are replaced through the login flow as well; for WhatsApp the
+pairing is always reset.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRebind,
+}
+
+var flagRebindLogin bool
+
+func init() {
+	rebindCmd.Flags().BoolVar(&flagRebindLogin, "login", false, "also replace the channel's credentials")
 }
 
+// rebindChannels are the channels rebind accepts: every channel login knows.
+var rebindChannels = []string{"telegram", "discord", "slack", "mattermost", "whatsapp", "feishu", "dingtalk", "qq", "web", "matrix", "irc", "email", "webhook"}
+
 func runRebind(cmd *cobra.Command, args []string) error {
 	ch := strings.ToLower(args[0])
-	switch ch {
-	case "whatsapp":
-		return rebindWhatsApp()
-	default:
-		return fmt.Errorf("rebind not supported for %q (only whatsapp)", ch)
+	known := false
+	for _, name := range rebindChannels {
+		known = known || name == ch
 	}
-}
+	if !known {
+		return fmt.Errorf("unknown channel: %s\nSupported: %s", ch, strings.Join(rebindChannels, ", "))
+	}
+	cmd.SilenceUsage = true
 
-func rebindWhatsApp() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
+	// The daemon keeps grants and bindings in memory and writes them back, so
+	// it must not be running.
+	cfg := loadConfigOrDefaults()
+	if _, err := control.Call(controlSocketPath(cfg), control.Request{Action: "status"}); !errors.Is(err, control.ErrNotRunning) {
+		return fmt.Errorf("im2code is running; stop it before rebinding %s", ch)
 	}
 
 	cfgPath := configPath()
-
-	// Clear allow_from for whatsapp in config so #im2code can be used again.
 	if err := updateConfig(cfgPath, func(raw map[string]any) {
 		if channels, ok := raw["channels"].(map[string]any); ok {
-			if wa, ok := channels["whatsapp"].(map[string]any); ok {
-				delete(wa, "allow_from")
+			if m, ok := channels[ch].(map[string]any); ok {
+				delete(m, "allow_from")
+			}
+		}
+		if roles, ok := raw["roles"].(map[string]any); ok {
+			for key := range roles {
+				if strings.HasPrefix(key, ch+":") {
+					delete(roles, key)
+				}
 			}
 		}
 	}); err != nil {
 		fmt.Fprintf(os.Stderr, "warning: could not update config: %v\n", err)
 	} else {
-		fmt.Println("Cleared whatsapp allow_from in config.")
+		fmt.Printf("Cleared %s allow_from and roles in config.\n", ch)
 	}
 
-	// Delete the session database to force QR re-pairing on next start.
-	sessionDir := home + "/.im2code/whatsapp"
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	grants, err := state.NewGrants(grantsPath())
+	if err != nil {
+		return err
+	}
+	revoked := 0
+	for _, g := range grants.List() {
+		if strings.HasPrefix(g.Key, ch+":") {
+			if _, err := grants.Delete(g.Key); err != nil {
+				return err
+			}
+			revoked++
+		}
+	}
+	fmt.Printf("Removed %d grant(s).\n", revoked)
+
+	subs, err := state.NewSubscriptions(home + "/.im2code/subscriptions.json")
+	if err != nil {
+		return err
+	}
+	unbound := 0
+	for key := range subs.All() {
+		if strings.HasPrefix(key, ch+":") {
+			subs.Delete(key)
+			unbound++
+		}
+	}
+	fmt.Printf("Removed %d chat binding(s).\n", unbound)
+
+	if ch == "whatsapp" {
+		if err := resetWhatsAppSession(cfg.Channels.WhatsApp.SessionDir, home); err != nil {
+			return err
+		}
+	} else if flagRebindLogin {
+		if err := loginChannel(ch, cfgPath); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Done. Run 'im2code start' and send %sim2code on %s to activate it again.\n", cfg.Prefix, ch)
+	return nil
+}
+
+// resetWhatsAppSession deletes the session database to force QR re-pairing on
+// next start.
+func resetWhatsAppSession(sessionDir, home string) error {
+	if sessionDir == "" {
+		sessionDir = home + "/.im2code/whatsapp"
+	}
 	dbPath := sessionDir + "/session.db"
 	if err := os.Remove(dbPath); err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("No session file found (already clean).")
-		} else {
-			return fmt.Errorf("removing session: %w", err)
+			return nil
 		}
-	} else {
-		fmt.Printf("Deleted %s\n", dbPath)
+		return fmt.Errorf("removing session: %w", err)
 	}
-
-	fmt.Println("Done. Run 'im2code start --channels whatsapp' to re-pair via QR code,")
-	fmt.Println("then send #im2code to activate.")
+	fmt.Printf("Deleted %s; a new QR code is printed on next start.\n", dbPath)
 	return nil
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/dingtalk"
+	"github.com/dfbb/im2code/internal/channel/discord"
+	"github.com/dfbb/im2code/internal/channel/email"
+	"github.com/dfbb/im2code/internal/channel/feishu"
+	"github.com/dfbb/im2code/internal/channel/irc"
+	"github.com/dfbb/im2code/internal/channel/matrix"
+	"github.com/dfbb/im2code/internal/channel/mattermost"
+	"github.com/dfbb/im2code/internal/channel/qq"
+	"github.com/dfbb/im2code/internal/channel/slack"
+	"github.com/dfbb/im2code/internal/channel/telegram"
+	"github.com/dfbb/im2code/internal/channel/web"
+	"github.com/dfbb/im2code/internal/channel/webhook"
+	"github.com/dfbb/im2code/internal/channel/whatsapp"
+	"github.com/dfbb/im2code/internal/config"
+	"github.com/dfbb/im2code/internal/history"
+	"github.com/dfbb/im2code/internal/router"
+	"github.com/dfbb/im2code/internal/tmux"
+)
+
+// channelSpec describes one configured channel adapter.
+type channelSpec struct {
+	name  string
+	conf  any // config section; its fingerprint detects credential changes
+	build func() channel.Channel
+}
+
+// fingerprint identifies the adapter's settings, allow_from included:
+// adapters read it once, so any change needs a restart.
+func (s channelSpec) fingerprint() string {
+	data, _ := yaml.Marshal(s.conf)
+	return string(data)
+}
+
+// allowFrom returns the adapter's allow_from list.
+func (s channelSpec) allowFrom() []string {
+	data, _ := yaml.Marshal(s.conf)
+	var m struct {
+		AllowFrom []string `yaml:"allow_from"`
+	}
+	yaml.Unmarshal(data, &m)
+	return m.AllowFrom
+}
+
+// channelSpecs returns a spec for every channel that has credentials in cfg.
+func channelSpecs(cfg *config.Config, inbound chan<- channel.InboundMessage) []channelSpec {
+	c := cfg.Channels
+	var specs []channelSpec
+	add := func(name string, configured bool, conf any, build func() channel.Channel) {
+		if configured {
+			specs = append(specs, channelSpec{name: name, conf: conf, build: build})
+		}
+	}
+	add("telegram", c.Telegram.Token != "", c.Telegram, func() channel.Channel {
+		return telegram.New(c.Telegram.Token, c.Telegram.AllowFrom, inbound)
+	})
+	add("discord", c.Discord.Token != "", c.Discord, func() channel.Channel {
+		return discord.New(c.Discord.Token, c.Discord.AllowFrom, inbound)
+	})
+	add("slack", c.Slack.BotToken != "", c.Slack, func() channel.Channel {
+		return slack.New(c.Slack.BotToken, c.Slack.AppToken, c.Slack.AllowFrom, inbound)
+	})
+	add("mattermost", c.Mattermost.Token != "", c.Mattermost, func() channel.Channel {
+		return mattermost.New(c.Mattermost.URL, c.Mattermost.Token, c.Mattermost.AllowFrom, inbound)
+	})
+	// WhatsApp has no token-based credential: its first-run flow presents a QR
+	// code on stderr for pairing. Always include it when the channel is enabled.
+	add("whatsapp", true, c.WhatsApp, func() channel.Channel {
+		return whatsapp.New(c.WhatsApp.SessionDir, c.WhatsApp.AllowFrom, cfg.LogLevel, inbound)
+	})
+	add("feishu", c.Feishu.AppID != "", c.Feishu, func() channel.Channel {
+		return feishu.New(c.Feishu.AppID, c.Feishu.AppSecret, nil, inbound)
+	})
+	add("dingtalk", c.DingTalk.ClientID != "", c.DingTalk, func() channel.Channel {
+		return dingtalk.New(c.DingTalk.ClientID, c.DingTalk.ClientSecret, nil, inbound)
+	})
+	add("qq", c.QQ.AppID != "" && c.QQ.Secret != "", c.QQ, func() channel.Channel {
+		return qq.New(c.QQ.AppID, c.QQ.Secret, c.QQ.AllowFrom, inbound)
+	})
+	add("matrix", c.Matrix.AccessToken != "", c.Matrix, func() channel.Channel {
+		return matrix.New(c.Matrix.Homeserver, c.Matrix.UserID, c.Matrix.AccessToken, c.Matrix.AllowFrom, inbound)
+	})
+	add("irc", c.IRC.Server != "" && c.IRC.Nick != "", c.IRC, func() channel.Channel {
+		return irc.New(ircOptions(c.IRC), c.IRC.AllowFrom, inbound)
+	})
+	add("email", c.Email.IMAPServer != "" && c.Email.SMTPServer != "", c.Email, func() channel.Channel {
+		return email.New(emailOptions(c.Email), c.Email.AllowFrom, inbound)
+	})
+	add("web", c.Web.Listen != "", c.Web, func() channel.Channel {
+		return web.New(c.Web.Listen, c.Web.Tokens, c.Web.AllowFrom, inbound)
+	})
+	add("webhook", c.Webhook.Listen != "", c.Webhook, func() channel.Channel {
+		return webhook.New(webhookOptions(c.Webhook), c.Webhook.AllowFrom, inbound)
+	})
+	return specs
+}
+
+// channelEnabled reports whether name passes the --channels filter.
+func channelEnabled(name string) bool {
+	return len(flagChannels) == 0 || slices.Contains(flagChannels, name)
+}
+
+// reloader re-reads the config on SIGHUP or when the file changes and applies
+// it to the running daemon. SIGHUP must be routed to hup before any channel
+// starts, as its default action would terminate the daemon.
+type reloader struct {
+	path          string
+	cfg           *config.Config // last applied config
+	mgr           *channel.Manager
+	rtr           *router.Router
+	promptMatcher *tmux.PromptMatcher
+	inbound       chan<- channel.InboundMessage
+	fingerprints  map[string]string   // running channel → spec fingerprint
+	allowFrom     map[string][]string // running channel → allow_from it was built with
+	retention     *atomic.Pointer[historyRetention]
+	prunable      bool // a history backend applies retention
+	hup           <-chan os.Signal
+	modTime       time.Time
+}
+
+func (r *reloader) run(ctx context.Context) {
+	if fi, err := os.Stat(r.path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.hup:
+			slog.Info("reload: SIGHUP received")
+			r.reload()
+		case <-ticker.C:
+			fi, err := os.Stat(r.path)
+			if err != nil || fi.ModTime().Equal(r.modTime) {
+				continue
+			}
+			r.modTime = fi.ModTime()
+			slog.Info("reload: config file changed")
+			r.reload()
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		slog.Error("reload: keeping current config", "err", err)
+		return
+	}
+	old := r.cfg
+	// r.cfg becomes the applied config: a setting that fails to apply keeps
+	// its old value there, so the next reload tries it again.
+	defer func() { r.cfg = cfg }()
+
+	// Only settings that changed in the file are applied.
+	if cfg.Prefix != old.Prefix && flagPrefix == "" {
+		r.rtr.SetPrefix(cfg.Prefix)
+		slog.Info("reload: prefix updated", "prefix", cfg.Prefix)
+	}
+	if !slices.Equal(cfg.Tmux.PromptPatterns, old.Tmux.PromptPatterns) {
+		r.promptMatcher.SetPatterns(cfg.Tmux.PromptPatterns)
+		slog.Info("reload: prompt patterns updated")
+	}
+	if cfg.Tmux.WatchTimeMin != old.Tmux.WatchTimeMin || cfg.Tmux.WatchTimeMax != old.Tmux.WatchTimeMax {
+		min := parseClamped(cfg.Tmux.WatchTimeMin, 5*time.Second, time.Second, 3600*time.Second)
+		max := parseClamped(cfg.Tmux.WatchTimeMax, 20*time.Second, time.Second, 3600*time.Second)
+		r.rtr.SetWatchIntervals(min, max)
+		slog.Info("reload: watch intervals updated", "min", min, "max", max)
+	}
+	if cfg.Tmux.WatchMode != old.Tmux.WatchMode || cfg.Tmux.DiffRedraw != old.Tmux.DiffRedraw {
+		r.rtr.SetWatchOutput(cfg.Tmux.WatchMode, cfg.Tmux.DiffRedraw)
+		slog.Info("reload: watch mode updated", "mode", cfg.Tmux.WatchMode, "redraw", cfg.Tmux.DiffRedraw)
+	}
+	if cfg.Tmux.WatchImages != old.Tmux.WatchImages {
+		r.rtr.SetWatchImages(cfg.Tmux.WatchImages)
+		slog.Info("reload: watch images updated", "enabled", cfg.Tmux.WatchImages)
+	}
+	if cfg.Uploads != old.Uploads {
+		r.rtr.SetUploadDir(cfg.Uploads.Dir)
+		channel.SetMaxUploadSize(int64(cfg.Uploads.MaxSizeMB) << 20)
+		slog.Info("reload: upload settings updated", "dir", cfg.Uploads.Dir, "max_size_mb", cfg.Uploads.MaxSizeMB)
+	}
+	if !maps.Equal(cfg.Roles, old.Roles) {
+		r.rtr.SetRoles(cfg.Roles)
+		slog.Info("reload: roles updated", "count", len(cfg.Roles))
+	}
+	if !slices.Equal(cfg.SessionACL.Default, old.SessionACL.Default) ||
+		!maps.EqualFunc(cfg.SessionACL.Rules, old.SessionACL.Rules, slices.Equal) {
+		if err := r.rtr.SetSessionACL(router.SessionACL(cfg.SessionACL)); err != nil {
+			slog.Error("reload: keeping current session_acl", "err", err)
+			cfg.SessionACL = old.SessionACL
+		} else {
+			slog.Info("reload: session_acl updated", "rules", len(cfg.SessionACL.Rules))
+		}
+	}
+	if !slices.Equal(cfg.Guard.Deny, old.Guard.Deny) || !slices.Equal(cfg.Guard.Confirm, old.Guard.Confirm) ||
+		cfg.Guard.ConfirmTimeout != old.Guard.ConfirmTimeout {
+		if err := r.rtr.SetGuard(guardRules(cfg.Guard)); err != nil {
+			slog.Error("reload: keeping current guard rules", "err", err)
+			cfg.Guard = old.Guard
+		} else {
+			slog.Info("reload: guard rules updated", "deny", len(cfg.Guard.Deny), "confirm", len(cfg.Guard.Confirm))
+		}
+	}
+	if cfg.TOTP.Secret != old.TOTP.Secret || !slices.Equal(cfg.TOTP.Protected, old.TOTP.Protected) ||
+		cfg.TOTP.ReauthAfter != old.TOTP.ReauthAfter {
+		if err := r.rtr.SetTOTP(totpSettings(cfg.TOTP)); err != nil {
+			slog.Error("reload: keeping current totp settings", "err", err)
+			cfg.TOTP = old.TOTP
+		} else {
+			slog.Info("reload: totp settings updated", "enabled", cfg.TOTP.Secret != "", "protected", len(cfg.TOTP.Protected))
+		}
+	}
+	if !slices.Equal(cfg.History.Redact, old.History.Redact) || cfg.History.RedactBuiltin != old.History.RedactBuiltin {
+		if rd, err := history.NewRedactor(cfg.History.Redact, cfg.History.RedactBuiltin); err != nil {
+			slog.Error("reload: keeping current history redaction", "err", err)
+			cfg.History.Redact, cfg.History.RedactBuiltin = old.History.Redact, old.History.RedactBuiltin
+		} else {
+			r.rtr.SetRedactor(rd)
+			slog.Info("reload: history redaction updated", "patterns", len(cfg.History.Redact), "builtin", cfg.History.RedactBuiltin)
+		}
+	}
+	if cfg.History.MaxAge != old.History.MaxAge || cfg.History.MaxRows != old.History.MaxRows {
+		if !r.prunable && (cfg.History.MaxAge != "" || cfg.History.MaxRows > 0) {
+			slog.Error("reload: ignoring history retention: it needs a sqlite or jsonl backend")
+			cfg.History.MaxAge, cfg.History.MaxRows = old.History.MaxAge, old.History.MaxRows
+		} else {
+			r.retention.Store(newHistoryRetention(cfg.History))
+			slog.Info("reload: history retention updated", "max_age", cfg.History.MaxAge, "max_rows", cfg.History.MaxRows)
+		}
+	}
+	if cfg.Tmux.MaxOutputLines != old.Tmux.MaxOutputLines {
+		r.rtr.SetMaxLines(cfg.Tmux.MaxOutputLines)
+		slog.Info("reload: max_output_lines updated", "lines", cfg.Tmux.MaxOutputLines)
+	}
+
+	wanted := make(map[string]channelSpec)
+	for _, spec := range channelSpecs(cfg, r.inbound) {
+		if channelEnabled(spec.name) {
+			wanted[spec.name] = spec
+		}
+	}
+	for name := range r.fingerprints {
+		if _, ok := wanted[name]; !ok {
+			r.mgr.Unregister(name)
+			delete(r.fingerprints, name)
+			delete(r.allowFrom, name)
+			slog.Info("reload: channel stopped", "channel", name)
+		}
+	}
+	for name, spec := range wanted {
+		fp := spec.fingerprint()
+		prev, running := r.fingerprints[name]
+		if running && prev == fp {
+			continue
+		}
+		if running {
+			r.mgr.Unregister(name)
+			slog.Info("reload: channel settings changed, restarting", "channel", name)
+		} else {
+			slog.Info("reload: channel started", "channel", name)
+		}
+		r.mgr.Register(spec.build())
+		r.fingerprints[name] = fp
+		r.allowFrom[name] = spec.allowFrom()
+	}
+	r.rtr.SetAllowFrom(r.allowFrom)
+}
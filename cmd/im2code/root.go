@@ -26,4 +26,12 @@ func init() {
 	rootCmd.AddCommand(checkCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(rebindCmd)
+	rootCmd.AddCommand(attachCmd)
+	rootCmd.AddCommand(detachCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(totpCmd)
+	rootCmd.AddCommand(grantsCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(transcriptCmd)
+	rootCmd.AddCommand(auditCmd)
 }
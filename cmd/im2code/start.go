@@ -10,20 +10,16 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/dfbb/im2code/internal/audit"
 	"github.com/dfbb/im2code/internal/channel"
-	"github.com/dfbb/im2code/internal/channel/dingtalk"
-	"github.com/dfbb/im2code/internal/channel/discord"
-	"github.com/dfbb/im2code/internal/channel/feishu"
-	"github.com/dfbb/im2code/internal/channel/qq"
-	"github.com/dfbb/im2code/internal/channel/slack"
-	"github.com/dfbb/im2code/internal/channel/telegram"
-	"github.com/dfbb/im2code/internal/channel/whatsapp"
 	"github.com/dfbb/im2code/internal/config"
+	"github.com/dfbb/im2code/internal/control"
 	"github.com/dfbb/im2code/internal/history"
 	"github.com/dfbb/im2code/internal/router"
 	"github.com/dfbb/im2code/internal/state"
@@ -102,73 +98,103 @@ func runStart(cmd *cobra.Command, args []string) error {
 
 	mgr := channel.NewManager(inbound, outbound)
 
-	enabled := func(name string) bool {
-		if len(flagChannels) == 0 {
-			return true
+	fingerprints := make(map[string]string)
+	allowFrom := make(map[string][]string)
+	for _, spec := range channelSpecs(cfg, inbound) {
+		if channelEnabled(spec.name) {
+			mgr.Register(spec.build())
+			fingerprints[spec.name] = spec.fingerprint()
+			allowFrom[spec.name] = spec.allowFrom()
 		}
-		for _, c := range flagChannels {
-			if c == name {
-				return true
-			}
-		}
-		return false
-	}
-
-	if enabled("telegram") && cfg.Channels.Telegram.Token != "" {
-		mgr.Register(telegram.New(cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom, inbound))
-	}
-	if enabled("discord") && cfg.Channels.Discord.Token != "" {
-		mgr.Register(discord.New(cfg.Channels.Discord.Token, cfg.Channels.Discord.AllowFrom, inbound))
-	}
-	if enabled("slack") && cfg.Channels.Slack.BotToken != "" {
-		mgr.Register(slack.New(cfg.Channels.Slack.BotToken, cfg.Channels.Slack.AppToken, cfg.Channels.Slack.AllowFrom, inbound))
-	}
-	// WhatsApp has no token-based credential: its first-run flow presents a QR
-	// code on stderr for pairing. Always include it when the channel is enabled.
-	if enabled("whatsapp") {
-		mgr.Register(whatsapp.New(cfg.Channels.WhatsApp.SessionDir, cfg.Channels.WhatsApp.AllowFrom, cfg.LogLevel, inbound))
-	}
-	if enabled("feishu") && cfg.Channels.Feishu.AppID != "" {
-		mgr.Register(feishu.New(cfg.Channels.Feishu.AppID, cfg.Channels.Feishu.AppSecret, nil, inbound))
-	}
-	if enabled("dingtalk") && cfg.Channels.DingTalk.ClientID != "" {
-		mgr.Register(dingtalk.New(cfg.Channels.DingTalk.ClientID, cfg.Channels.DingTalk.ClientSecret, nil, inbound))
-	}
-	if enabled("qq") && cfg.Channels.QQ.AppID != "" && cfg.Channels.QQ.Secret != "" {
-		mgr.Register(qq.New(cfg.Channels.QQ.AppID, cfg.Channels.QQ.Secret, cfg.Channels.QQ.AllowFrom, inbound))
 	}
 
 	cfgFile := configPath()
+	grants, err := state.NewGrants(dataDir + "/grants.json")
+	if err != nil {
+		return fmt.Errorf("loading grants: %w", err)
+	}
 	onActivate := func(ch, senderID string) {
-		err := updateConfig(cfgFile, func(raw map[string]any) {
-			chanMap := getOrCreateMap(getOrCreateMap(raw, "channels"), ch)
-			existing, _ := chanMap["allow_from"].([]any)
-			chanMap["allow_from"] = append(existing, senderID)
-		})
-		if err != nil {
-			slog.Error("failed to persist activated user to config", "channel", ch, "err", err)
+		if err := grants.Set(ch+":"+senderID, string(router.RoleOwner)); err != nil {
+			slog.Error("failed to persist activation", "channel", ch, "senderID", senderID, "err", err)
 		} else {
-			slog.Info("activated user saved to config", "channel", ch, "senderID", senderID)
+			slog.Info("activation saved", "channel", ch, "senderID", senderID)
 		}
 	}
 
-	histDBPath := cfg.CmdHistoryDB
-	if histDBPath == "" {
-		histDBPath = dataDir + "/cmd_history.db"
+	// onRoleChange persists #grant and #revoke to the grant store.
+	onRoleChange := func(ch, senderID string, role router.Role) {
+		var err error
+		if role == "" {
+			_, err = grants.Delete(ch + ":" + senderID)
+		} else {
+			err = grants.Set(ch+":"+senderID, string(role))
+		}
+		if err != nil {
+			slog.Error("failed to persist role change", "channel", ch, "senderID", senderID, "err", err)
+		}
 	}
-	hist, err := history.New(histDBPath)
+
+	hist, pruners, err := openHistory(cfg)
 	if err != nil {
-		return fmt.Errorf("opening command history db: %w", err)
+		return fmt.Errorf("opening command history: %w", err)
 	}
 	defer hist.Close()
+	redactor, err := history.NewRedactor(cfg.History.Redact, cfg.History.RedactBuiltin)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	retention := &atomic.Pointer[historyRetention]{}
+	retention.Store(newHistoryRetention(cfg.History))
+	auditLog, err := audit.Open(auditLogPath(cfg))
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
 
 	rtr := router.New(prefix, subs, bridge, outbound, onActivate, hist, promptMatcher, watchTimeMin, watchTimeMax, cfg.Tmux.MaxOutputLines)
+	rtr.SetWatchOutput(cfg.Tmux.WatchMode, cfg.Tmux.DiffRedraw)
+	rtr.SetWatchImages(cfg.Tmux.WatchImages)
+	rtr.SetRedactor(redactor)
+	rtr.SetAuditor(auditLog)
+	rtr.SetRoles(cfg.Roles)
+	rtr.SetGrants(grants.Roles())
+	rtr.SetAllowFrom(allowFrom)
+	if err := rtr.SetSessionACL(router.SessionACL(cfg.SessionACL)); err != nil {
+		return fmt.Errorf("session_acl: %w", err)
+	}
+	if err := rtr.SetGuard(guardRules(cfg.Guard)); err != nil {
+		return fmt.Errorf("guard: %w", err)
+	}
+	if err := rtr.SetTOTP(totpSettings(cfg.TOTP)); err != nil {
+		return fmt.Errorf("totp: %w", err)
+	}
+	rtr.OnRoleChange(onRoleChange)
+	rtr.SetMediaOutput(dataDir+"/media", mgr.SupportsMedia)
+	rtr.SetDataDir(dataDir)
+	rtr.SetUploadDir(cfg.Uploads.Dir)
+	channel.SetMaxUploadSize(int64(cfg.Uploads.MaxSizeMB) << 20)
+	detectors := &detectorRegistry{m: make(map[detectorKey]control.Detector)}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	// SIGHUP reloads the config; it is caught before any channel starts.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
 	var wg sync.WaitGroup
 
+	ctl := &daemonControl{mgr: mgr, rtr: rtr, detectors: detectors, startedAt: time.Now()}
+	if srv, err := control.Listen(controlSocketPath(cfg), ctl); err != nil {
+		slog.Warn("control socket disabled", "err", err)
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.Serve(ctx)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -193,7 +219,34 @@ func runStart(cmd *cobra.Command, args []string) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		watchSubscriptions(ctx, rtr, bridge, idleTimeout, watchTimeMin, watchTimeMax, cfg.Tmux.MaxOutputLines, promptMatcher, outbound)
+		watchSubscriptions(ctx, rtr, bridge, idleTimeout, promptMatcher, outbound, detectors)
+	}()
+
+	if len(pruners) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pruneHistory(ctx, pruners, retention)
+		}()
+	}
+
+	rl := &reloader{
+		path:          cfgFile,
+		cfg:           cfg,
+		mgr:           mgr,
+		rtr:           rtr,
+		promptMatcher: promptMatcher,
+		inbound:       inbound,
+		fingerprints:  fingerprints,
+		allowFrom:     allowFrom,
+		retention:     retention,
+		prunable:      len(pruners) > 0,
+		hup:           hup,
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rl.run(ctx)
 	}()
 
 	slog.Info("im2code started", "prefix", prefix)
@@ -203,6 +256,14 @@ func runStart(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// detectorKey identifies one idle detector. Chats watching the same session
+// with the same intervals share a detector; different intervals get their own.
+type detectorKey struct {
+	session  string
+	min, max time.Duration
+	maxLines int
+}
+
 // watchSubscriptions periodically checks which subscriptions have watch mode enabled
 // and runs idle detectors for them.
 func watchSubscriptions(
@@ -210,102 +271,110 @@ func watchSubscriptions(
 	rtr *router.Router,
 	bridge *tmux.Bridge,
 	timeout time.Duration,
-	watchMin time.Duration,
-	watchMax time.Duration,
-	maxLines int,
 	pm *tmux.PromptMatcher,
 	outbound chan<- channel.OutboundMessage,
+	detectors *detectorRegistry,
 ) {
-	// maps session name → cancel func for its running IdleDetector
-	active := make(map[string]context.CancelFunc)
-	// track the intervals used to start each active detector
-	activeMin := make(map[string]time.Duration)
-	activeMax := make(map[string]time.Duration)
+	// maps detector key → cancel func for its running IdleDetector
+	active := make(map[detectorKey]context.CancelFunc)
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	startDetector := func(s string, wMin, wMax time.Duration) {
+	startDetector := func(k detectorKey) {
 		detCtx, cancel := context.WithCancel(ctx)
-		active[s] = cancel
-		activeMin[s] = wMin
-		activeMax[s] = wMax
+		active[k] = cancel
+
+		// Last content pushed to each chat, for diff mode. Only touched from
+		// the detector's goroutine.
+		lastPushed := make(map[string]string)
 
 		onIdle := func(content string) {
-			current := rtr.WatchedChats()
-			for chatKey, sess := range current {
-				if sess != s {
+			maxLines := rtr.MaxLines()
+			mode, redraw := rtr.WatchOutput()
+			images := rtr.WatchImages()
+			shot := "" // rendered on first use, shared by every chat of this push
+			for _, w := range rtr.Watches() {
+				if (detectorKey{w.Session, w.Min, w.Max, maxLines}) != k {
 					continue
 				}
-				parts := strings.SplitN(chatKey, ":", 2)
+				parts := strings.SplitN(w.Chat, ":", 2)
 				if len(parts) != 2 {
 					continue
 				}
-				msg := channel.OutboundMessage{
-					Channel: parts[0],
-					ChatID:  parts[1],
-					Text:    "```\n" + content + "\n```",
+				msg := channel.OutboundMessage{Channel: parts[0], ChatID: parts[1]}
+				if images && shot == "" && rtr.CanSendMedia(parts[0]) {
+					path, err := rtr.Shot(k.session)
+					if err != nil {
+						slog.Warn("watch: screenshot failed, sending text", "session", k.session, "err", err)
+						images = false
+					}
+					shot = path
+				}
+				if images && shot != "" && rtr.CanSendMedia(parts[0]) {
+					msg.Media = []string{shot}
+					lastPushed[w.Chat] = content
+					rtr.RecordOutput(w.Chat, k.session, content)
+				} else {
+					text := content
+					if mode == "diff" {
+						added, _ := tmux.DiffLines(lastPushed[w.Chat], content, redraw)
+						lastPushed[w.Chat] = content
+						if added == "" {
+							continue
+						}
+						text = added
+					}
+					msg.Text = "```\n" + text + "\n```"
+					rtr.RecordOutput(w.Chat, k.session, text)
 				}
 				select {
 				case outbound <- msg:
 				default:
 					slog.Warn("watchSubscriptions: outbound full, dropping capture",
-						"session", s)
+						"session", k.session)
 				}
 			}
 		}
 
-		det := tmux.NewIdleDetector(bridge, s, wMin, wMax, maxLines, pm, onIdle)
+		det := tmux.NewIdleDetector(bridge, k.session, k.min, k.max, k.maxLines, pm, onIdle)
 		go det.Run(detCtx)
-		slog.Info("watch: started idle detector", "session", s, "min", wMin, "max", wMax)
+		detectors.set(k)
+		slog.Info("watch: started idle detector", "session", k.session, "min", k.min, "max", k.max)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			for _, cancel := range active {
+			for k, cancel := range active {
 				cancel()
+				detectors.remove(k)
 			}
 			return
 		case <-ticker.C:
-			curMin, curMax := rtr.WatchIntervals()
-
-			// Get current snapshot: chatKey → session for all watched chats
-			watched := rtr.WatchedChats() // map[chatKey]session
+			maxLines := rtr.MaxLines()
 
-			// Build set of sessions currently needed
-			needed := make(map[string]bool)
-			for _, session := range watched {
-				needed[session] = true
-			}
-
-			// Stop detectors for sessions no longer watched
-			for session, cancel := range active {
-				if !needed[session] {
-					cancel()
-					delete(active, session)
-					delete(activeMin, session)
-					delete(activeMax, session)
-				}
+			// Build set of detectors currently needed
+			needed := make(map[detectorKey]bool)
+			for _, w := range rtr.Watches() {
+				needed[detectorKey{w.Session, w.Min, w.Max, maxLines}] = true
 			}
 
-			// Restart detectors whose intervals have changed
-			for session, cancel := range active {
-				if activeMin[session] != curMin || activeMax[session] != curMax {
+			// Stop detectors no longer needed (unwatched, or settings changed)
+			for k, cancel := range active {
+				if !needed[k] {
 					cancel()
-					delete(active, session)
-					delete(activeMin, session)
-					delete(activeMax, session)
-					slog.Info("watch: restarting idle detector due to interval change", "session", session)
+					detectors.remove(k)
+					delete(active, k)
+					slog.Info("watch: stopped idle detector", "session", k.session, "min", k.min, "max", k.max)
 				}
 			}
 
-			// Start detectors for newly watched sessions (or restarted ones)
-			for _, session := range watched {
-				if _, ok := active[session]; ok {
-					continue // already running
+			// Start detectors for new keys
+			for k := range needed {
+				if _, ok := active[k]; !ok {
+					startDetector(k)
 				}
-				startDetector(session, curMin, curMax)
 			}
 		}
 	}
@@ -345,6 +414,72 @@ func setupLogging(level, logFile string) error {
 	return nil
 }
 
+// historyRetention is how long and how much command history is kept.
+type historyRetention struct {
+	maxAge  time.Duration // 0 = forever
+	maxRows int           // 0 = no limit
+}
+
+func newHistoryRetention(c config.HistoryConfig) *historyRetention {
+	ret := &historyRetention{maxRows: max(c.MaxRows, 0)}
+	if c.MaxAge != "" {
+		// A typo must not prune: unparseable values keep history forever.
+		d, err := time.ParseDuration(c.MaxAge)
+		if err != nil || d <= 0 {
+			slog.Warn("history: ignoring invalid max_age", "max_age", c.MaxAge)
+		} else {
+			ret.maxAge = max(d, time.Hour)
+		}
+	}
+	return ret
+}
+
+// pruneHistory applies the current retention to every prunable backend at
+// startup and then hourly.
+func pruneHistory(ctx context.Context, pruners []history.Pruner, retention *atomic.Pointer[historyRetention]) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		ret := retention.Load()
+		if ret.maxAge > 0 || ret.maxRows > 0 {
+			var cutoff time.Time
+			if ret.maxAge > 0 {
+				cutoff = time.Now().Add(-ret.maxAge)
+			}
+			for _, p := range pruners {
+				if n, err := p.Prune(cutoff, ret.maxRows); err != nil {
+					slog.Warn("history: prune failed", "err", err)
+				} else if n > 0 {
+					slog.Info("history: pruned old rows", "rows", n)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// guardRules converts the guard config section for the router.
+func guardRules(c config.GuardConfig) router.GuardRules {
+	return router.GuardRules{
+		Deny:    c.Deny,
+		Confirm: c.Confirm,
+		Timeout: parseClamped(c.ConfirmTimeout, router.DefaultConfirmTimeout, 5*time.Second, time.Hour),
+	}
+}
+
+// totpSettings converts the totp config section for the router.
+func totpSettings(c config.TOTPConfig) router.TOTPSettings {
+	s := router.TOTPSettings{Secret: c.Secret, Protected: c.Protected}
+	if c.ReauthAfter != "" {
+		s.ReauthAfter = parseClamped(c.ReauthAfter, 0, time.Minute, 30*24*time.Hour)
+	}
+	return s
+}
+
 // parseClamped parses a duration string and clamps it to [min, max].
 // Falls back to def if the string is empty or unparseable.
 func parseClamped(s string, def, min, max time.Duration) time.Duration {
@@ -1,25 +1,91 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/dfbb/im2code/internal/control"
 	"github.com/dfbb/im2code/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var statusCmd = &cobra.Command{
 	Use:   "status",
-	Short: "Show active subscriptions",
+	Short: "Show live daemon state (falls back to saved subscriptions)",
 	RunE:  runStatus,
 }
 
+var flagStatusJSON bool
+
+func init() {
+	statusCmd.Flags().BoolVar(&flagStatusJSON, "json", false, "print the raw status as JSON")
+}
+
 func runStatus(cmd *cobra.Command, args []string) error {
+	resp, err := control.Call(controlSocketPath(loadConfigOrDefaults()), control.Request{Action: "status"})
+	if errors.Is(err, control.ErrNotRunning) {
+		return printSavedSubscriptions()
+	}
+	if err != nil {
+		return err
+	}
+	st := resp.Status
+	if flagStatusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	fmt.Printf("im2code running (pid %d, up %s)\n", st.PID, time.Since(st.StartedAt).Round(time.Second))
+	fmt.Println("\nChannels:")
+	for _, c := range st.Channels {
+		// A running adapter that reports its connection shows that instead.
+		state := c.State
+		if c.Connected != nil {
+			state = "connecting"
+			if *c.Connected {
+				state = "connected"
+			}
+		}
+		line := fmt.Sprintf("  %-12s %-10s since %s  sent %d, failed %d",
+			c.Name, state, c.Since.Format("15:04:05"), c.Sent, c.Failed)
+		if c.LastError != "" {
+			line += "  (last error: " + c.LastError + ")"
+		}
+		fmt.Println(line)
+	}
+	fmt.Println("\nBindings:")
+	if len(st.Bindings) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, b := range st.Bindings {
+		watch := ""
+		if b.Watch {
+			watch = "  [watch]"
+		}
+		fmt.Printf("  %-30s → %-15s intervals %s/%s%s\n", b.Chat, b.Session, b.WatchMin, b.WatchMax, watch)
+	}
+	fmt.Println("\nIdle detectors:")
+	if len(st.Detectors) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, d := range st.Detectors {
+		fmt.Printf("  %-20s min=%s max=%s\n", d.Session, d.Min, d.Max)
+	}
+	fmt.Printf("\nQueues: inbound %d, outbound %d\n", st.Queues.Inbound, st.Queues.Outbound)
+	return nil
+}
+
+func printSavedSubscriptions() error {
 	home, _ := os.UserHomeDir()
 	subs, err := state.NewSubscriptions(home + "/.im2code/subscriptions.json")
 	if err != nil {
 		return err
 	}
+	fmt.Println("im2code is not running; showing saved subscriptions.")
 	all := subs.All()
 	if len(all) == 0 {
 		fmt.Println("No active subscriptions.")
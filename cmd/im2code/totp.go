@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mdp/qrterminal/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/dfbb/im2code/internal/totp"
+)
+
+var totpCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Manage authenticator-app codes for activation and protected sessions",
+}
+
+var totpEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Generate a TOTP secret, save it to config and print it as a QR code",
+	Args:  cobra.NoArgs,
+	RunE:  runTOTPEnroll,
+}
+
+var totpDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Remove the TOTP secret from config",
+	Args:  cobra.NoArgs,
+	RunE:  runTOTPDisable,
+}
+
+var flagTOTPForce bool
+
+func init() {
+	totpEnrollCmd.Flags().BoolVar(&flagTOTPForce, "force", false, "replace an existing secret")
+	totpCmd.AddCommand(totpEnrollCmd)
+	totpCmd.AddCommand(totpDisableCmd)
+}
+
+func runTOTPEnroll(cmd *cobra.Command, args []string) error {
+	cfgPath := configPath()
+	cfg := loadConfigOrDefaults()
+	if cfg.TOTP.Secret != "" && !flagTOTPForce {
+		return fmt.Errorf("a TOTP secret is already set in %s; use --force to replace it", cfgPath)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	if err := saveConfig(cfgPath, func(raw map[string]any) {
+		getOrCreateMap(raw, "totp")["secret"] = secret
+	}); err != nil {
+		return err
+	}
+
+	account, _ := os.Hostname()
+	uri := totp.URI(secret, "im2code", account)
+	fmt.Println("\nScan this QR code with your authenticator app:")
+	qrterminal.GenerateHalfBlock(uri, qrterminal.L, os.Stdout)
+	fmt.Printf("\nOr enter the secret manually: %s\n", secret)
+	fmt.Printf("\nActivation now needs a code: send %sim2code <code>.\n", cfg.Prefix)
+	fmt.Println("A running daemon picks the secret up within a few seconds.")
+	return nil
+}
+
+func runTOTPDisable(cmd *cobra.Command, args []string) error {
+	return saveConfig(configPath(), func(raw map[string]any) {
+		if t, ok := raw["totp"].(map[string]any); ok {
+			delete(t, "secret")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+// Package audit keeps an append-only record of privileged actions: who did
+// what, from which chat, to which session, and whether it was allowed.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes of an action.
+const (
+	OK     = "ok"
+	Denied = "denied" // refused by a role, the session ACL, TOTP or the guard
+	Failed = "failed" // allowed, but tmux or the file system returned an error
+)
+
+// Event is one audited action.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"` // sender ID, or "control" for the control socket
+	Channel string    `json:"channel,omitempty"`
+	ChatID  string    `json:"chat_id,omitempty"`
+	Session string    `json:"session,omitempty"`
+	Action  string    `json:"action"` // e.g. activate, attach, key, grant
+	Args    []string  `json:"args,omitempty"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"` // why it was denied or failed
+}
+
+// Log appends events to a file, one JSON object per line. It never rewrites
+// or truncates the file.
+type Log struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens path for appending, creating it with mode 0600.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: open log: %w", err)
+	}
+	return &Log{f: f}, nil
+}
+
+// Write appends e, stamped with the current time if it has none. It is safe
+// to call concurrently.
+func (l *Log) Write(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("audit: write: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Filter selects events for Read. Zero fields match everything.
+type Filter struct {
+	Actor   string
+	Channel string
+	ChatID  string
+	Session string
+	Action  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // most recent n events; 0 = all
+}
+
+func (f Filter) match(e Event) bool {
+	for _, c := range []struct{ want, got string }{
+		{f.Actor, e.Actor},
+		{f.Channel, e.Channel},
+		{f.ChatID, e.ChatID},
+		{f.Session, e.Session},
+		{f.Action, e.Action},
+		{f.Outcome, e.Outcome},
+	} {
+		if c.want != "" && c.want != c.got {
+			return false
+		}
+	}
+	return (f.Since.IsZero() || !e.Time.Before(f.Since)) && (f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Read returns the events in the log at path that match f, oldest first.
+// Lines that are not valid events, such as one cut short by a crash, are
+// skipped and counted.
+func Read(path string, f Filter) (events []Event, skipped int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Action == "" {
+			skipped++
+			continue
+		}
+		if !f.match(e) {
+			continue
+		}
+		events = append(events, e)
+		if f.Limit > 0 && len(events) > f.Limit {
+			events = events[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, skipped, fmt.Errorf("audit: read %s: %w", path, err)
+	}
+	return events, skipped, nil
+}
@@ -0,0 +1,56 @@
+package audit_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/audit"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := t.TempDir() + "/audit.jsonl"
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Second)
+	for _, e := range []audit.Event{
+		{Actor: "alice", Channel: "telegram", ChatID: "1", Action: "activate", Outcome: audit.OK},
+		{Actor: "alice", Channel: "telegram", ChatID: "1", Session: "dev", Action: "attach", Args: []string{"dev"}, Outcome: audit.OK},
+		{Actor: "bob", Channel: "slack", ChatID: "C1", Session: "prod", Action: "attach", Outcome: audit.Denied, Detail: "session ACL"},
+	} {
+		if err := l.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// A torn last line is skipped, not fatal.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"time":"2026-`)
+	f.Close()
+
+	all, skipped, err := audit.Read(path, audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || skipped != 1 {
+		t.Fatalf("expected 3 events and 1 skipped line, got %d, %d", len(all), skipped)
+	}
+	if all[0].Time.Before(start) || all[1].Args[0] != "dev" {
+		t.Errorf("unexpected events %+v", all)
+	}
+
+	got, _, _ := audit.Read(path, audit.Filter{Action: "attach", Limit: 1})
+	if len(got) != 1 || got[0].Actor != "bob" || got[0].Detail != "session ACL" {
+		t.Errorf("expected the latest attach, got %+v", got)
+	}
+	got, _, _ = audit.Read(path, audit.Filter{Outcome: audit.OK, Channel: "telegram"})
+	if len(got) != 2 {
+		t.Errorf("expected alice's two events, got %+v", got)
+	}
+	if got, _, _ := audit.Read(path, audit.Filter{Until: start}); len(got) != 0 {
+		t.Errorf("expected nothing before the first write, got %+v", got)
+	}
+}
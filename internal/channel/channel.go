@@ -3,6 +3,9 @@ package channel
 import (
 	"context"
 	"log/slog"
+	"sort"
+	"sync"
+	"time"
 )
 
 // Channel is implemented by each IM platform adapter.
@@ -18,61 +21,233 @@ type InboundMessage struct {
 	ChatID        string
 	SenderID      string
 	Text          string
-	Media         []string
-	PreAuthorized bool // true when the adapter's static allowFrom list matched
+	Media         []string     // uploaded files, saved locally with SaveUpload
+	MediaErrors   []string     // attachments that could not be fetched, e.g. too large
+	Attachments   []Attachment // files not yet saved, fetched by the router
+	PreAuthorized bool         // true when the adapter's static allowFrom list matched
 }
 
 type OutboundMessage struct {
 	Channel string
 	ChatID  string
 	Text    string
-	Media   []string
+	Media   []string // local file paths; delivered only by adapters implementing MediaSender
 }
 
-// Manager runs all channels and routes outbound messages.
+// MediaSender is implemented by adapters whose Send delivers
+// OutboundMessage.Media. Other adapters ignore Media.
+type MediaSender interface {
+	SupportsMedia() bool
+}
+
+// Connector is implemented by adapters that connect to their service inside
+// Start, so that a running adapter is not mistaken for a connected one.
+type Connector interface {
+	// Connected reports whether the connection is up right now.
+	Connected() bool
+}
+
+// Channel states reported by Manager.Status.
+const (
+	StateRegistered = "registered" // not started yet
+	StateRunning    = "running"    // Start is running (the adapter handles reconnects itself); see Status.Connected
+	StateStopped    = "stopped"    // Start returned without error
+	StateFailed     = "failed"     // Start returned an error
+)
+
+// Status is a point-in-time view of one registered channel.
+type Status struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Sent      int       `json:"sent"`
+	Failed    int       `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+	// Connected is set for running adapters that implement Connector.
+	Connected *bool `json:"connected,omitempty"`
+}
+
+// Manager runs all channels and routes outbound messages. Channels may be
+// registered or unregistered while Run is active (e.g. on config reload).
 type Manager struct {
-	channels map[string]Channel
 	inbound  chan<- InboundMessage
 	outbound <-chan OutboundMessage
+
+	mu       sync.Mutex
+	ctx      context.Context // set by Run; nil until then
+	channels map[string]Channel
+	cancels  map[string]context.CancelFunc
+	status   map[string]*Status
 }
 
 func NewManager(inbound chan<- InboundMessage, outbound <-chan OutboundMessage) *Manager {
 	return &Manager{
 		channels: make(map[string]Channel),
+		cancels:  make(map[string]context.CancelFunc),
 		inbound:  inbound,
 		outbound: outbound,
+		status:   make(map[string]*Status),
 	}
 }
 
+// Register adds ch. If Run is already active the channel is started right away.
 func (m *Manager) Register(ch Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.channels[ch.Name()] = ch
+	m.status[ch.Name()] = &Status{Name: ch.Name(), State: StateRegistered, Since: time.Now()}
+	if m.ctx != nil {
+		m.start(ch)
+	}
+}
+
+// Unregister stops the named channel and removes it. Outbound messages for it
+// are dropped from then on.
+func (m *Manager) Unregister(name string) {
+	m.mu.Lock()
+	ch, ok := m.channels[name]
+	cancel := m.cancels[name]
+	delete(m.channels, name)
+	delete(m.cancels, name)
+	delete(m.status, name)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	if cancel != nil {
+		cancel()
+	}
+	ch.Stop()
+}
+
+// start runs ch in its own goroutine. The caller must hold m.mu.
+func (m *Manager) start(ch Channel) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancels[ch.Name()] = cancel
+	st := m.status[ch.Name()]
+	st.State = StateRunning
+	st.Since = time.Now()
+	go func() {
+		if err := ch.Start(ctx); err != nil {
+			slog.Error("channel error", "channel", ch.Name(), "err", err)
+			m.setState(ch, StateFailed, err)
+			return
+		}
+		m.setState(ch, StateStopped, nil)
+	}()
+}
+
+// Status returns a snapshot of every registered channel, sorted by name.
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	out := make([]Status, 0, len(m.status))
+	conns := make([]Connector, 0, len(m.status))
+	for name, st := range m.status {
+		out = append(out, *st)
+		c, _ := m.channels[name].(Connector)
+		if st.State != StateRunning {
+			c = nil
+		}
+		conns = append(conns, c)
+	}
+	m.mu.Unlock()
+	// Adapters are asked outside m.mu: Connected takes their own locks.
+	for i, c := range conns {
+		if c != nil {
+			connected := c.Connected()
+			out[i].Connected = &connected
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SupportsMedia reports whether the channel registered as name can deliver
+// OutboundMessage.Media.
+func (m *Manager) SupportsMedia(name string) bool {
+	ch, ok := m.lookup(name)
+	if !ok {
+		return false
+	}
+	ms, ok := ch.(MediaSender)
+	return ok && ms.SupportsMedia()
+}
+
+// QueueDepths returns the number of buffered inbound and outbound messages.
+func (m *Manager) QueueDepths() (inbound, outbound int) {
+	return len(m.inbound), len(m.outbound)
+}
+
+// setState updates ch's status unless ch has since been unregistered or
+// replaced by a new instance with the same name.
+func (m *Manager) setState(ch Channel, state string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.channels[ch.Name()] != ch {
+		return
+	}
+	st := m.status[ch.Name()]
+	st.State = state
+	st.Since = time.Now()
+	if err != nil {
+		st.LastError = err.Error()
+	}
+}
+
+func (m *Manager) recordSend(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.status[name]
+	if !ok {
+		return
+	}
+	if err != nil {
+		st.Failed++
+		st.LastError = err.Error()
+		return
+	}
+	st.Sent++
+}
+
+func (m *Manager) lookup(name string) (Channel, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch, ok := m.channels[name]
+	return ch, ok
 }
 
 // Run starts all channels and dispatches outbound messages. Blocks until ctx is done.
 func (m *Manager) Run(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
 	for _, ch := range m.channels {
-		go func(c Channel) {
-			if err := c.Start(ctx); err != nil {
-				slog.Error("channel error", "channel", c.Name(), "err", err)
-			}
-		}(ch)
+		m.start(ch)
 	}
+	m.mu.Unlock()
 	for {
 		select {
 		case <-ctx.Done():
+			m.mu.Lock()
+			chans := make([]Channel, 0, len(m.channels))
 			for _, ch := range m.channels {
+				chans = append(chans, ch)
+			}
+			m.mu.Unlock()
+			for _, ch := range chans {
 				ch.Stop()
 			}
 			return
 		case msg := <-m.outbound:
-			ch, ok := m.channels[msg.Channel]
+			ch, ok := m.lookup(msg.Channel)
 			if !ok {
 				slog.Warn("unknown channel", "channel", msg.Channel)
 				continue
 			}
-			if err := ch.Send(msg); err != nil {
+			err := ch.Send(msg)
+			if err != nil {
 				slog.Error("send error", "channel", msg.Channel, "err", err)
 			}
+			m.recordSend(msg.Channel, err)
 		}
 	}
 }
@@ -2,6 +2,8 @@ package channel_test
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -55,3 +57,104 @@ func TestManagerRouteOutbound(t *testing.T) {
 		t.Errorf("expected message to be dispatched to mock channel, got %v", mock.sent)
 	}
 }
+
+type failingChannel struct{ mockChannel }
+
+func (f *failingChannel) Send(channel.OutboundMessage) error { return errors.New("boom") }
+
+func TestManagerStatus(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 4)
+	outbound := make(chan channel.OutboundMessage, 4)
+	mgr := channel.NewManager(inbound, outbound)
+	mgr.Register(&failingChannel{mockChannel{name: "slack"}})
+
+	if st := mgr.Status(); len(st) != 1 || st[0].State != channel.StateRegistered {
+		t.Fatalf("before Run: %+v", st)
+	}
+	inbound <- channel.InboundMessage{}
+	if in, _ := mgr.QueueDepths(); in != 1 {
+		t.Errorf("inbound depth = %d, want 1", in)
+	}
+
+	outbound <- channel.OutboundMessage{Channel: "slack", Text: "hi"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mgr.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	st := mgr.Status()[0]
+	// mockChannel.Start returns nil immediately, so the channel ends up stopped.
+	if st.State != channel.StateStopped || st.Failed != 1 || st.LastError != "boom" {
+		t.Errorf("after Run: %+v", st)
+	}
+}
+
+// blockingChannel runs until its context is cancelled.
+type blockingChannel struct {
+	mockChannel
+	stopped chan struct{}
+}
+
+func (b *blockingChannel) Start(ctx context.Context) error {
+	<-ctx.Done()
+	close(b.stopped)
+	return nil
+}
+
+func TestManagerRegisterWhileRunning(t *testing.T) {
+	mgr := channel.NewManager(make(chan channel.InboundMessage), make(chan channel.OutboundMessage))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mgr.Run(ctx)
+	time.Sleep(10 * time.Millisecond)
+
+	ch := &blockingChannel{mockChannel: mockChannel{name: "irc"}, stopped: make(chan struct{})}
+	mgr.Register(ch)
+	if st := mgr.Status(); len(st) != 1 || st[0].State != channel.StateRunning {
+		t.Fatalf("after Register: %+v", st)
+	}
+
+	mgr.Unregister("irc")
+	select {
+	case <-ch.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("unregistered channel was not cancelled")
+	}
+	if st := mgr.Status(); len(st) != 0 {
+		t.Errorf("after Unregister: %+v", st)
+	}
+}
+
+// connectorChannel runs until cancelled and reports a settable connection.
+type connectorChannel struct {
+	blockingChannel
+	up atomic.Bool
+}
+
+func (c *connectorChannel) Connected() bool { return c.up.Load() }
+
+func TestManagerStatusConnected(t *testing.T) {
+	mgr := channel.NewManager(make(chan channel.InboundMessage), make(chan channel.OutboundMessage))
+	ch := &connectorChannel{blockingChannel: blockingChannel{mockChannel: mockChannel{name: "irc"}, stopped: make(chan struct{})}}
+	mgr.Register(ch)
+	mgr.Register(&blockingChannel{mockChannel: mockChannel{name: "web"}, stopped: make(chan struct{})})
+	if st := mgr.Status(); st[0].Connected != nil {
+		t.Errorf("before Run: expected no connection state, got %+v", st[0])
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mgr.Run(ctx)
+	time.Sleep(10 * time.Millisecond)
+
+	st := mgr.Status()
+	if st[0].State != channel.StateRunning || st[0].Connected == nil || *st[0].Connected {
+		t.Errorf("running but not connected: %+v", st[0])
+	}
+	if st[1].Connected != nil {
+		t.Errorf("adapter without Connector: expected no connection state, got %+v", st[1])
+	}
+	ch.up.Store(true)
+	if st := mgr.Status(); st[0].Connected == nil || !*st[0].Connected {
+		t.Errorf("expected connected, got %+v", st[0])
+	}
+}
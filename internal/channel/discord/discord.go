@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -38,6 +42,7 @@ type Channel struct {
 	ws        *websocket.Conn
 	seq       int
 	botID     string
+	connected atomic.Bool // READY received on the current gateway connection
 }
 
 func New(token string, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
@@ -80,6 +85,7 @@ func (c *Channel) connect(ctx context.Context) error {
 		c.mu.Lock()
 		c.ws = nil
 		c.mu.Unlock()
+		c.connected.Store(false)
 	}()
 
 	for {
@@ -121,6 +127,7 @@ func (c *Channel) connect(ctx context.Context) error {
 				}
 				json.Unmarshal(p.D, &ready)
 				c.botID = ready.User.ID
+				c.connected.Store(true)
 				slog.Info("discord connected", "bot", ready.User.Username)
 			case "MESSAGE_CREATE":
 				c.handleMessage(p.D)
@@ -129,6 +136,9 @@ func (c *Channel) connect(ctx context.Context) error {
 	}
 }
 
+// Connected reports whether the gateway session is ready.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
 func (c *Channel) identify(conn *websocket.Conn) error {
 	data, _ := json.Marshal(map[string]any{
 		"op": 2,
@@ -171,7 +181,12 @@ func (c *Channel) handleMessage(d json.RawMessage) {
 			ID  string `json:"id"`
 			Bot bool   `json:"bot"`
 		} `json:"author"`
-		ChannelID string `json:"channel_id"`
+		ChannelID   string `json:"channel_id"`
+		Attachments []struct {
+			Filename string `json:"filename"`
+			URL      string `json:"url"`
+			Size     int64  `json:"size"`
+		} `json:"attachments"`
 	}
 	json.Unmarshal(d, &msg)
 
@@ -193,6 +208,9 @@ func (c *Channel) handleMessage(d json.RawMessage) {
 		Text:          msg.Content,
 		PreAuthorized: preAuthorized,
 	}
+	for _, a := range msg.Attachments {
+		inMsg.AddAttachment(a.Filename, func() (string, error) { return download(a.URL, a.Filename, a.Size) })
+	}
 	select {
 	case c.inbound <- inMsg:
 	default:
@@ -200,6 +218,19 @@ func (c *Channel) handleMessage(d json.RawMessage) {
 	}
 }
 
+// download fetches an attachment. Attachment URLs are signed CDN links; no
+// bot token is needed.
+func download(url, name string, size int64) (string, error) {
+	if size > channel.MaxUploadSize() {
+		return "", channel.ErrUploadTooLarge
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	return channel.FetchUpload(req, name)
+}
+
 func (c *Channel) Stop() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -209,7 +240,18 @@ func (c *Channel) Stop() error {
 	return nil
 }
 
+// SupportsMedia reports that Send uploads msg.Media as attachments.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
+	for _, path := range msg.Media {
+		if err := c.sendFile(msg.ChatID, path); err != nil {
+			return err
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	chunks := splitMessage(msg.Text, 2000)
 	for _, chunk := range chunks {
 		body, _ := json.Marshal(map[string]string{"content": chunk})
@@ -243,6 +285,40 @@ func (c *Channel) Send(msg channel.OutboundMessage) error {
 	return nil
 }
 
+// sendFile uploads path as a message attachment (multipart/form-data).
+func (c *Channel) sendFile(chatID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("discord: %w", err)
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("payload_json", `{"attachments":[{"id":0}]}`)
+	part, _ := w.CreateFormFile("files[0]", filepath.Base(path))
+	part.Write(data)
+	w.Close()
+
+	url := fmt.Sprintf("%s/channels/%s/messages", apiBase, chatID)
+	for attempt := 0; ; attempt++ {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(body.Bytes()))
+		req.Header.Set("Authorization", "Bot "+c.token)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == 429 && attempt == 0 {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("discord: upload failed with status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
 // CheckToken verifies the bot token by calling the Discord API.
 func CheckToken(token string) (string, error) {
 	req, _ := http.NewRequest("GET", apiBase+"/users/@me", nil)
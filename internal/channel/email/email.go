@@ -0,0 +1,535 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+// idleTimeout re-issues IDLE well inside the 29-minute limit of RFC 2177.
+const idleTimeout = 10 * time.Minute
+
+// pollInterval is how often a mailbox is checked on servers without IDLE.
+const pollInterval = 30 * time.Second
+
+// Options configures the mailbox that is watched and the SMTP relay used for
+// replies. Username and Password are used for both servers.
+type Options struct {
+	IMAPServer string // host:port
+	IMAPTLS    bool   // implicit TLS (usually port 993)
+	SMTPServer string // host:port
+	SMTPTLS    bool   // implicit TLS (usually port 465); otherwise STARTTLS when offered
+	Username   string
+	Password   string
+	Address    string // From address of replies; defaults to Username
+	Mailbox    string // defaults to INBOX
+
+	// The From header is trivially forged, so a sender must also be proven by
+	// at least one of these; every one that is set must pass.
+	AuthServID string // trust Authentication-Results added by this server (dkim or dmarc pass for the From domain)
+	Secret     string // shared secret that must appear in the subject or body
+}
+
+// thread remembers how to reply into a conversation.
+type thread struct {
+	to         string
+	subject    string
+	lastID     string   // Message-ID of the latest inbound message
+	references []string // References chain of the latest inbound message
+}
+
+// Channel is the email adapter. It watches an IMAP mailbox with IDLE and
+// replies over SMTP. Each conversation is keyed by the Message-ID of its first
+// message, which is used as ChatID.
+type Channel struct {
+	opts      Options
+	allowFrom map[string]bool
+	inbound   chan<- channel.InboundMessage
+
+	mu      sync.Mutex
+	conn    *imapConn
+	lastUID uint32 // highest UID already processed; 0 until the first SELECT
+	threads map[string]*thread
+
+	connected atomic.Bool // the mailbox is selected on the current connection
+}
+
+func New(opts Options, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	if opts.Address == "" {
+		opts.Address = opts.Username
+	}
+	if opts.Mailbox == "" {
+		opts.Mailbox = "INBOX"
+	}
+	allow := make(map[string]bool)
+	for _, addr := range allowFrom {
+		allow[strings.ToLower(addr)] = true
+	}
+	return &Channel{
+		opts:      opts,
+		allowFrom: allow,
+		inbound:   inbound,
+		threads:   make(map[string]*thread),
+	}
+}
+
+func (c *Channel) Name() string { return "email" }
+
+func (c *Channel) Start(ctx context.Context) error {
+	if c.opts.AuthServID == "" && c.opts.Secret == "" {
+		return fmt.Errorf("email: authserv_id or secret is required")
+	}
+	for {
+		if err := c.watch(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("email: imap error", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			slog.Debug("email: reconnecting...")
+		}
+	}
+}
+
+func (c *Channel) watch(ctx context.Context) error {
+	conn, err := dialIMAP(ctx, c.opts.IMAPServer, c.opts.IMAPTLS)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		conn.Close()
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		c.connected.Store(false)
+	}()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.login(c.opts.Username, c.opts.Password); err != nil {
+		return err
+	}
+	if err := conn.capabilities(); err != nil {
+		return err
+	}
+	uidNext, err := conn.selectMailbox(c.opts.Mailbox)
+	if err != nil {
+		return err
+	}
+	// On the first connection only mail arriving from now on is processed, so
+	// old commands sitting in the mailbox are never replayed.
+	if c.lastUID == 0 && uidNext > 0 {
+		c.lastUID = uidNext - 1
+	}
+	c.connected.Store(true)
+	slog.Info("email: watching mailbox", "server", c.opts.IMAPServer, "mailbox", c.opts.Mailbox, "idle", conn.caps["IDLE"])
+
+	for {
+		uids, err := conn.searchSince(c.lastUID)
+		if err != nil {
+			return err
+		}
+		for _, uid := range uids {
+			raw, err := conn.fetch(uid)
+			if err != nil {
+				return err
+			}
+			c.lastUID = uid
+			c.handleMessage(raw)
+			if err := conn.markSeen(uid); err != nil {
+				slog.Warn("email: could not mark message seen", "uid", uid, "err", err)
+			}
+		}
+		wait := idleTimeout
+		if !conn.caps["IDLE"] {
+			wait = pollInterval
+		}
+		if err := conn.idle(ctx, wait); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			conn.logout()
+			return nil
+		}
+	}
+}
+
+// Connected reports whether the mailbox is being watched.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
+func (c *Channel) handleMessage(raw []byte) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		slog.Warn("email: unparseable message", "err", err)
+		return
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return
+	}
+	sender := strings.ToLower(from.Address)
+	if sender == strings.ToLower(c.opts.Address) {
+		return // our own reply
+	}
+
+	if c.opts.AuthServID != "" && !authenticated(msg.Header, c.opts.AuthServID, domainOf(sender)) {
+		slog.Warn("email: ignoring message without a passing Authentication-Results", "from", sender)
+		return
+	}
+	subject := decodeHeader(msg.Header.Get("Subject"))
+	text := stripQuoted(plainText(msg))
+	if c.opts.Secret != "" {
+		if !strings.Contains(subject, c.opts.Secret) && !strings.Contains(text, c.opts.Secret) {
+			slog.Warn("email: ignoring message without the shared secret", "from", sender)
+			return
+		}
+		// The secret must not reach the pane, the history or the replies.
+		subject = strings.TrimSpace(strings.ReplaceAll(subject, c.opts.Secret, ""))
+		text = strings.TrimSpace(strings.ReplaceAll(text, c.opts.Secret, ""))
+	}
+
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[sender] {
+			slog.Debug("email: ignoring message from unauthorized sender", "from", sender)
+			return
+		}
+		preAuthorized = true
+	}
+
+	if text == "" {
+		return
+	}
+
+	msgID := msg.Header.Get("Message-Id")
+	refs := strings.Fields(msg.Header.Get("References"))
+	chatID := threadRoot(msgID, msg.Header.Get("In-Reply-To"), refs)
+	if chatID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.threads[chatID] = &thread{
+		to:         from.Address,
+		subject:    subject,
+		lastID:     msgID,
+		references: refs,
+	}
+	c.mu.Unlock()
+
+	inMsg := channel.InboundMessage{
+		Channel:       "email",
+		ChatID:        chatID,
+		SenderID:      sender,
+		Text:          text,
+		PreAuthorized: preAuthorized,
+	}
+	select {
+	case c.inbound <- inMsg:
+	default:
+		slog.Warn("email: inbound queue full, dropping message", "from", sender)
+	}
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	return nil
+}
+
+// Send replies into the thread identified by msg.ChatID. Threads are learned
+// from inbound mail, so only conversations seen since startup can be answered.
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	c.mu.Lock()
+	t, ok := c.threads[msg.ChatID]
+	var th thread
+	if ok {
+		th = *t
+	}
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("email: unknown thread %q", msg.ChatID)
+	}
+
+	subject := th.subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	refs := append(append([]string{}, th.references...), th.lastID)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", c.opts.Address)
+	fmt.Fprintf(&b, "To: %s\r\n", th.to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: %s\r\n", newMessageID(c.opts.Address))
+	fmt.Fprintf(&b, "In-Reply-To: %s\r\n", th.lastID)
+	fmt.Fprintf(&b, "References: %s\r\n", strings.Join(refs, " "))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n")))
+	qp.Close()
+
+	if err := sendMail(c.opts, th.to, b.Bytes()); err != nil {
+		return fmt.Errorf("email: send: %w", err)
+	}
+	return nil
+}
+
+func sendMail(opts Options, to string, body []byte) error {
+	client, err := dialSMTP(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Mail(opts.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func dialSMTP(opts Options) (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(opts.SMTPServer)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if opts.SMTPTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", opts.SMTPServer, &tls.Config{ServerName: host})
+	} else {
+		conn, err = net.DialTimeout("tcp", opts.SMTPServer, 30*time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !opts.SMTPTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+	if opts.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", opts.Username, opts.Password, host)); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+	return client, nil
+}
+
+// Check logs in to the IMAP server and authenticates against the SMTP server.
+func Check(opts Options) (string, error) {
+	if opts.Mailbox == "" {
+		opts.Mailbox = "INBOX"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := dialIMAP(ctx, opts.IMAPServer, opts.IMAPTLS)
+	if err != nil {
+		return "", fmt.Errorf("email: imap: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.login(opts.Username, opts.Password); err != nil {
+		return "", fmt.Errorf("email: imap: %w", err)
+	}
+	if _, err := conn.selectMailbox(opts.Mailbox); err != nil {
+		return "", fmt.Errorf("email: imap: %w", err)
+	}
+	conn.logout()
+
+	client, err := dialSMTP(opts)
+	if err != nil {
+		return "", fmt.Errorf("email: smtp: %w", err)
+	}
+	client.Quit()
+	return opts.Username, nil
+}
+
+// threadRoot returns the conversation key for a message: the first entry of
+// References, else In-Reply-To, else the message's own Message-ID.
+func threadRoot(msgID, inReplyTo string, refs []string) string {
+	root := msgID
+	if len(refs) > 0 {
+		root = refs[0]
+	} else if f := strings.Fields(inReplyTo); len(f) > 0 {
+		root = f[0]
+	}
+	return strings.Trim(root, "<>")
+}
+
+// authenticated reports whether the topmost Authentication-Results header
+// from authServID (RFC 8601) records a dmarc pass for domain, or a dkim pass
+// with a signing domain of domain. Headers of other servers, and any copies
+// further down that a sender may have forged, are ignored.
+func authenticated(h mail.Header, authServID, domain string) bool {
+	for _, v := range h["Authentication-Results"] {
+		v = arComment.ReplaceAllString(v, "")
+		parts := strings.Split(v, ";")
+		id := strings.Fields(parts[0])
+		if len(id) == 0 || !strings.EqualFold(id[0], authServID) {
+			continue
+		}
+		for _, res := range parts[1:] {
+			f := strings.Fields(res)
+			if len(f) == 0 {
+				continue
+			}
+			method, result, _ := strings.Cut(strings.ToLower(f[0]), "=")
+			if result != "pass" {
+				continue
+			}
+			for _, prop := range f[1:] {
+				k, v, _ := strings.Cut(prop, "=")
+				v = strings.ToLower(strings.Trim(v, `"`))
+				switch {
+				case method == "dmarc" && strings.EqualFold(k, "header.from") && v == domain,
+					method == "dkim" && strings.EqualFold(k, "header.d") && v == domain,
+					method == "dkim" && strings.EqualFold(k, "header.i") && domainOf(v) == domain:
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+var arComment = regexp.MustCompile(`\([^()]*\)`)
+
+// domainOf returns the part of address after the last "@", lowercased.
+func domainOf(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// plainText extracts the text/plain body of msg, descending into multipart
+// messages. HTML-only mail is reduced to its text content.
+func plainText(msg *mail.Message) string {
+	text, _ := partText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	return text
+}
+
+var htmlTag = regexp.MustCompile(`(?s)<[^>]*>`)
+
+func partText(contentType, encoding string, body io.Reader) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var htmlFallback string
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			text, isPlain := partText(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+			if isPlain && text != "" {
+				return text, true
+			}
+			if htmlFallback == "" {
+				htmlFallback = text
+			}
+		}
+		return htmlFallback, false
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", false
+	}
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, 1<<20))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if mediaType == "text/html" {
+		return htmlTag.ReplaceAllString(text, ""), false
+	}
+	return text, true
+}
+
+var attribution = regexp.MustCompile(`^On .+ wrote:$`)
+
+// stripQuoted keeps only the new part of a reply: everything before the quoted
+// history or the signature separator.
+func stripQuoted(text string) string {
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimRight(line, " \r")
+		if strings.HasPrefix(trimmed, ">") || attribution.MatchString(trimmed) || trimmed == "--" {
+			break
+		}
+		kept = append(kept, trimmed)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func decodeHeader(s string) string {
+	dec := new(mime.WordDecoder)
+	if out, err := dec.DecodeHeader(s); err == nil {
+		return out
+	}
+	return s
+}
+
+func newMessageID(address string) string {
+	domain := "im2code.local"
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		domain = address[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(b), time.Now().Unix(), domain)
+}
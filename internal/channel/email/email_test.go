@@ -0,0 +1,332 @@
+package email_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/email"
+)
+
+// fakeIMAP is an in-process IMAP stand-in holding one mailbox. Messages added
+// with deliver are announced to an idling client with an EXISTS response.
+type fakeIMAP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages map[uint32]string
+	next     uint32
+	notify   chan struct{}
+}
+
+func newFakeIMAP(t *testing.T) *fakeIMAP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeIMAP{ln: ln, messages: map[uint32]string{}, next: 1, notify: make(chan struct{}, 1)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeIMAP) deliver(raw string) {
+	f.mu.Lock()
+	f.messages[f.next] = raw
+	f.next++
+	f.mu.Unlock()
+	f.notify <- struct{}{}
+}
+
+func (f *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	send := func(format string, args ...any) { fmt.Fprintf(conn, format+"\r\n", args...) }
+	send("* OK [CAPABILITY IMAP4rev1 IDLE] fake ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(strings.TrimSpace(line))
+		tag, cmd := fields[0], strings.ToUpper(fields[1])
+		switch cmd {
+		case "LOGIN":
+			if fields[3] != `"pw"` {
+				send("%s NO bad credentials", tag)
+				continue
+			}
+			send("%s OK logged in", tag)
+		case "CAPABILITY":
+			send("* CAPABILITY IMAP4rev1 IDLE")
+			send("%s OK", tag)
+		case "SELECT":
+			f.mu.Lock()
+			send("* OK [UIDNEXT %d]", f.next)
+			f.mu.Unlock()
+			send("%s OK [READ-WRITE] selected", tag)
+		case "UID":
+			f.mu.Lock()
+			switch strings.ToUpper(fields[2]) {
+			case "SEARCH":
+				var from uint32
+				fmt.Sscanf(fields[4], "%d:*", &from)
+				var uids []string
+				for uid := range f.messages {
+					if uid >= from || uid == f.next-1 {
+						uids = append(uids, fmt.Sprint(uid))
+					}
+				}
+				send("* SEARCH %s", strings.Join(uids, " "))
+			case "FETCH":
+				var uid uint32
+				fmt.Sscan(fields[3], &uid)
+				raw := f.messages[uid]
+				fmt.Fprintf(conn, "* %d FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, uid, len(raw), raw)
+			}
+			f.mu.Unlock()
+			send("%s OK", tag)
+		case "IDLE":
+			send("+ idling")
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-f.notify:
+					send("* 1 EXISTS")
+				case <-done:
+				}
+			}()
+			r.ReadString('\n') // DONE
+			close(done)
+			send("%s OK idle done", tag)
+		case "LOGOUT":
+			send("* BYE")
+			send("%s OK", tag)
+			return
+		default:
+			send("%s BAD unknown command", tag)
+		}
+	}
+}
+
+// fakeSMTP accepts messages and hands each DATA payload to the test.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				send := func(s string) { conn.Write([]byte(s + "\r\n")) }
+				send("220 fake smtp")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+					case "EHLO", "HELO":
+						send("250-fake")
+						send("250 AUTH PLAIN")
+					case "AUTH":
+						send("235 ok")
+					case "MAIL", "RCPT":
+						send("250 ok")
+					case "DATA":
+						send("354 go ahead")
+						var b strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil || l == ".\r\n" {
+								break
+							}
+							b.WriteString(l)
+						}
+						out <- b.String()
+						send("250 queued")
+					case "QUIT":
+						send("221 bye")
+						return
+					default:
+						send("502 unsupported")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestEmail_InboundAndThreadedReply(t *testing.T) {
+	imapSrv := newFakeIMAP(t)
+	// Mail present before startup must not be replayed.
+	imapSrv.messages[1] = "From: alice@example.com\r\nMessage-ID: <old@example.com>\r\nSubject: old\r\n\r\nrm -rf /\r\n"
+	imapSrv.next = 2
+	smtpAddr, sent := fakeSMTP(t)
+
+	inbound := make(chan channel.InboundMessage, 4)
+	c := email.New(email.Options{
+		IMAPServer: imapSrv.ln.Addr().String(),
+		SMTPServer: smtpAddr,
+		Username:   "bot@example.com",
+		Password:   "pw",
+		AuthServID: "mx.example.com",
+	}, []string{"Alice@Example.com"}, inbound)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	time.Sleep(200 * time.Millisecond) // let the client reach IDLE
+	imapSrv.deliver("Authentication-Results: mx.example.com; dkim=pass header.d=example.com\r\n" +
+		"From: Alice <alice@example.com>\r\n" +
+		"Message-ID: <reply-2@example.com>\r\n" +
+		"In-Reply-To: <root-1@example.com>\r\n" +
+		"References: <root-1@example.com>\r\n" +
+		"Subject: Re: build box\r\n" +
+		"Content-Type: multipart/alternative; boundary=XX\r\n\r\n" +
+		"--XX\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"#snap\r\n\r\nOn Mon, Bob wrote:\r\n> earlier text\r\n" +
+		"--XX\r\nContent-Type: text/html\r\n\r\n<p>#snap</p>\r\n--XX--\r\n")
+
+	var msg channel.InboundMessage
+	select {
+	case msg = <-inbound:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+	if msg.ChatID != "root-1@example.com" || msg.SenderID != "alice@example.com" || msg.Text != "#snap" || !msg.PreAuthorized {
+		t.Errorf("unexpected inbound message: %+v", msg)
+	}
+
+	if err := c.Send(channel.OutboundMessage{Channel: "email", ChatID: msg.ChatID, Text: "Session: dev"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case data := <-sent:
+		for _, want := range []string{
+			"To: alice@example.com",
+			"Subject: Re: build box",
+			"In-Reply-To: <reply-2@example.com>",
+			"References: <root-1@example.com> <reply-2@example.com>",
+			"Session: dev",
+		} {
+			if !strings.Contains(data, want) {
+				t.Errorf("sent mail missing %q:\n%s", want, data)
+			}
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for SMTP delivery")
+	}
+
+	if err := c.Send(channel.OutboundMessage{Channel: "email", ChatID: "unknown@x", Text: "hi"}); err == nil {
+		t.Error("expected error for unknown thread")
+	}
+}
+
+func TestEmail_SenderAuthentication(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     email.Options
+		rejected []string // delivered first; none may arrive
+		accepted string
+		body     string
+	}{
+		{
+			name: "authserv_id",
+			opts: email.Options{AuthServID: "mx.example.com"},
+			rejected: []string{
+				"From: alice@example.com\r\n",
+				"Authentication-Results: mx.example.com; dkim=fail header.d=example.com\r\nFrom: alice@example.com\r\n",
+				"Authentication-Results: mx.example.com; dkim=pass header.d=evil.com\r\nFrom: alice@example.com\r\n",
+				"Authentication-Results: mx.evil.com; dmarc=pass header.from=example.com\r\nFrom: alice@example.com\r\n",
+				// A copy forged by the sender sits below the server's own.
+				"Authentication-Results: mx.example.com; spf=fail\r\nAuthentication-Results: mx.example.com; dmarc=pass header.from=example.com\r\nFrom: alice@example.com\r\n",
+			},
+			accepted: "Authentication-Results: MX.example.com 1; spf=pass; dmarc=pass (p=reject) header.from=example.com\r\nFrom: alice@example.com\r\n",
+			body:     "#snap",
+		},
+		{
+			name:     "secret",
+			opts:     email.Options{Secret: "s3cr3t"},
+			rejected: []string{"From: alice@example.com\r\nSubject: s3cr\r\n"},
+			accepted: "From: alice@example.com\r\nSubject: build s3cr3t\r\n",
+			body:     "#snap",
+		},
+		{
+			name:     "secret in body",
+			opts:     email.Options{Secret: "s3cr3t"},
+			accepted: "From: alice@example.com\r\n",
+			body:     "s3cr3t\r\n#snap",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			imapSrv := newFakeIMAP(t)
+			smtpAddr, _ := fakeSMTP(t)
+			opts := tc.opts
+			opts.IMAPServer, opts.SMTPServer = imapSrv.ln.Addr().String(), smtpAddr
+			opts.Username, opts.Password = "bot@example.com", "pw"
+			inbound := make(chan channel.InboundMessage, 8)
+			c := email.New(opts, nil, inbound)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Start(ctx)
+
+			time.Sleep(200 * time.Millisecond)
+			for i, h := range append(tc.rejected, tc.accepted) {
+				imapSrv.deliver(h + fmt.Sprintf("Message-ID: <m%d@example.com>\r\n\r\n", i) + tc.body + "\r\n")
+				time.Sleep(50 * time.Millisecond)
+			}
+			select {
+			case msg := <-inbound:
+				if msg.ChatID != fmt.Sprintf("m%d@example.com", len(tc.rejected)) || msg.Text != "#snap" {
+					t.Errorf("expected only the authenticated message, got %+v", msg)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("timed out waiting for the authenticated message")
+			}
+		})
+	}
+
+	c := email.New(email.Options{}, nil, nil)
+	if err := c.Start(context.Background()); err == nil {
+		t.Error("expected Start to refuse a config without authserv_id or secret")
+	}
+}
+
+func TestEmail_Check(t *testing.T) {
+	imapSrv := newFakeIMAP(t)
+	smtpAddr, _ := fakeSMTP(t)
+	opts := email.Options{IMAPServer: imapSrv.ln.Addr().String(), SMTPServer: smtpAddr, Username: "bot@example.com", Password: "pw"}
+	if _, err := email.Check(opts); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+	opts.Password = "wrong"
+	if _, err := email.Check(opts); err == nil {
+		t.Error("expected Check to fail with bad credentials")
+	}
+}
@@ -0,0 +1,273 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imapConn is a minimal IMAP4rev1 client covering the handful of commands the
+// adapter needs: LOGIN, SELECT, UID SEARCH/FETCH/STORE, IDLE and LOGOUT.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	caps map[string]bool
+
+	writeMu sync.Mutex
+}
+
+// response is one server response line. Literals ({n}) are removed from the
+// line and returned separately, in order.
+type response struct {
+	line     string
+	literals [][]byte
+}
+
+var (
+	literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+	uidNextRe = regexp.MustCompile(`\[UIDNEXT (\d+)\]`)
+	capRe     = regexp.MustCompile(`\[CAPABILITY ([^\]]*)\]`)
+)
+
+func dialIMAP(ctx context.Context, server string, useTLS bool) (*imapConn, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		host, _, _ := net.SplitHostPort(server)
+		td := &tls.Dialer{NetDialer: d, Config: &tls.Config{ServerName: host}}
+		conn, err = td.DialContext(ctx, "tcp", server)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn), caps: make(map[string]bool)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting: %s", greeting.line)
+	}
+	c.parseCaps(greeting.line)
+	return c, nil
+}
+
+func (c *imapConn) Close() error { return c.conn.Close() }
+
+func (c *imapConn) parseCaps(line string) {
+	if m := capRe.FindStringSubmatch(line); m != nil {
+		for _, name := range strings.Fields(m[1]) {
+			c.caps[strings.ToUpper(name)] = true
+		}
+	}
+}
+
+func (c *imapConn) readResponse() (response, error) {
+	var resp response
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m := literalRe.FindStringSubmatch(line)
+		if m == nil {
+			b.WriteString(line)
+			resp.line = b.String()
+			return resp, nil
+		}
+		n, _ := strconv.Atoi(m[1])
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, lit)
+		b.WriteString(strings.TrimSuffix(line, m[0]))
+	}
+}
+
+func (c *imapConn) write(line string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// cmd sends a tagged command and collects untagged responses until the tagged
+// completion. A NO or BAD completion is returned as an error.
+func (c *imapConn) cmd(format string, args ...any) ([]response, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if err := c.write(tag + " " + fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	return c.waitTagged(tag)
+}
+
+func (c *imapConn) waitTagged(tag string) ([]response, error) {
+	var untagged []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(resp.line, tag+" ") {
+			status := strings.TrimPrefix(resp.line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("imap: %s", status)
+			}
+			c.parseCaps(status)
+			return untagged, nil
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+func (c *imapConn) login(username, password string) error {
+	_, err := c.cmd("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+// capabilities refreshes the server capability list.
+func (c *imapConn) capabilities() error {
+	resps, err := c.cmd("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	for _, r := range resps {
+		if strings.HasPrefix(r.line, "* CAPABILITY ") {
+			for _, name := range strings.Fields(strings.TrimPrefix(r.line, "* CAPABILITY ")) {
+				c.caps[strings.ToUpper(name)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// selectMailbox opens mailbox and returns its UIDNEXT value.
+func (c *imapConn) selectMailbox(mailbox string) (uint32, error) {
+	resps, err := c.cmd("SELECT %s", quote(mailbox))
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range resps {
+		if m := uidNextRe.FindStringSubmatch(r.line); m != nil {
+			n, _ := strconv.ParseUint(m[1], 10, 32)
+			return uint32(n), nil
+		}
+	}
+	return 0, nil
+}
+
+// searchSince returns the UIDs greater than after, in ascending order.
+func (c *imapConn) searchSince(after uint32) ([]uint32, error) {
+	resps, err := c.cmd("UID SEARCH UID %d:*", after+1)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		if !strings.HasPrefix(r.line, "* SEARCH") {
+			continue
+		}
+		for _, f := range strings.Fields(strings.TrimPrefix(r.line, "* SEARCH")) {
+			n, err := strconv.ParseUint(f, 10, 32)
+			// "n:*" always matches the highest UID, even when it is below n.
+			if err == nil && uint32(n) > after {
+				uids = append(uids, uint32(n))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns the full RFC 5322 message for uid without setting \Seen.
+func (c *imapConn) fetch(uid uint32) ([]byte, error) {
+	resps, err := c.cmd("UID FETCH %d (BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resps {
+		if strings.Contains(r.line, "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("imap: message %d not returned", uid)
+}
+
+func (c *imapConn) markSeen(uid uint32) error {
+	_, err := c.cmd(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+// idle waits until the server reports a mailbox change or timeout elapses.
+// Servers without the IDLE extension are polled: idle simply sleeps.
+func (c *imapConn) idle(ctx context.Context, timeout time.Duration) error {
+	if !c.caps["IDLE"] {
+		select {
+		case <-ctx.Done():
+		case <-time.After(timeout):
+		}
+		return nil
+	}
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if err := c.write(tag + " IDLE"); err != nil {
+		return err
+	}
+	cont, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(cont.line, "+") {
+		return fmt.Errorf("imap: IDLE rejected: %s", cont.line)
+	}
+
+	var once sync.Once
+	done := func() { once.Do(func() { c.write("DONE") }) }
+	timer := time.AfterFunc(timeout, done)
+	defer timer.Stop()
+
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(resp.line, tag+" ") {
+			if !strings.HasPrefix(strings.TrimPrefix(resp.line, tag+" "), "OK") {
+				return fmt.Errorf("imap: %s", resp.line)
+			}
+			return nil
+		}
+		if strings.HasSuffix(resp.line, " EXISTS") || strings.HasSuffix(resp.line, " RECENT") {
+			done()
+		}
+	}
+}
+
+func (c *imapConn) logout() {
+	c.cmd("LOGOUT")
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
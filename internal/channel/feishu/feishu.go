@@ -1,11 +1,14 @@
 package feishu
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -86,12 +89,16 @@ func (c *Channel) onMessage(ctx context.Context, event *larkim.P2MessageReceiveV
 		chatID = *ev.Message.ChatId
 	}
 
-	// Extract text content. Feishu content is JSON: {"text":"..."}.
+	// Extract text content. Feishu content is JSON: {"text":"..."}, or
+	// {"image_key":"..."} / {"file_key":"...","file_name":"..."} for uploads.
 	var text string
+	var payload struct {
+		Text     string `json:"text"`
+		ImageKey string `json:"image_key"`
+		FileKey  string `json:"file_key"`
+		FileName string `json:"file_name"`
+	}
 	if ev.Message != nil && ev.Message.Content != nil {
-		var payload struct {
-			Text string `json:"text"`
-		}
 		if err := json.Unmarshal([]byte(*ev.Message.Content), &payload); err == nil {
 			text = payload.Text
 		} else {
@@ -106,6 +113,20 @@ func (c *Channel) onMessage(ctx context.Context, event *larkim.P2MessageReceiveV
 		Text:          text,
 		PreAuthorized: preAuthorized,
 	}
+	if ev.Message != nil && ev.Message.MessageId != nil {
+		messageID := *ev.Message.MessageId
+		switch {
+		case payload.FileKey != "":
+			msg.AddAttachment(payload.FileName, func() (string, error) {
+				return c.download(messageID, payload.FileKey, "file", payload.FileName)
+			})
+		case payload.ImageKey != "":
+			name := "image-" + payload.ImageKey // extension added by download
+			msg.AddAttachment(name, func() (string, error) {
+				return c.download(messageID, payload.ImageKey, "image", name)
+			})
+		}
+	}
 
 	select {
 	case c.inbound <- msg:
@@ -115,19 +136,55 @@ func (c *Channel) onMessage(ctx context.Context, event *larkim.P2MessageReceiveV
 	return nil
 }
 
+// download fetches a message's image or file resource.
+func (c *Channel) download(messageID, key, kind, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	resp, err := c.apiClient.Im.V1.MessageResource.Get(ctx, larkim.NewGetMessageResourceReqBuilder().
+		MessageId(messageID).
+		FileKey(key).
+		Type(kind).
+		Build())
+	if err != nil {
+		return "", err
+	}
+	if resp.Code != 0 {
+		return "", fmt.Errorf("feishu download error: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	r := bufio.NewReader(resp.File)
+	if kind == "image" {
+		head, _ := r.Peek(512)
+		switch http.DetectContentType(head) {
+		case "image/png":
+			name += ".png"
+		case "image/gif":
+			name += ".gif"
+		case "image/webp":
+			name += ".webp"
+		default:
+			name += ".jpg"
+		}
+	}
+	return channel.SaveUpload(name, r)
+}
+
 func (c *Channel) Stop() error {
 	// WebSocket client stops when its context is cancelled.
 	return nil
 }
 
 func (c *Channel) sendChunk(receiveID, content string) error {
+	return c.sendContent(receiveID, "text", content)
+}
+
+func (c *Channel) sendContent(receiveID, msgType, content string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	req := larkim.NewCreateMessageReqBuilder().
 		ReceiveIdType("chat_id").
 		Body(larkim.NewCreateMessageReqBodyBuilder().
 			ReceiveId(receiveID).
-			MsgType("text").
+			MsgType(msgType).
 			Content(content).
 			Build()).
 		Build()
@@ -141,10 +198,66 @@ func (c *Channel) sendChunk(receiveID, content string) error {
 	return nil
 }
 
+// sendFile uploads path — to the image store for images, the file store
+// otherwise — and posts it to receiveID.
+func (c *Channel) sendFile(receiveID, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if channel.IsImage(path) {
+		resp, err := c.apiClient.Im.V1.Image.Create(ctx, larkim.NewCreateImageReqBuilder().
+			Body(larkim.NewCreateImageReqBodyBuilder().
+				ImageType(larkim.ImageTypeMessage).
+				Image(f).
+				Build()).
+			Build())
+		if err != nil {
+			return err
+		}
+		if resp.Code != 0 {
+			return fmt.Errorf("feishu image upload error: code=%d msg=%s", resp.Code, resp.Msg)
+		}
+		content, _ := json.Marshal(map[string]string{"image_key": *resp.Data.ImageKey})
+		return c.sendContent(receiveID, "image", string(content))
+	}
+
+	resp, err := c.apiClient.Im.V1.File.Create(ctx, larkim.NewCreateFileReqBuilder().
+		Body(larkim.NewCreateFileReqBodyBuilder().
+			FileType(larkim.FileTypeStream).
+			FileName(filepath.Base(path)).
+			File(f).
+			Build()).
+		Build())
+	if err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("feishu file upload error: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	content, _ := json.Marshal(map[string]string{"file_key": *resp.Data.FileKey})
+	return c.sendContent(receiveID, "file", string(content))
+}
+
+// SupportsMedia reports that Send uploads msg.Media as images or files.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if c.apiClient == nil {
 		return fmt.Errorf("feishu: not started")
 	}
+	for _, path := range msg.Media {
+		if err := c.sendFile(msg.ChatID, path); err != nil {
+			return fmt.Errorf("feishu: upload: %w", err)
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	for _, chunk := range splitMessage(msg.Text, 4000) {
 		// JSON-encode the text to produce a valid Feishu content string.
 		contentBytes, err := json.Marshal(map[string]string{"text": chunk})
@@ -0,0 +1,483 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+const (
+	maxLineLen = 512 // RFC 1459 limit, including the trailing CRLF
+	// maxHostLen is the longest hostname a server may put in our prefix when
+	// relaying a PRIVMSG; it is reserved so relayed lines are never truncated.
+	maxHostLen = 63
+
+	floodBurst    = 5           // lines that may be sent back-to-back
+	floodInterval = time.Second // one more line allowed per interval after the burst
+	sendQueueSize = 512
+)
+
+// Options configures an IRC connection.
+type Options struct {
+	Server   string // host:port
+	TLS      bool
+	Nick     string
+	Username string // SASL account / USER name; defaults to Nick
+	Password string
+	Auth     string   // "sasl", "nickserv" or "" (no authentication)
+	Channels []string // channels to join on connect
+}
+
+// Channel is the IRC adapter. It joins the configured channels and also
+// accepts private queries. In channels only lines addressed to the bot
+// ("nick: text") are forwarded; queries are forwarded as-is.
+//
+// Nicks can be taken by anyone, so a sender is identified by the services
+// account the server reports in the IRCv3 account tag, or by the full
+// nick!user@host mask when the sender is not logged in or the server lacks
+// account-tag.
+type Channel struct {
+	opts      Options
+	allowFrom map[string]bool
+	inbound   chan<- channel.InboundMessage
+
+	mu    sync.Mutex
+	conn  net.Conn
+	nick  string // current nick (may differ from opts.Nick after a collision)
+	sendQ chan string
+
+	connected atomic.Bool // registration completed on the current connection
+}
+
+func New(opts Options, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	if opts.Username == "" {
+		opts.Username = opts.Nick
+	}
+	allow := make(map[string]bool)
+	for _, id := range allowFrom {
+		allow[strings.ToLower(id)] = true
+	}
+	return &Channel{
+		opts:      opts,
+		allowFrom: allow,
+		inbound:   inbound,
+		nick:      opts.Nick,
+		sendQ:     make(chan string, sendQueueSize),
+	}
+}
+
+func (c *Channel) Name() string { return "irc" }
+
+func (c *Channel) Start(ctx context.Context) error {
+	go c.writeLoop(ctx)
+	for {
+		if err := c.connect(ctx); err != nil {
+			slog.Error("irc connection error", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			slog.Debug("irc reconnecting...")
+		}
+	}
+}
+
+func dial(ctx context.Context, opts Options) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	if !opts.TLS {
+		return d.DialContext(ctx, "tcp", opts.Server)
+	}
+	host, _, _ := net.SplitHostPort(opts.Server)
+	td := &tls.Dialer{NetDialer: d, Config: &tls.Config{ServerName: host}}
+	return td.DialContext(ctx, "tcp", opts.Server)
+}
+
+func (c *Channel) connect(ctx context.Context) error {
+	conn, err := dial(ctx, c.opts)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.nick = c.opts.Nick
+	c.mu.Unlock()
+	defer func() {
+		conn.Close()
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		c.connected.Store(false)
+	}()
+
+	// Close the connection when ctx is cancelled so the blocking read returns.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	return c.session(conn, func() { c.connected.Store(true) })
+}
+
+// Connected reports whether the bot is registered on the server.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
+// session registers on conn and processes server lines until the connection
+// fails, calling onWelcome once registration (and SASL, if used) succeeded.
+// Protocol lines are written directly; only PRIVMSG output goes through the
+// rate-limited send queue.
+func (c *Channel) session(conn net.Conn, onWelcome func()) error {
+	c.writeNow(conn, "CAP REQ :account-tag")
+	if c.opts.Auth == "sasl" {
+		c.writeNow(conn, "CAP REQ :sasl")
+	}
+	if c.opts.Password != "" && c.opts.Auth == "" {
+		c.writeNow(conn, "PASS "+c.opts.Password)
+	}
+	c.writeNow(conn, "NICK "+c.opts.Nick)
+	c.writeNow(conn, fmt.Sprintf("USER %s 0 * :im2code", c.opts.Username))
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		msg := parseLine(line)
+
+		switch msg.command {
+		case "PING":
+			c.writeNow(conn, "PONG :"+msg.trailing())
+		case "CAP":
+			if len(msg.params) < 2 {
+				break
+			}
+			// account-tag is answered first; with SASL, CAP END follows
+			// authentication instead.
+			switch caps := msg.trailing(); {
+			case msg.params[1] == "ACK" && strings.Contains(caps, "sasl"):
+				c.writeNow(conn, "AUTHENTICATE PLAIN")
+			case msg.params[1] == "NAK" && strings.Contains(caps, "sasl"):
+				slog.Warn("irc: server does not support SASL")
+				c.writeNow(conn, "CAP END")
+			case strings.Contains(caps, "account-tag"):
+				if msg.params[1] == "NAK" {
+					slog.Warn("irc: server does not support account-tag; senders are identified by nick!user@host")
+				}
+				if c.opts.Auth != "sasl" {
+					c.writeNow(conn, "CAP END")
+				}
+			}
+		case "AUTHENTICATE":
+			if msg.trailing() == "+" {
+				creds := c.opts.Username + "\x00" + c.opts.Username + "\x00" + c.opts.Password
+				c.writeNow(conn, "AUTHENTICATE "+base64.StdEncoding.EncodeToString([]byte(creds)))
+			}
+		case "903": // RPL_SASLSUCCESS
+			slog.Debug("irc: SASL authentication succeeded")
+			c.writeNow(conn, "CAP END")
+		case "902", "904", "905", "906": // SASL failures
+			c.writeNow(conn, "CAP END")
+			return fmt.Errorf("irc: SASL authentication failed: %s", msg.trailing())
+		case "433": // ERR_NICKNAMEINUSE
+			c.mu.Lock()
+			c.nick += "_"
+			nick := c.nick
+			c.mu.Unlock()
+			c.writeNow(conn, "NICK "+nick)
+		case "001": // RPL_WELCOME
+			if len(msg.params) > 0 {
+				c.mu.Lock()
+				c.nick = msg.params[0]
+				c.mu.Unlock()
+			}
+			slog.Info("irc connected", "server", c.opts.Server, "nick", c.currentNick())
+			if c.opts.Auth == "nickserv" && c.opts.Password != "" {
+				c.writeNow(conn, "PRIVMSG NickServ :IDENTIFY "+c.opts.Username+" "+c.opts.Password)
+			}
+			for _, ch := range c.opts.Channels {
+				c.writeNow(conn, "JOIN "+ch)
+			}
+			onWelcome()
+		case "PRIVMSG":
+			c.handlePrivmsg(line)
+		case "ERROR":
+			return errors.New("irc: server closed link: " + msg.trailing())
+		}
+	}
+}
+
+func (c *Channel) currentNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+func (c *Channel) handlePrivmsg(line string) {
+	msg := parseLine(line)
+	if len(msg.params) < 2 {
+		return
+	}
+	sender := msg.sender()
+	target := msg.params[0]
+	text := msg.trailing()
+	if strings.HasPrefix(text, "\x01") {
+		return // CTCP (ACTION, VERSION, ...)
+	}
+
+	nick := c.currentNick()
+	chatID := target
+	if strings.EqualFold(target, nick) {
+		chatID = msg.nick() // private query: reply to the sender
+	} else {
+		// In channels only lines addressed to the bot are commands.
+		addressed := false
+		for _, sep := range []string{": ", ", ", ":", ","} {
+			if len(text) > len(nick)+len(sep) && strings.EqualFold(text[:len(nick)], nick) && strings.HasPrefix(text[len(nick):], sep) {
+				text = strings.TrimSpace(text[len(nick)+len(sep):])
+				addressed = true
+				break
+			}
+		}
+		if !addressed {
+			return
+		}
+	}
+
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[strings.ToLower(sender)] {
+			return
+		}
+		preAuthorized = true
+	}
+
+	inMsg := channel.InboundMessage{
+		Channel:       "irc",
+		ChatID:        chatID,
+		SenderID:      sender,
+		Text:          text,
+		PreAuthorized: preAuthorized,
+	}
+	select {
+	case c.inbound <- inMsg:
+	default:
+		slog.Warn("irc: inbound queue full, dropping message", "sender", sender)
+	}
+}
+
+func (c *Channel) writeNow(conn net.Conn, line string) {
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write([]byte(line + "\r\n")); err != nil {
+		slog.Debug("irc: write failed", "err", err)
+	}
+}
+
+// writeLoop drains the send queue with a token bucket so bursts of pane
+// output never trigger the server's flood protection.
+func (c *Channel) writeLoop(ctx context.Context) {
+	tokens := floodBurst
+	refill := time.NewTicker(floodInterval)
+	defer refill.Stop()
+	for {
+		if tokens == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refill.C:
+				tokens++
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-refill.C:
+			if tokens < floodBurst {
+				tokens++
+			}
+		case line := <-c.sendQ:
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			if conn == nil {
+				continue // disconnected: drop rather than replay stale output later
+			}
+			c.writeNow(conn, line)
+			tokens--
+		}
+	}
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.writeNow(c.conn, "QUIT :im2code shutting down")
+		c.conn.Close()
+	}
+	return nil
+}
+
+// Send queues msg as one or more PRIVMSG lines. Each output line becomes its
+// own PRIVMSG, split further so no line exceeds the 512-byte protocol limit.
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	c.mu.Lock()
+	connected := c.conn != nil
+	nick := c.nick
+	c.mu.Unlock()
+	if !connected {
+		return fmt.Errorf("irc: not connected")
+	}
+
+	// Reserve room for the prefix the server prepends when relaying.
+	overhead := len(fmt.Sprintf(":%s!~%s@%s PRIVMSG %s :\r\n",
+		nick, c.opts.Username, strings.Repeat("x", maxHostLen), msg.ChatID))
+	for _, part := range SplitLines(msg.Text, maxLineLen-overhead) {
+		select {
+		case c.sendQ <- "PRIVMSG " + msg.ChatID + " :" + part:
+		default:
+			return fmt.Errorf("irc: send queue full")
+		}
+	}
+	return nil
+}
+
+// SplitLines turns text into IRC-safe message bodies of at most maxBytes
+// bytes each. Code fences are dropped, blank lines are skipped (IRC cannot
+// carry empty messages) and long lines are split on UTF-8 boundaries.
+func SplitLines(text string, maxBytes int) []string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "```" {
+			continue
+		}
+		for len(line) > maxBytes {
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			out = append(out, line[:cut])
+			line = line[cut:]
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// Check connects, registers (authenticating if configured) and disconnects.
+// It returns the nick the server assigned.
+func Check(opts Options) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := dial(ctx, opts)
+	if err != nil {
+		return "", fmt.Errorf("irc: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	opts.Channels = nil
+	c := New(opts, nil, nil)
+	welcomed := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.session(conn, func() { close(welcomed) }) }()
+	select {
+	case <-welcomed:
+		c.writeNow(conn, "QUIT :im2code check")
+		return c.currentNick(), nil
+	case err := <-errCh:
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("irc: timed out waiting for registration")
+		}
+		return "", err
+	}
+}
+
+// message is a parsed IRC protocol line.
+type message struct {
+	tags    map[string]string // IRCv3 message tags
+	prefix  string
+	command string
+	params  []string
+}
+
+var tagEscapes = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+
+func parseLine(line string) message {
+	var m message
+	if strings.HasPrefix(line, "@") { // IRCv3 message tags
+		tags, rest, _ := strings.Cut(line[1:], " ")
+		m.tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ";") {
+			k, v, _ := strings.Cut(tag, "=")
+			m.tags[k] = tagEscapes.Replace(v)
+		}
+		line = rest
+	}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return m
+		}
+		m.prefix = line[1:i]
+		line = line[i+1:]
+	}
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			m.params = append(m.params, line)
+			break
+		}
+		if i > 0 {
+			m.params = append(m.params, line[:i])
+		}
+		line = line[i+1:]
+	}
+	if len(m.params) > 0 && m.command == "" {
+		m.command = strings.ToUpper(m.params[0])
+		m.params = m.params[1:]
+	}
+	return m
+}
+
+func (m message) trailing() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	return m.params[len(m.params)-1]
+}
+
+func (m message) nick() string {
+	if i := strings.IndexByte(m.prefix, '!'); i >= 0 {
+		return m.prefix[:i]
+	}
+	return m.prefix
+}
+
+// sender identifies who sent m: the services account from the account tag,
+// else the full nick!user@host prefix. The two cannot collide, as account
+// names never contain "!".
+func (m message) sender() string {
+	if account := m.tags["account"]; account != "" && account != "*" {
+		return account
+	}
+	return m.prefix
+}
@@ -0,0 +1,145 @@
+package irc_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/irc"
+)
+
+// fakeServer accepts one client, completes a SASL PLAIN registration and then
+// exposes the connection to the test.
+func fakeServer(t *testing.T, wantCreds string) (addr string, lines <-chan string, conn <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 256)
+	connCh := make(chan net.Conn, 1)
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { c.Close() })
+		r := bufio.NewReader(c)
+		send := func(s string) { c.Write([]byte(s + "\r\n")) }
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(out)
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case line == "CAP REQ :account-tag":
+				send(":srv CAP * ACK :account-tag")
+			case line == "CAP REQ :sasl":
+				send(":srv CAP * ACK :sasl")
+			case line == "AUTHENTICATE PLAIN":
+				send("AUTHENTICATE +")
+			case strings.HasPrefix(line, "AUTHENTICATE "):
+				creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTHENTICATE "))
+				if string(creds) == wantCreds {
+					send(":srv 903 bot :SASL authentication successful")
+				} else {
+					send(":srv 904 bot :SASL authentication failed")
+				}
+			case line == "CAP END":
+				send(":srv 001 bot :Welcome")
+				connCh <- c
+			default:
+				out <- line
+			}
+		}
+	}()
+	return ln.Addr().String(), out, connCh
+}
+
+func TestIRC_SASLQueryAndSplit(t *testing.T) {
+	addr, lines, connCh := fakeServer(t, "bot\x00bot\x00pw")
+	inbound := make(chan channel.InboundMessage, 4)
+	c := irc.New(irc.Options{Server: addr, Nick: "bot", Password: "pw", Auth: "sasl", Channels: []string{"#ops"}},
+		[]string{"Alice", "bob!b@example.org"}, inbound)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	var conn net.Conn
+	select {
+	case conn = <-connCh:
+	case <-time.After(3 * time.Second):
+		t.Fatal("registration did not complete")
+	}
+
+	// Unaddressed channel chatter is ignored; addressed lines and queries are
+	// forwarded. Senders are matched by account, or by full mask without one:
+	// the nick alice alone, or bob from another host, is not enough.
+	conn.Write([]byte("@account=alice :alice!a@host PRIVMSG #ops :just chatting\r\n"))
+	conn.Write([]byte(":alice!a@host PRIVMSG bot :#im2code\r\n"))
+	conn.Write([]byte("@account=* :bob!b@evil.example PRIVMSG bot :#im2code\r\n"))
+	conn.Write([]byte("@time=2026-01-01T00:00:00Z;account=alice :alice!a@host PRIVMSG #ops :bot: #status\r\n"))
+	conn.Write([]byte(":bob!b@example.org PRIVMSG bot :#im2code\r\n"))
+
+	want := []channel.InboundMessage{
+		{Channel: "irc", ChatID: "#ops", SenderID: "alice", Text: "#status"},
+		{Channel: "irc", ChatID: "bob", SenderID: "bob!b@example.org", Text: "#im2code"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-inbound:
+			if got.ChatID != w.ChatID || got.SenderID != w.SenderID || got.Text != w.Text || !got.PreAuthorized {
+				t.Errorf("inbound = %+v, want %+v", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w.Text)
+		}
+	}
+
+	long := strings.Repeat("é", 600) // 1200 bytes on one line
+	if err := c.Send(channel.OutboundMessage{Channel: "irc", ChatID: "alice", Text: "```\n" + long + "\n\nok\n```"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var got []string
+	deadline := time.After(3 * time.Second)
+	for len(got) < 4 {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "PRIVMSG alice :") {
+				got = append(got, strings.TrimPrefix(line, "PRIVMSG alice :"))
+			}
+		case <-deadline:
+			t.Fatalf("received %d PRIVMSG lines, want 4", len(got))
+		}
+	}
+	if got[3] != "ok" {
+		t.Errorf("last line = %q, want %q", got[3], "ok")
+	}
+	if joined := strings.Join(got[:3], ""); joined != long {
+		t.Error("split lines do not reassemble to the original text")
+	}
+	for _, l := range got {
+		// Relayed form: ":bot!~bot@<63-char host> PRIVMSG alice :" + body + CRLF.
+		if n := len(":bot!~bot@"+strings.Repeat("x", 63)+" PRIVMSG alice :\r\n") + len(l); n > 512 {
+			t.Errorf("relayed line would be %d bytes, exceeds 512", n)
+		}
+	}
+}
+
+func TestIRC_SplitLines(t *testing.T) {
+	got := irc.SplitLines("a\n\n```\nbcdef\n", 2)
+	want := []string{"a", "bc", "de", "f"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("SplitLines = %q, want %q", got, want)
+	}
+}
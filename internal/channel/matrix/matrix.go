@@ -0,0 +1,379 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+const (
+	syncTimeout = 30 * time.Second
+	maxMsgLen   = 16000
+)
+
+// event is the subset of a Matrix room event used by the adapter.
+type event struct {
+	Type     string          `json:"type"`
+	Sender   string          `json:"sender"`
+	EventID  string          `json:"event_id"`
+	StateKey *string         `json:"state_key"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []event `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Channel is the Matrix IM adapter. Uses client-server /sync long polling.
+// End-to-end encrypted rooms are not supported; encrypted events are skipped.
+type Channel struct {
+	homeserver string
+	userID     string
+	token      string
+	allowFrom  map[string]bool
+	inbound    chan<- channel.InboundMessage
+	client     *http.Client
+	txn        atomic.Int64
+	connected  atomic.Bool // the last /sync succeeded
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	warnedE2E map[string]bool // rooms already warned about encryption
+}
+
+func New(homeserver, userID, accessToken string, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	allow := make(map[string]bool)
+	for _, id := range allowFrom {
+		allow[id] = true
+	}
+	return &Channel{
+		homeserver: strings.TrimRight(homeserver, "/"),
+		userID:     userID,
+		token:      accessToken,
+		allowFrom:  allow,
+		inbound:    inbound,
+		client:     &http.Client{Timeout: syncTimeout + 30*time.Second},
+		warnedE2E:  make(map[string]bool),
+	}
+}
+
+func (c *Channel) Name() string { return "matrix" }
+
+// Connected reports whether the last sync with the homeserver succeeded.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
+func (c *Channel) Start(ctx context.Context) error {
+	innerCtx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	defer cancel()
+
+	// The first sync only establishes a position in the stream: timeline events
+	// from before startup are skipped so old commands are never replayed.
+	since := ""
+	for {
+		resp, err := c.sync(innerCtx, since)
+		if err != nil {
+			if innerCtx.Err() != nil {
+				return nil
+			}
+			c.connected.Store(false)
+			slog.Error("matrix sync error", "err", err)
+			select {
+			case <-innerCtx.Done():
+				return nil
+			case <-time.After(5 * time.Second):
+				slog.Debug("matrix resyncing...")
+			}
+			continue
+		}
+		if since == "" {
+			slog.Info("matrix connected", "user", c.userID)
+		}
+		c.connected.Store(true)
+		c.handleSync(innerCtx, resp, since == "")
+		since = resp.NextBatch
+	}
+}
+
+func (c *Channel) sync(ctx context.Context, since string) (*syncResponse, error) {
+	q := url.Values{}
+	if since != "" {
+		q.Set("since", since)
+		q.Set("timeout", strconv.Itoa(int(syncTimeout/time.Millisecond)))
+	} else {
+		q.Set("timeout", "0")
+	}
+	var resp syncResponse
+	if err := c.do(ctx, "GET", "/_matrix/client/v3/sync?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Channel) handleSync(ctx context.Context, resp *syncResponse, initial bool) {
+	for roomID, room := range resp.Rooms.Invite {
+		c.handleInvite(ctx, roomID, room.InviteState.Events)
+	}
+	if initial {
+		return
+	}
+	for roomID, room := range resp.Rooms.Join {
+		for _, ev := range room.Timeline.Events {
+			c.handleEvent(roomID, ev)
+		}
+	}
+}
+
+// handleInvite joins rooms the bot was invited to. With allow_from set, only
+// invites sent by an allowed user are accepted.
+func (c *Channel) handleInvite(ctx context.Context, roomID string, events []event) {
+	inviter := ""
+	for _, ev := range events {
+		if ev.Type == "m.room.member" && ev.StateKey != nil && *ev.StateKey == c.userID {
+			inviter = ev.Sender
+		}
+	}
+	if len(c.allowFrom) > 0 && !c.allowFrom[inviter] {
+		slog.Debug("matrix: ignoring invite from unauthorized user", "room", roomID, "inviter", inviter)
+		return
+	}
+	if err := c.do(ctx, "POST", "/_matrix/client/v3/join/"+url.PathEscape(roomID), map[string]any{}, nil); err != nil {
+		slog.Warn("matrix: join failed", "room", roomID, "err", err)
+		return
+	}
+	slog.Info("matrix: joined room", "room", roomID, "inviter", inviter)
+}
+
+func (c *Channel) handleEvent(roomID string, ev event) {
+	if ev.Sender == c.userID {
+		return
+	}
+	switch ev.Type {
+	case "m.room.encrypted":
+		c.mu.Lock()
+		warned := c.warnedE2E[roomID]
+		c.warnedE2E[roomID] = true
+		c.mu.Unlock()
+		if !warned {
+			slog.Warn("matrix: encrypted rooms are not supported; disable encryption for this room", "room", roomID)
+		}
+		return
+	case "m.room.message":
+	default:
+		return
+	}
+
+	var content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	}
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return
+	}
+	// m.notice is reserved for automated senders; never treat it as input.
+	if content.MsgType != "m.text" || content.Body == "" {
+		return
+	}
+
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[ev.Sender] {
+			return
+		}
+		preAuthorized = true
+	}
+
+	inMsg := channel.InboundMessage{
+		Channel:       "matrix",
+		ChatID:        roomID,
+		SenderID:      ev.Sender,
+		Text:          content.Body,
+		PreAuthorized: preAuthorized,
+	}
+	select {
+	case c.inbound <- inMsg:
+	default:
+		slog.Warn("matrix: inbound queue full, dropping message", "room", roomID)
+	}
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
+
+// Send posts msg as m.notice events. Fenced ``` blocks (pane captures) are
+// additionally rendered as <pre><code> in the HTML formatted body.
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	for _, chunk := range splitMessage(msg.Text, maxMsgLen) {
+		content := map[string]string{
+			"msgtype": "m.notice",
+			"body":    chunk,
+		}
+		if strings.Contains(chunk, "```") {
+			content["format"] = "org.matrix.custom.html"
+			content["formatted_body"] = formatHTML(chunk)
+		}
+		txnID := fmt.Sprintf("im2code-%d-%d", time.Now().UnixNano(), c.txn.Add(1))
+		path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+			url.PathEscape(msg.ChatID), url.PathEscape(txnID))
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := c.do(ctx, "PUT", path, content, nil)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("matrix: send: %w", err)
+		}
+	}
+	return nil
+}
+
+// do performs an authenticated client-server API call. A 429 response is
+// retried once after the server-supplied retry_after_ms.
+func (c *Channel) do(ctx context.Context, method, path string, body, out any) error {
+	return doRequest(ctx, c.client, c.homeserver, c.token, method, path, body, out, true)
+}
+
+func doRequest(ctx context.Context, client *http.Client, homeserver, token, method, path string, body, out any, retry bool) error {
+	var reader io.Reader
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, homeserver+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var merr struct {
+			ErrCode      string `json:"errcode"`
+			Error        string `json:"error"`
+			RetryAfterMs int    `json:"retry_after_ms"`
+		}
+		json.NewDecoder(resp.Body).Decode(&merr)
+		if resp.StatusCode == http.StatusTooManyRequests && retry {
+			wait := time.Duration(merr.RetryAfterMs) * time.Millisecond
+			if wait <= 0 {
+				wait = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			return doRequest(ctx, client, homeserver, token, method, path, body, out, false)
+		}
+		if merr.ErrCode != "" {
+			return fmt.Errorf("%s: %s (status %d)", merr.ErrCode, merr.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// CheckToken verifies the access token via /account/whoami and returns the
+// user ID it belongs to.
+func CheckToken(homeserver, accessToken string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var who struct {
+		UserID string `json:"user_id"`
+	}
+	err := doRequest(ctx, http.DefaultClient, strings.TrimRight(homeserver, "/"), accessToken,
+		"GET", "/_matrix/client/v3/account/whoami", nil, &who, false)
+	if err != nil {
+		return "", fmt.Errorf("matrix: %w", err)
+	}
+	return who.UserID, nil
+}
+
+// formatHTML converts text with ``` fences into Matrix HTML: fenced blocks
+// become <pre><code>, the rest is escaped with line breaks preserved.
+func formatHTML(text string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(text, "```") {
+		if i%2 == 1 {
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.TrimPrefix(part, "\n")))
+			b.WriteString("</code></pre>")
+			continue
+		}
+		b.WriteString(strings.ReplaceAll(html.EscapeString(part), "\n", "<br>"))
+	}
+	return b.String()
+}
+
+// splitMessage splits text into chunks of at most maxLen bytes, at line
+// breaks where possible; a line longer than maxLen is cut on a UTF-8 boundary.
+func splitMessage(text string, maxLen int) []string {
+	if len(text) <= maxLen {
+		return []string{text}
+	}
+	var chunks []string
+	lines := strings.Split(text, "\n")
+	var cur strings.Builder
+	for _, line := range lines {
+		if cur.Len() > 0 && cur.Len()+len(line)+1 > maxLen {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		for len(line)+1 > maxLen {
+			cut := min(maxLen, len(line)-1)
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		cur.WriteString(line + "\n")
+	}
+	if cur.Len() > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
@@ -0,0 +1,190 @@
+package matrix_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/matrix"
+)
+
+// fakeHomeserver serves a scripted sequence of /sync responses and records
+// joins and sent events.
+type fakeHomeserver struct {
+	mu     sync.Mutex
+	syncs  []string // JSON bodies returned in order; afterwards sync blocks
+	joined []string
+	sent   []map[string]string
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`))
+		return
+	}
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/_matrix/client/v3/account/whoami":
+		w.Write([]byte(`{"user_id":"@bot:hs"}`))
+	case path == "/_matrix/client/v3/sync":
+		f.mu.Lock()
+		if len(f.syncs) == 0 {
+			f.mu.Unlock()
+			<-r.Context().Done()
+			return
+		}
+		body := f.syncs[0]
+		f.syncs = f.syncs[1:]
+		f.mu.Unlock()
+		w.Write([]byte(body))
+	case strings.HasPrefix(path, "/_matrix/client/v3/join/"):
+		f.mu.Lock()
+		f.joined = append(f.joined, strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/join/"))
+		f.mu.Unlock()
+		w.Write([]byte(`{}`))
+	case strings.Contains(path, "/send/m.room.message/"):
+		var content map[string]string
+		json.NewDecoder(r.Body).Decode(&content)
+		f.mu.Lock()
+		f.sent = append(f.sent, content)
+		f.mu.Unlock()
+		w.Write([]byte(`{"event_id":"$sent"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMatrix_SyncJoinAndSend(t *testing.T) {
+	hs := &fakeHomeserver{syncs: []string{
+		// Initial sync: backlog message must be skipped, invite accepted.
+		`{"next_batch":"s1","rooms":{
+			"join":{"!old:hs":{"timeline":{"events":[
+				{"type":"m.room.message","sender":"@alice:hs","content":{"msgtype":"m.text","body":"stale"}}]}}},
+			"invite":{"!room:hs":{"invite_state":{"events":[
+				{"type":"m.room.member","sender":"@alice:hs","state_key":"@bot:hs","content":{"membership":"invite"}}]}}}}}`,
+		`{"next_batch":"s2","rooms":{"join":{"!room:hs":{"timeline":{"events":[
+			{"type":"m.room.message","sender":"@bot:hs","content":{"msgtype":"m.notice","body":"own echo"}},
+			{"type":"m.room.encrypted","sender":"@alice:hs","content":{}},
+			{"type":"m.room.message","sender":"@alice:hs","content":{"msgtype":"m.text","body":"#im2code"}}]}}}}}`,
+	}}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	inbound := make(chan channel.InboundMessage, 4)
+	c := matrix.New(srv.URL, "@bot:hs", "tok", nil, inbound)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	select {
+	case msg := <-inbound:
+		if msg.ChatID != "!room:hs" || msg.SenderID != "@alice:hs" || msg.Text != "#im2code" || msg.PreAuthorized {
+			t.Errorf("unexpected inbound message: %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+	select {
+	case msg := <-inbound:
+		t.Errorf("unexpected extra inbound message: %+v", msg)
+	default:
+	}
+
+	if err := c.Send(channel.OutboundMessage{Channel: "matrix", ChatID: "!room:hs", Text: "```\n$ ls\n```"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.joined) != 1 || hs.joined[0] != "!room:hs" {
+		t.Errorf("joined = %v, want [!room:hs]", hs.joined)
+	}
+	if len(hs.sent) != 1 {
+		t.Fatalf("sent %d events, want 1", len(hs.sent))
+	}
+	got := hs.sent[0]
+	if got["msgtype"] != "m.notice" || got["format"] != "org.matrix.custom.html" {
+		t.Errorf("unexpected content: %v", got)
+	}
+	if got["formatted_body"] != "<pre><code>$ ls\n</code></pre>" {
+		t.Errorf("formatted_body = %q", got["formatted_body"])
+	}
+}
+
+func TestMatrix_CheckToken(t *testing.T) {
+	srv := httptest.NewServer(&fakeHomeserver{})
+	defer srv.Close()
+
+	user, err := matrix.CheckToken(srv.URL, "tok")
+	if err != nil || user != "@bot:hs" {
+		t.Errorf("CheckToken = %q, %v; want @bot:hs", user, err)
+	}
+	if _, err := matrix.CheckToken(srv.URL, "wrong"); err == nil {
+		t.Error("expected error for invalid token")
+	}
+}
+
+func TestMatrix_SplitLongLine(t *testing.T) {
+	hs := &fakeHomeserver{}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+	c := matrix.New(srv.URL, "@bot:hs", "tok", nil, make(chan channel.InboundMessage))
+
+	// A line longer than an event is cut; shorter lines are kept whole.
+	long := strings.Repeat("é", 10000) // 20000 bytes
+	text := "first\n" + long + "\nlast"
+	if err := c.Send(channel.OutboundMessage{Channel: "matrix", ChatID: "!room:hs", Text: text}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.sent) < 2 {
+		t.Fatalf("expected the text to be split, got %d events", len(hs.sent))
+	}
+	var joined strings.Builder
+	for _, e := range hs.sent {
+		if len(e["body"]) > 16000 {
+			t.Errorf("event of %d bytes exceeds the limit", len(e["body"]))
+		}
+		joined.WriteString(e["body"])
+	}
+	if got := strings.ReplaceAll(joined.String(), "\n", ""); got != "first"+long+"last" {
+		t.Error("events do not reassemble to the original text")
+	}
+	if !strings.HasPrefix(hs.sent[0]["body"], "first\n") {
+		t.Errorf("expected the first line to lead the first event, got %.20q", hs.sent[0]["body"])
+	}
+}
+
+func TestMatrix_SplitAtLimit(t *testing.T) {
+	for _, n := range []int{15999, 16000} {
+		hs := &fakeHomeserver{}
+		srv := httptest.NewServer(hs)
+		c := matrix.New(srv.URL, "@bot:hs", "tok", nil, make(chan channel.InboundMessage))
+
+		line := strings.Repeat("x", n)
+		if err := c.Send(channel.OutboundMessage{Channel: "matrix", ChatID: "!room:hs", Text: "first\n" + line}); err != nil {
+			t.Fatalf("%d bytes: Send: %v", n, err)
+		}
+		hs.mu.Lock()
+		var joined strings.Builder
+		for _, e := range hs.sent {
+			if len(e["body"]) > 16000 {
+				t.Errorf("%d bytes: event of %d bytes exceeds the limit", n, len(e["body"]))
+			}
+			joined.WriteString(e["body"])
+		}
+		if got := strings.ReplaceAll(joined.String(), "\n", ""); got != "first"+line {
+			t.Errorf("%d bytes: events do not reassemble to the original text", n)
+		}
+		hs.mu.Unlock()
+		srv.Close()
+	}
+}
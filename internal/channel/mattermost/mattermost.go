@@ -0,0 +1,321 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+const maxMsgLen = 16000 // Mattermost rejects posts over 16383 characters
+
+type post struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
+	Message   string `json:"message"`
+	Type      string `json:"type"` // non-empty for system messages
+}
+
+// Channel is the Mattermost IM adapter. Receives "posted" events over the
+// /api/v4/websocket stream and replies through the REST /api/v4/posts API.
+//
+// ChatID is the channel ID for top-level posts and "channelID/rootID" for
+// thread replies, so responses land in the same thread.
+type Channel struct {
+	serverURL string
+	token     string
+	allowFrom map[string]bool
+	inbound   chan<- channel.InboundMessage
+	client    *http.Client
+
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	ws      *websocket.Conn
+	botID   string
+
+	connected atomic.Bool // the websocket is authenticated
+}
+
+func New(serverURL, token string, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	allow := make(map[string]bool)
+	for _, id := range allowFrom {
+		allow[id] = true
+	}
+	return &Channel{
+		serverURL: strings.TrimRight(serverURL, "/"),
+		token:     token,
+		allowFrom: allow,
+		inbound:   inbound,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Channel) Name() string { return "mattermost" }
+
+func (c *Channel) Start(ctx context.Context) error {
+	for {
+		if err := c.connect(ctx); err != nil {
+			slog.Error("mattermost connection error", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			slog.Debug("mattermost reconnecting...")
+		}
+	}
+}
+
+func (c *Channel) connect(ctx context.Context) error {
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := c.api(ctx, "GET", "/api/v4/users/me", nil, &me); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.botID = me.ID
+	c.mu.Unlock()
+
+	wsURL, err := websocketURL(c.serverURL)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.token)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.ws = conn
+	c.mu.Unlock()
+	defer func() {
+		conn.Close()
+		c.mu.Lock()
+		c.ws = nil
+		c.mu.Unlock()
+		c.connected.Store(false)
+	}()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// The Authorization header is enough for most servers; the challenge
+	// covers deployments whose proxies strip headers on upgrade.
+	c.writeMu.Lock()
+	err = conn.WriteJSON(map[string]any{
+		"seq":    1,
+		"action": "authentication_challenge",
+		"data":   map[string]string{"token": c.token},
+	})
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	c.connected.Store(true)
+	slog.Info("mattermost connected", "bot", me.Username)
+
+	for {
+		var evt struct {
+			Event string `json:"event"`
+			Data  struct {
+				Post        string `json:"post"` // JSON-encoded post
+				ChannelType string `json:"channel_type"`
+			} `json:"data"`
+		}
+		if err := conn.ReadJSON(&evt); err != nil {
+			return err
+		}
+		if evt.Event != "posted" {
+			continue
+		}
+		var p post
+		if err := json.Unmarshal([]byte(evt.Data.Post), &p); err != nil {
+			continue
+		}
+		c.handlePost(p, evt.Data.ChannelType)
+	}
+}
+
+// Connected reports whether the event stream is up.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
+func (c *Channel) handlePost(p post, channelType string) {
+	c.mu.Lock()
+	botID := c.botID
+	c.mu.Unlock()
+	if p.UserID == botID || p.Type != "" || p.Message == "" {
+		return
+	}
+	// Only user IDs are matched: a channel ID would authorize everyone who
+	// can post in the channel, including members added later.
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[p.UserID] {
+			return
+		}
+		preAuthorized = true
+	}
+
+	chatID := p.ChannelID
+	if p.RootID != "" {
+		chatID += "/" + p.RootID
+	}
+	slog.Debug("mattermost: post", "chatID", chatID, "channelType", channelType, "user", p.UserID)
+
+	inMsg := channel.InboundMessage{
+		Channel:       "mattermost",
+		ChatID:        chatID,
+		SenderID:      p.UserID,
+		Text:          p.Message,
+		PreAuthorized: preAuthorized,
+	}
+	select {
+	case c.inbound <- inMsg:
+	default:
+		slog.Warn("mattermost: inbound queue full, dropping message", "chatID", chatID)
+	}
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ws != nil {
+		c.ws.Close()
+	}
+	return nil
+}
+
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	channelID, rootID, _ := strings.Cut(msg.ChatID, "/")
+	for _, chunk := range splitMessage(msg.Text, maxMsgLen) {
+		body := map[string]string{"channel_id": channelID, "message": chunk}
+		if rootID != "" {
+			body["root_id"] = rootID
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := c.api(ctx, "POST", "/api/v4/posts", body, nil)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("mattermost: send: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Channel) api(ctx context.Context, method, path string, body, out any) error {
+	return apiRequest(ctx, c.client, c.serverURL, c.token, method, path, body, out)
+}
+
+func apiRequest(ctx context.Context, client *http.Client, serverURL, token, method, path string, body, out any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, serverURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message != "" {
+			return fmt.Errorf("%s (status %d)", apiErr.Message, resp.StatusCode)
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func websocketURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("mattermost: invalid server URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("mattermost: server URL must start with http:// or https://")
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v4/websocket"
+	return u.String(), nil
+}
+
+// CheckToken verifies the personal access token and returns the bot username.
+func CheckToken(serverURL, token string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var me struct {
+		Username string `json:"username"`
+	}
+	err := apiRequest(ctx, http.DefaultClient, strings.TrimRight(serverURL, "/"), token, "GET", "/api/v4/users/me", nil, &me)
+	if err != nil {
+		return "", fmt.Errorf("mattermost: %w", err)
+	}
+	return "@" + me.Username, nil
+}
+
+// splitMessage splits text into chunks of at most maxLen bytes, at line
+// breaks where possible; a line longer than maxLen is cut on a UTF-8 boundary.
+func splitMessage(text string, maxLen int) []string {
+	if len(text) <= maxLen {
+		return []string{text}
+	}
+	var chunks []string
+	lines := strings.Split(text, "\n")
+	var cur strings.Builder
+	for _, line := range lines {
+		if cur.Len() > 0 && cur.Len()+len(line)+1 > maxLen {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		for len(line)+1 > maxLen {
+			cut := min(maxLen, len(line)-1)
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		cur.WriteString(line + "\n")
+	}
+	if cur.Len() > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
@@ -0,0 +1,157 @@
+package mattermost_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/mattermost"
+)
+
+// fakeServer pushes the posts given to it as "posted" events over the
+// websocket and records the bodies of created posts.
+type fakeServer struct {
+	posts chan map[string]string // pushed to the client
+
+	mu      sync.Mutex
+	created []map[string]string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"bad token"}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/api/v4/users/me":
+		w.Write([]byte(`{"id":"bot","username":"im2code"}`))
+	case "/api/v4/websocket":
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var challenge map[string]any
+		conn.ReadJSON(&challenge)
+		for {
+			select {
+			case p := <-f.posts:
+				data, _ := json.Marshal(p)
+				conn.WriteJSON(map[string]any{
+					"event": "posted",
+					"data":  map[string]string{"post": string(data), "channel_type": "O"},
+				})
+			case <-r.Context().Done():
+				return
+			}
+		}
+	case "/api/v4/posts":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.created = append(f.created, body)
+		f.mu.Unlock()
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMattermost_AllowFromAndSplit(t *testing.T) {
+	f := &fakeServer{posts: make(chan map[string]string, 8)}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	inbound := make(chan channel.InboundMessage, 8)
+	// C1 is a channel ID: it must not let its members in.
+	c := mattermost.New(srv.URL, "tok", []string{"alice", "C1"}, inbound)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	for _, p := range []map[string]string{
+		{"user_id": "mallory", "channel_id": "C1", "message": "#im2code"},
+		{"user_id": "bot", "channel_id": "C1", "message": "own echo"},
+		{"user_id": "alice", "channel_id": "C1", "message": "joined", "type": "system_join_channel"},
+		{"user_id": "alice", "channel_id": "C1", "message": ""},
+		{"user_id": "alice", "channel_id": "C1", "root_id": "R1", "message": "#snap"},
+	} {
+		f.posts <- p
+	}
+	select {
+	case msg := <-inbound:
+		if msg.ChatID != "C1/R1" || msg.SenderID != "alice" || msg.Text != "#snap" || !msg.PreAuthorized {
+			t.Errorf("unexpected inbound message: %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+	select {
+	case msg := <-inbound:
+		t.Errorf("unexpected extra inbound message: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A line longer than a post is cut; shorter lines are kept whole.
+	long := strings.Repeat("é", 10000) // 20000 bytes
+	text := "first\n" + long + "\nlast"
+	if err := c.Send(channel.OutboundMessage{Channel: "mattermost", ChatID: "C1/R1", Text: text}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.created) < 2 {
+		t.Fatalf("expected the text to be split, got %d posts", len(f.created))
+	}
+	var joined strings.Builder
+	for _, p := range f.created {
+		if p["channel_id"] != "C1" || p["root_id"] != "R1" {
+			t.Errorf("post not in the thread: %v", p)
+		}
+		if len(p["message"]) > 16000 {
+			t.Errorf("post of %d bytes exceeds the limit", len(p["message"]))
+		}
+		joined.WriteString(p["message"])
+	}
+	if got := strings.ReplaceAll(joined.String(), "\n", ""); got != "first"+long+"last" {
+		t.Error("posts do not reassemble to the original text")
+	}
+	if !strings.HasPrefix(f.created[0]["message"], "first\n") {
+		t.Errorf("expected the first line to lead the first post, got %.20q", f.created[0]["message"])
+	}
+}
+
+func TestMattermost_SplitAtLimit(t *testing.T) {
+	for _, n := range []int{15999, 16000} {
+		f := &fakeServer{}
+		srv := httptest.NewServer(f)
+		c := mattermost.New(srv.URL, "tok", nil, make(chan channel.InboundMessage))
+
+		line := strings.Repeat("x", n)
+		if err := c.Send(channel.OutboundMessage{Channel: "mattermost", ChatID: "C1", Text: "first\n" + line}); err != nil {
+			t.Fatalf("%d bytes: Send: %v", n, err)
+		}
+		f.mu.Lock()
+		var joined strings.Builder
+		for _, p := range f.created {
+			if len(p["message"]) > 16000 {
+				t.Errorf("%d bytes: post of %d bytes exceeds the limit", n, len(p["message"]))
+			}
+			joined.WriteString(p["message"])
+		}
+		if got := strings.ReplaceAll(joined.String(), "\n", ""); got != "first"+line {
+			t.Errorf("%d bytes: posts do not reassemble to the original text", n)
+		}
+		f.mu.Unlock()
+		srv.Close()
+	}
+}
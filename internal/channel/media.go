@@ -0,0 +1,165 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IsImage reports whether path names an image that IM platforms display
+// inline (PNG, JPEG, GIF or WebP). Other media are sent as documents.
+func IsImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+// DefaultMaxUploadSize is the inbound file size limit unless configured.
+const DefaultMaxUploadSize = 20 << 20
+
+// ErrUploadTooLarge is reported for inbound files over MaxUploadSize.
+var ErrUploadTooLarge = errors.New("file exceeds the upload size limit")
+
+var maxUploadSize atomic.Int64
+
+// MaxUploadSize returns the largest inbound file adapters accept, in bytes.
+func MaxUploadSize() int64 {
+	if n := maxUploadSize.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxUploadSize
+}
+
+// SetMaxUploadSize changes the inbound file size limit, e.g. on config
+// reload. n <= 0 restores DefaultMaxUploadSize.
+func SetMaxUploadSize(n int64) {
+	maxUploadSize.Store(n)
+}
+
+// spoolPrefix names the temporary directories SaveUpload creates.
+const spoolPrefix = "im2code-upload-"
+
+// SanitizeFilename reduces a sender-supplied file name to a safe base name:
+// directory parts are dropped, control characters and characters that are
+// special on common filesystems become "_", and leading dots are removed so an upload
+// cannot become a hidden file or "..". The result is at most 128 bytes and
+// never empty.
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), strings.ContainsRune(`:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(strings.TrimLeft(name, ". "))
+	if len(name) > 128 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		cut := 128 - len(ext)
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut] + ext
+	}
+	if name == "" {
+		return "upload"
+	}
+	return name
+}
+
+// SaveUpload copies r to a new temporary file named SanitizeFilename(name)
+// and returns its path. It fails with ErrUploadTooLarge, leaving nothing
+// behind, once more than MaxUploadSize bytes are read. Adapters put the path
+// in InboundMessage.Media; the router moves it to its destination.
+func SaveUpload(name string, r io.Reader) (string, error) {
+	dir, err := os.MkdirTemp("", spoolPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, SanitizeFilename(name))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	limit := MaxUploadSize()
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > limit {
+		err = ErrUploadTooLarge
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
+
+var uploadClient = &http.Client{Timeout: 5 * time.Minute}
+
+// FetchUpload performs req, typically a GET with the platform's credentials,
+// and saves the response body with SaveUpload.
+func FetchUpload(req *http.Request, name string) (string, error) {
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > MaxUploadSize() {
+		return "", ErrUploadTooLarge
+	}
+	return SaveUpload(name, resp.Body)
+}
+
+// RemoveUpload deletes a file created by SaveUpload together with its
+// temporary directory. Paths SaveUpload did not create are left alone.
+func RemoveUpload(path string) {
+	dir := filepath.Dir(path)
+	if strings.HasPrefix(filepath.Base(dir), spoolPrefix) && filepath.Dir(dir) == filepath.Clean(os.TempDir()) {
+		os.RemoveAll(dir)
+	}
+}
+
+// Attachment is a file not yet saved locally, e.g. still on the platform's
+// servers. Adapters do not download or decode attachments in their receive
+// loop: the router calls Fetch, on its own goroutine, only for senders
+// allowed to upload.
+type Attachment struct {
+	Name  string
+	Fetch func() (string, error) // saves the file with SaveUpload and returns its path
+}
+
+// AddAttachment records attachment name, to be downloaded with fetch.
+func (m *InboundMessage) AddAttachment(name string, fetch func() (string, error)) {
+	m.Attachments = append(m.Attachments, Attachment{Name: name, Fetch: fetch})
+}
+
+// AddUpload records the outcome of fetching attachment name: path is
+// appended to Media, or err to MediaErrors so the sender is told.
+func (m *InboundMessage) AddUpload(name, path string, err error) {
+	if err != nil {
+		m.MediaErrors = append(m.MediaErrors, fmt.Sprintf("%s: %v", SanitizeFilename(name), err))
+		return
+	}
+	m.Media = append(m.Media, path)
+}
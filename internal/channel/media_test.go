@@ -0,0 +1,58 @@
+package channel_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"report.txt":                         "report.txt",
+		"../../etc/passwd":                   "passwd",
+		`C:\Users\me\notes.md`:               "notes.md",
+		".bashrc":                            "bashrc",
+		"..":                                 "upload",
+		"":                                   "upload",
+		"a\x00b\nc:d?.log":                   "a_b_c_d_.log",
+		"  spaced name.go  ":                 "spaced name.go",
+		strings.Repeat("x", 300) + ".tar.gz": strings.Repeat("x", 125) + ".gz",
+	}
+	for in, want := range cases {
+		if got := channel.SanitizeFilename(in); got != want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSaveUpload(t *testing.T) {
+	defer channel.SetMaxUploadSize(0)
+	channel.SetMaxUploadSize(8)
+
+	path, err := channel.SaveUpload("../x.txt", strings.NewReader("12345678"))
+	if err != nil {
+		t.Fatalf("SaveUpload: %v", err)
+	}
+	if filepath.Base(path) != "x.txt" {
+		t.Errorf("saved as %q", path)
+	}
+	channel.RemoveUpload(path)
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Error("RemoveUpload left the spool directory behind")
+	}
+
+	if _, err := channel.SaveUpload("big.bin", strings.NewReader("123456789")); !errors.Is(err, channel.ErrUploadTooLarge) {
+		t.Errorf("oversized upload: err = %v, want ErrUploadTooLarge", err)
+	}
+
+	var msg channel.InboundMessage
+	msg.AddUpload("big.bin", "", channel.ErrUploadTooLarge)
+	msg.AddUpload("ok.txt", "/tmp/ok.txt", nil)
+	if len(msg.Media) != 1 || len(msg.MediaErrors) != 1 || !strings.HasPrefix(msg.MediaErrors[0], "big.bin: ") {
+		t.Errorf("AddUpload: media=%q errors=%q", msg.Media, msg.MediaErrors)
+	}
+}
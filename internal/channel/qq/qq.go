@@ -2,8 +2,12 @@ package qq
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -87,6 +91,20 @@ func (c *Channel) Start(ctx context.Context) error {
 
 func (c *Channel) Stop() error { return nil }
 
+// richMedia uploads a file inline. botgo's dto.RichMediaMessage only takes a
+// URL; the API also accepts the content base64-encoded in file_data.
+type richMedia struct {
+	FileType uint64 `json:"file_type"`
+	FileData string `json:"file_data"`
+}
+
+func (richMedia) GetEventID() string        { return "" }
+func (richMedia) GetSendType() dto.SendType { return dto.RichMedia }
+
+// SupportsMedia reports that Send delivers msg.Media. QQ bots can only send
+// images; other files fail with an error.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
 	c.mu.RLock()
 	api := c.api
@@ -94,6 +112,14 @@ func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if api == nil {
 		return fmt.Errorf("qq: not started")
 	}
+	for _, path := range msg.Media {
+		if err := sendImage(api, msg.ChatID, path); err != nil {
+			return fmt.Errorf("qq: send %s: %w", filepath.Base(path), err)
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	for _, chunk := range splitMessage(msg.Text, maxMsgLen) {
 		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
 		_, err := api.PostC2CMessage(ctx, msg.ChatID, &dto.MessageToCreate{
@@ -108,6 +134,31 @@ func (c *Channel) Send(msg channel.OutboundMessage) error {
 	return nil
 }
 
+// sendImage uploads path and sends it as a rich-media message.
+func sendImage(api openapi.OpenAPI, userID, path string) error {
+	if !channel.IsImage(path) {
+		return fmt.Errorf("only images can be sent on QQ")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	uploaded, err := api.PostC2CMessage(ctx, userID, richMedia{
+		FileType: 1, // image
+		FileData: base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = api.PostC2CMessage(ctx, userID, &dto.MessageToCreate{
+		MsgType: dto.RichMediaMsg,
+		Media:   &dto.MediaInfo{FileInfo: uploaded.FileInfo},
+	})
+	return err
+}
+
 func (c *Channel) onC2CMessage(_ *dto.WSPayload, data *dto.WSC2CMessageData) error {
 	msg := (*dto.Message)(data)
 
@@ -124,7 +175,7 @@ func (c *Channel) onC2CMessage(_ *dto.WSPayload, data *dto.WSC2CMessageData) err
 	}
 
 	content := strings.TrimSpace(msg.Content)
-	if content == "" {
+	if content == "" && len(msg.Attachments) == 0 {
 		return nil
 	}
 
@@ -137,14 +188,37 @@ func (c *Channel) onC2CMessage(_ *dto.WSPayload, data *dto.WSC2CMessageData) err
 		preAuthorized = true
 	}
 
+	in := channel.InboundMessage{Channel: "qq", ChatID: userID, SenderID: userID, Text: content, PreAuthorized: preAuthorized}
+	for _, a := range msg.Attachments {
+		in.AddAttachment(a.FileName, func() (string, error) { return download(a) })
+	}
 	select {
-	case c.inbound <- channel.InboundMessage{Channel: "qq", ChatID: userID, SenderID: userID, Text: content, PreAuthorized: preAuthorized}:
+	case c.inbound <- in:
 	default:
 		slog.Warn("qq: inbound full, dropping message", "userID", userID)
 	}
 	return nil
 }
 
+// download fetches an attachment from the QQ CDN. URLs sometimes come
+// without a scheme.
+func download(a *dto.MessageAttachment) (string, error) {
+	if int64(a.Size) > channel.MaxUploadSize() {
+		return "", channel.ErrUploadTooLarge
+	}
+	url := a.URL
+	if strings.HasPrefix(url, "//") {
+		url = "https:" + url
+	} else if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	return channel.FetchUpload(req, a.FileName)
+}
+
 // addSeen records msgID and returns true if it was new (not a duplicate).
 func (c *Channel) addSeen(msgID string) bool {
 	c.mu.Lock()
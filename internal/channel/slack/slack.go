@@ -2,8 +2,13 @@ package slack
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	goslack "github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -19,6 +24,7 @@ type Channel struct {
 	inbound   chan<- channel.InboundMessage
 	client    *goslack.Client
 	cancel    context.CancelFunc
+	connected atomic.Bool // the Socket Mode websocket is up
 }
 
 func New(botToken, appToken string, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
@@ -31,6 +37,9 @@ func New(botToken, appToken string, allowFrom []string, inbound chan<- channel.I
 
 func (c *Channel) Name() string { return "slack" }
 
+// Connected reports whether the Socket Mode connection is up.
+func (c *Channel) Connected() bool { return c.connected.Load() }
+
 func (c *Channel) Start(ctx context.Context) error {
 	innerCtx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
@@ -39,9 +48,14 @@ func (c *Channel) Start(ctx context.Context) error {
 	c.client = api
 	sm := socketmode.New(api)
 
+	defer c.connected.Store(false)
 	go func() {
 		for evt := range sm.Events {
 			switch evt.Type {
+			case socketmode.EventTypeConnected:
+				c.connected.Store(true)
+			case socketmode.EventTypeConnecting, socketmode.EventTypeConnectionError, socketmode.EventTypeDisconnect:
+				c.connected.Store(false)
 			case socketmode.EventTypeEventsAPI:
 				sm.Ack(*evt.Request)
 				eventsAPI, ok := evt.Data.(slackevents.EventsAPIEvent)
@@ -67,7 +81,7 @@ func (c *Channel) Start(ctx context.Context) error {
 func (c *Channel) handleInner(event slackevents.EventsAPIInnerEvent) {
 	switch ev := event.Data.(type) {
 	case *slackevents.MessageEvent:
-		if ev.BotID != "" || ev.SubType != "" {
+		if ev.BotID != "" || (ev.SubType != "" && ev.SubType != "file_share") {
 			return
 		}
 		preAuthorized := false
@@ -90,6 +104,11 @@ func (c *Channel) handleInner(event slackevents.EventsAPIInnerEvent) {
 			Text:          text,
 			PreAuthorized: preAuthorized,
 		}
+		if ev.Message != nil {
+			for _, f := range ev.Message.Files {
+				inMsg.AddAttachment(f.Name, func() (string, error) { return c.download(f) })
+			}
+		}
 		select {
 		case c.inbound <- inMsg:
 		default:
@@ -98,6 +117,20 @@ func (c *Channel) handleInner(event slackevents.EventsAPIInnerEvent) {
 	}
 }
 
+// download fetches a shared file; private file URLs need the bot token and
+// the files:read scope.
+func (c *Channel) download(f goslack.File) (string, error) {
+	if int64(f.Size) > channel.MaxUploadSize() {
+		return "", channel.ErrUploadTooLarge
+	}
+	req, err := http.NewRequest("GET", f.URLPrivateDownload, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.botToken)
+	return channel.FetchUpload(req, f.Name)
+}
+
 func (c *Channel) Stop() error {
 	if c.cancel != nil {
 		c.cancel()
@@ -105,10 +138,31 @@ func (c *Channel) Stop() error {
 	return nil
 }
 
+// SupportsMedia reports that Send uploads msg.Media with files.uploadV2,
+// which needs the files:write scope.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if c.client == nil {
 		return nil
 	}
+	for _, path := range msg.Media {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+		if _, err := c.client.UploadFile(goslack.UploadFileParameters{
+			File:     path,
+			FileSize: int(fi.Size()),
+			Filename: filepath.Base(path),
+			Channel:  msg.ChatID,
+		}); err != nil {
+			return fmt.Errorf("slack: upload: %w", err)
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	for _, chunk := range splitMessage(msg.Text, 3000) {
 		if _, _, err := c.client.PostMessage(msg.ChatID,
 			goslack.MsgOptionText(chunk, false),
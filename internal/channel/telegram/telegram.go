@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -59,8 +61,8 @@ func (c *Channel) Start(ctx context.Context) error {
 
 func (c *Channel) handleUpdate(update tgbotapi.Update) {
 	msg := update.Message
-	if msg.Text == "" {
-		return // skip non-text messages
+	if msg.Text == "" && msg.Document == nil && len(msg.Photo) == 0 {
+		return // skip stickers, locations and other non-text messages
 	}
 	senderID := fmt.Sprintf("%d", msg.From.ID)
 
@@ -79,6 +81,19 @@ func (c *Channel) handleUpdate(update tgbotapi.Update) {
 		Text:          msg.Text,
 		PreAuthorized: preAuthorized,
 	}
+	switch {
+	case msg.Document != nil:
+		d := msg.Document
+		inMsg.AddAttachment(d.FileName, func() (string, error) {
+			return c.download(d.FileID, d.FileName, d.FileSize)
+		})
+	case len(msg.Photo) > 0:
+		p := msg.Photo[len(msg.Photo)-1] // largest size
+		name := "photo-" + p.FileUniqueID + ".jpg"
+		inMsg.AddAttachment(name, func() (string, error) {
+			return c.download(p.FileID, name, p.FileSize)
+		})
+	}
 	select {
 	case c.inbound <- inMsg:
 	default:
@@ -86,6 +101,22 @@ func (c *Channel) handleUpdate(update tgbotapi.Update) {
 	}
 }
 
+// download fetches an attached file. The Bot API serves files up to 20 MB.
+func (c *Channel) download(fileID, name string, size int) (string, error) {
+	if int64(size) > channel.MaxUploadSize() {
+		return "", channel.ErrUploadTooLarge
+	}
+	url, err := c.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	return channel.FetchUpload(req, name)
+}
+
 func (c *Channel) Stop() error {
 	if c.bot != nil {
 		c.bot.StopReceivingUpdates()
@@ -93,6 +124,10 @@ func (c *Channel) Stop() error {
 	return nil
 }
 
+// SupportsMedia reports that Send uploads msg.Media: images as photos,
+// anything else as documents.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if c.bot == nil {
 		return fmt.Errorf("telegram: not connected")
@@ -101,6 +136,18 @@ func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if err != nil {
 		return fmt.Errorf("telegram: invalid chat ID %q: %w", msg.ChatID, err)
 	}
+	for _, path := range msg.Media {
+		var m tgbotapi.Chattable = tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+		if channel.IsImage(path) {
+			m = tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(path))
+		}
+		if _, err := c.bot.Send(m); err != nil {
+			return fmt.Errorf("telegram: upload %s: %w", filepath.Base(path), err)
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	for _, chunk := range splitMessage(msg.Text, 4000) {
 		m := tgbotapi.NewMessage(chatID, chunk)
 		m.ParseMode = "Markdown"
@@ -0,0 +1,324 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// frame is the JSON message exchanged with the browser in both directions.
+// Attachments travel inline as data: URLs: outbound images in Images, other
+// outbound media and all browser uploads in Files.
+type frame struct {
+	Text   string     `json:"text"`
+	Images []string   `json:"images,omitempty"`
+	Files  []download `json:"files,omitempty"`
+}
+
+// download is a file attachment: offered as a download link in the page, or
+// uploaded from it.
+type download struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// client is one open WebSocket connection from a browser tab.
+type client struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (cl *client) write(f frame) error {
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	cl.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return cl.conn.WriteJSON(f)
+}
+
+// Channel is the built-in web adapter. It serves a minimal chat page and a
+// WebSocket endpoint on a local HTTP listener, so no third-party IM is needed.
+type Channel struct {
+	addr      string
+	tokens    map[string]string // user ID → access token
+	allowFrom map[string]bool
+	inbound   chan<- channel.InboundMessage
+	upgrader  websocket.Upgrader
+
+	mu      sync.Mutex
+	srv     *http.Server
+	clients map[string]map[*client]bool // chatID → open connections
+}
+
+// New returns a web channel listening on addr. tokens maps user IDs to access
+// tokens; when it is non-empty a browser must present one (?token=...) before
+// the WebSocket upgrade is accepted, and is identified as its user. Without
+// tokens the browser names itself with ?user=, and Start refuses addresses
+// other than loopback.
+func New(addr string, tokens map[string]string, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	allow := make(map[string]bool)
+	for _, id := range allowFrom {
+		allow[id] = true
+	}
+	return &Channel{
+		addr:      addr,
+		tokens:    tokens,
+		allowFrom: allow,
+		inbound:   inbound,
+		clients:   make(map[string]map[*client]bool),
+	}
+}
+
+func (c *Channel) Name() string { return "web" }
+
+func (c *Channel) Start(ctx context.Context) error {
+	if len(c.tokens) == 0 && !isLoopback(c.addr) {
+		return fmt.Errorf("web: tokens are required to listen on %s", c.addr)
+	}
+	for id, t := range c.tokens {
+		if t == "" {
+			return fmt.Errorf("web: user %s has an empty token", id)
+		}
+	}
+	ln, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("web: %w", err)
+	}
+	srv := &http.Server{Handler: c.Handler()}
+	c.mu.Lock()
+	c.srv = srv
+	c.mu.Unlock()
+
+	slog.Info("web: listening", "addr", ln.Addr().String())
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	select {
+	case <-ctx.Done():
+		c.Stop()
+		return nil
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("web: %w", err)
+	}
+}
+
+// Handler returns the HTTP handler serving the chat page and the /ws endpoint.
+func (c *Channel) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+	mux.HandleFunc("/ws", c.serveWS)
+	return mux
+}
+
+func (c *Channel) serveWS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	senderID := q.Get("user")
+	if len(c.tokens) > 0 {
+		if senderID = c.userOf(q.Get("token")); senderID == "" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+	if senderID == "" {
+		http.Error(w, "missing user", http.StatusBadRequest)
+		return
+	}
+	// Each user has one chat, shared by all their tabs: a chat is never
+	// opened on someone else's output.
+	chatID := senderID
+	if chat := q.Get("chat"); chat != "" && chat != chatID {
+		http.Error(w, "chat not allowed", http.StatusForbidden)
+		return
+	}
+
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[senderID] {
+			http.Error(w, "sender not allowed", http.StatusForbidden)
+			return
+		}
+		preAuthorized = true
+	}
+
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Debug("web: upgrade failed", "err", err)
+		return
+	}
+	cl := &client{conn: conn}
+	c.addClient(chatID, cl)
+	defer func() {
+		c.removeClient(chatID, cl)
+		conn.Close()
+	}()
+	slog.Debug("web: client connected", "chatID", chatID, "senderID", senderID, "remote", r.RemoteAddr)
+
+	// Room for an upload of MaxUploadSize after base64 encoding; larger
+	// frames close the connection.
+	conn.SetReadLimit(channel.MaxUploadSize()*4/3 + 64<<10)
+	for {
+		var f frame
+		if err := conn.ReadJSON(&f); err != nil {
+			return
+		}
+		if f.Text == "" && len(f.Files) == 0 {
+			continue
+		}
+		inMsg := channel.InboundMessage{
+			Channel:       "web",
+			ChatID:        chatID,
+			SenderID:      senderID,
+			Text:          f.Text,
+			PreAuthorized: preAuthorized,
+		}
+		for _, d := range f.Files {
+			inMsg.AddAttachment(d.Name, func() (string, error) { return saveDataURL(d) })
+		}
+		select {
+		case c.inbound <- inMsg:
+		default:
+			slog.Warn("web: inbound queue full, dropping message", "chatID", chatID)
+		}
+	}
+}
+
+// userOf returns the user whose access token is token, or "". Every token is
+// compared, each in constant time, so timing reveals neither which nor how
+// much of one matched.
+func (c *Channel) userOf(token string) string {
+	var user string
+	for id, t := range c.tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			user = id
+		}
+	}
+	return user
+}
+
+// isLoopback reports whether addr only accepts connections from this host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// saveDataURL stores an uploaded "data:<type>;base64,<data>" file.
+func saveDataURL(d download) (string, error) {
+	_, data, ok := strings.Cut(d.URL, ";base64,")
+	if !ok || !strings.HasPrefix(d.URL, "data:") {
+		return "", errors.New("not a base64 data URL")
+	}
+	return channel.SaveUpload(d.Name, base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+}
+
+func (c *Channel) addClient(chatID string, cl *client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients[chatID] == nil {
+		c.clients[chatID] = make(map[*client]bool)
+	}
+	c.clients[chatID][cl] = true
+}
+
+func (c *Channel) removeClient(chatID string, cl *client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients[chatID], cl)
+	if len(c.clients[chatID]) == 0 {
+		delete(c.clients, chatID)
+	}
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	srv := c.srv
+	var conns []*client
+	for _, set := range c.clients {
+		for cl := range set {
+			conns = append(conns, cl)
+		}
+	}
+	c.mu.Unlock()
+
+	// Hijacked WebSocket connections are not closed by Shutdown.
+	for _, cl := range conns {
+		cl.conn.Close()
+	}
+	if srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// SupportsMedia reports that Send delivers msg.Media: images inline in the
+// page, other files as download links.
+func (c *Channel) SupportsMedia() bool { return true }
+
+// Send delivers msg to every browser tab currently open on msg.ChatID.
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	c.mu.Lock()
+	var targets []*client
+	for cl := range c.clients[msg.ChatID] {
+		targets = append(targets, cl)
+	}
+	c.mu.Unlock()
+
+	if len(targets) == 0 {
+		return fmt.Errorf("web: no client connected for chat %q", msg.ChatID)
+	}
+	f := frame{Text: msg.Text}
+	for _, path := range msg.Media {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("web: %w", err)
+		}
+		url := "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		if channel.IsImage(path) {
+			f.Images = append(f.Images, url)
+		} else {
+			f.Files = append(f.Files, download{Name: filepath.Base(path), URL: url})
+		}
+	}
+	var firstErr error
+	for _, cl := range targets {
+		if err := cl.write(f); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("web: send: %w", err)
+		}
+	}
+	return firstErr
+}
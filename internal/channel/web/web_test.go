@@ -0,0 +1,184 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/web"
+)
+
+func dial(t *testing.T, srv *httptest.Server, query string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?" + query
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func TestWeb_RoundTrip(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 1)
+	c := web.New("", nil, nil, inbound)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	conn, _, err := dial(t, srv, "user=alice")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]string{"text": "#im2code"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case msg := <-inbound:
+		if msg.Channel != "web" || msg.ChatID != "alice" || msg.SenderID != "alice" || msg.Text != "#im2code" {
+			t.Errorf("unexpected inbound message: %+v", msg)
+		}
+		if msg.PreAuthorized {
+			t.Error("expected PreAuthorized = false with empty allow_from")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+
+	if err := c.Send(channel.OutboundMessage{Channel: "web", ChatID: "alice", Text: "Activated."}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got struct{ Text string }
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.Text != "Activated." {
+		t.Errorf("received %q, want %q", got.Text, "Activated.")
+	}
+}
+
+func TestWeb_AllowFromAndToken(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 1)
+	c := web.New("", map[string]string{"alice": "s3cret", "mallory": "m-tok"}, []string{"alice"}, inbound)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	for _, q := range []string{"user=alice", "user=alice&token=s3cre", "user=alice&token="} {
+		if _, resp, err := dial(t, srv, q); err == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got err=%v", q, err)
+		}
+	}
+	if _, resp, err := dial(t, srv, "user=alice&token=m-tok"); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for sender outside allow_from, got err=%v", err)
+	}
+	if _, resp, err := dial(t, srv, "token=s3cret&chat=mallory"); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for another user's chat, got err=%v", err)
+	}
+
+	// The token, not ?user=, says who the sender is.
+	conn, _, err := dial(t, srv, "user=mallory&token=s3cret")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"text": "ls"})
+	select {
+	case msg := <-inbound:
+		if !msg.PreAuthorized || msg.SenderID != "alice" || msg.ChatID != "alice" {
+			t.Errorf("expected pre-authorized message from alice in chat %q, got %+v", "alice", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+}
+
+func TestWeb_StartRequiresTokens(t *testing.T) {
+	inbound := make(chan channel.InboundMessage)
+	if err := web.New("0.0.0.0:0", nil, nil, inbound).Start(context.Background()); err == nil {
+		t.Error("expected a listener beyond loopback without tokens to be refused")
+	}
+	if err := web.New("127.0.0.1:0", map[string]string{"alice": ""}, nil, inbound).Start(context.Background()); err == nil {
+		t.Error("expected an empty token to be refused")
+	}
+}
+
+func TestWeb_SendWithoutClient(t *testing.T) {
+	c := web.New("", nil, nil, make(chan channel.InboundMessage, 1))
+	if err := c.Send(channel.OutboundMessage{Channel: "web", ChatID: "nobody", Text: "hi"}); err == nil {
+		t.Error("expected error when no browser is connected")
+	}
+}
+
+func TestWeb_SendMedia(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 1)
+	c := web.New("", nil, nil, inbound)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	conn, _, err := dial(t, srv, "user=alice")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// Wait until the server has registered the connection.
+	conn.WriteJSON(map[string]string{"text": "hi"})
+	select {
+	case <-inbound:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for inbound message")
+	}
+
+	path := filepath.Join(t.TempDir(), "shot.png")
+	os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0600)
+	if err := c.Send(channel.OutboundMessage{Channel: "web", ChatID: "alice", Media: []string{path}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got struct{ Images []string }
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(got.Images) != 1 || !strings.HasPrefix(got.Images[0], "data:image/png;base64,") {
+		t.Errorf("unexpected images %q", got.Images)
+	}
+}
+
+func TestWeb_Upload(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 1)
+	c := web.New("", nil, nil, inbound)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	conn, _, err := dial(t, srv, "user=alice")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]any{
+		"text":  "",
+		"files": []map[string]string{{"name": "../hi.txt", "url": "data:text/plain;base64,aGVsbG8="}},
+	})
+	select {
+	case msg := <-inbound:
+		// Nothing is written until the router fetches the attachment.
+		if len(msg.Media) != 0 || len(msg.Attachments) != 1 {
+			t.Fatalf("expected one attachment and no media, got %+v", msg)
+		}
+		path, err := msg.Attachments[0].Fetch()
+		if err != nil || filepath.Base(path) != "hi.txt" {
+			t.Fatalf("unexpected upload %q, %v", path, err)
+		}
+		defer channel.RemoveUpload(path)
+		if data, _ := os.ReadFile(path); string(data) != "hello" {
+			t.Errorf("uploaded content = %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for upload")
+	}
+}
@@ -0,0 +1,321 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex HMAC-SHA256 of timestamp.body>"
+	// on both inbound requests and outbound callbacks.
+	SignatureHeader = "X-Im2code-Signature"
+	// TimestampHeader carries the Unix time in seconds at which the request
+	// was signed.
+	TimestampHeader = "X-Im2code-Timestamp"
+
+	// maxSkew is how far a request's timestamp may be from the local clock.
+	// Signatures seen within it are remembered, so a captured request cannot
+	// be replayed either.
+	maxSkew = 5 * time.Minute
+
+	maxBodySize   = 1 << 20
+	deliveryQueue = 256
+	maxAttempts   = 4
+)
+
+// Options configures the webhook endpoint and the callback target.
+type Options struct {
+	Listen      string // HTTP address for inbound requests, e.g. 127.0.0.1:8788
+	Path        string // inbound path; defaults to /webhook
+	Secret      string // HMAC key for inbound verification and outbound signing
+	CallbackURL string // where OutboundMessages are POSTed
+}
+
+// inboundPayload is the JSON body accepted on the inbound endpoint.
+type inboundPayload struct {
+	ChatID   string `json:"chat_id"`
+	SenderID string `json:"sender_id"`
+	Text     string `json:"text"`
+}
+
+// outboundPayload is the JSON body POSTed to the callback URL.
+type outboundPayload struct {
+	Channel string   `json:"channel"`
+	ChatID  string   `json:"chat_id"`
+	Text    string   `json:"text"`
+	Media   []string `json:"media,omitempty"`
+}
+
+// Channel is the generic webhook adapter: inbound messages arrive as signed
+// HTTP POSTs, outbound messages are delivered to a callback URL with retries.
+type Channel struct {
+	opts      Options
+	allowFrom map[string]bool
+	inbound   chan<- channel.InboundMessage
+	client    *http.Client
+	outQ      chan outboundPayload
+	backoff   time.Duration // first retry delay, doubled per attempt
+
+	mu   sync.Mutex
+	srv  *http.Server
+	seen map[string]time.Time // recent inbound signature → its timestamp
+}
+
+func New(opts Options, allowFrom []string, inbound chan<- channel.InboundMessage) *Channel {
+	if opts.Path == "" {
+		opts.Path = "/webhook"
+	}
+	allow := make(map[string]bool)
+	for _, id := range allowFrom {
+		allow[id] = true
+	}
+	return &Channel{
+		opts:      opts,
+		allowFrom: allow,
+		inbound:   inbound,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		outQ:      make(chan outboundPayload, deliveryQueue),
+		backoff:   time.Second,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+func (c *Channel) Name() string { return "webhook" }
+
+func (c *Channel) Start(ctx context.Context) error {
+	if c.opts.Secret == "" {
+		return fmt.Errorf("webhook: secret is required")
+	}
+	ln, err := net.Listen("tcp", c.opts.Listen)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	srv := &http.Server{Handler: c.Handler()}
+	c.mu.Lock()
+	c.srv = srv
+	c.mu.Unlock()
+
+	go c.deliverLoop(ctx)
+
+	slog.Info("webhook: listening", "addr", ln.Addr().String(), "path", c.opts.Path)
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+	select {
+	case <-ctx.Done():
+		c.Stop()
+		return nil
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("webhook: %w", err)
+	}
+}
+
+// Handler returns the HTTP handler for the inbound endpoint.
+func (c *Channel) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(c.opts.Path, c.serveInbound)
+	return mux
+}
+
+func (c *Channel) serveInbound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil || len(body) > maxBodySize {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	timestamp, signature := r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader)
+	if !Verify(c.opts.Secret, timestamp, body, signature) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err := c.checkFresh(timestamp, signature); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var p inboundPayload
+	if err := json.Unmarshal(body, &p); err != nil || p.ChatID == "" || p.SenderID == "" || p.Text == "" {
+		http.Error(w, "expected JSON {chat_id, sender_id, text}", http.StatusBadRequest)
+		return
+	}
+
+	preAuthorized := false
+	if len(c.allowFrom) > 0 {
+		if !c.allowFrom[p.SenderID] {
+			http.Error(w, "sender not allowed", http.StatusForbidden)
+			return
+		}
+		preAuthorized = true
+	}
+
+	inMsg := channel.InboundMessage{
+		Channel:       "webhook",
+		ChatID:        p.ChatID,
+		SenderID:      p.SenderID,
+		Text:          p.Text,
+		PreAuthorized: preAuthorized,
+	}
+	select {
+	case c.inbound <- inMsg:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		slog.Warn("webhook: inbound queue full, dropping message", "chatID", p.ChatID)
+		http.Error(w, "queue full", http.StatusServiceUnavailable)
+	}
+}
+
+// checkFresh rejects a verified request whose timestamp is outside maxSkew or
+// whose signature was already accepted, and remembers the signature.
+func (c *Channel) checkFresh(timestamp, signature string) error {
+	sec, _ := strconv.ParseInt(timestamp, 10, 64)
+	ts, now := time.Unix(sec, 0), time.Now()
+	if ts.Before(now.Add(-maxSkew)) || ts.After(now.Add(maxSkew)) {
+		return errors.New("stale timestamp")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.seen[signature]; ok {
+		return errors.New("replayed request")
+	}
+	for sig, t := range c.seen {
+		if t.Before(now.Add(-maxSkew)) {
+			delete(c.seen, sig)
+		}
+	}
+	c.seen[signature] = ts
+	return nil
+}
+
+func (c *Channel) Stop() error {
+	c.mu.Lock()
+	srv := c.srv
+	c.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// Send queues msg for delivery to the callback URL. Delivery (and retrying)
+// happens in the background so a slow receiver never stalls other channels.
+func (c *Channel) Send(msg channel.OutboundMessage) error {
+	if c.opts.CallbackURL == "" {
+		return fmt.Errorf("webhook: no callback_url configured")
+	}
+	select {
+	case c.outQ <- outboundPayload{Channel: "webhook", ChatID: msg.ChatID, Text: msg.Text, Media: msg.Media}:
+		return nil
+	default:
+		return fmt.Errorf("webhook: delivery queue full")
+	}
+}
+
+func (c *Channel) deliverLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-c.outQ:
+			if err := c.deliver(ctx, p); err != nil {
+				slog.Error("webhook: delivery failed", "chatID", p.ChatID, "err", err)
+			}
+		}
+	}
+}
+
+// deliver POSTs p to the callback URL, retrying network errors, 429 and 5xx
+// responses with exponential backoff.
+func (c *Channel) deliver(ctx context.Context, p outboundPayload) error {
+	body, _ := json.Marshal(p)
+	delay := c.backoff
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		retry, err := c.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+		slog.Debug("webhook: delivery attempt failed", "attempt", attempt, "err", err)
+	}
+	return lastErr
+}
+
+func (c *Channel) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.opts.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	// Every attempt is signed afresh, so a retry is not taken for a replay.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(c.opts.Secret, timestamp, body))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
+
+// Sign returns the signature header value for body sent at timestamp, the
+// TimestampHeader value.
+func Sign(secret, timestamp string, body []byte) string {
+	return "sha256=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify reports whether signature is a valid Sign value for timestamp and
+// body. It does not check how old timestamp is.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") || timestamp == "" {
+		return false
+	}
+	return hmac.Equal(got, mac(secret, timestamp, body))
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp + "."))
+	m.Write(body)
+	return m.Sum(nil)
+}
@@ -0,0 +1,118 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/channel/webhook"
+)
+
+func post(t *testing.T, h http.Handler, timestamp, body, signature string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	req.Header.Set(webhook.TimestampHeader, timestamp)
+	if signature != "" {
+		req.Header.Set(webhook.SignatureHeader, signature)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhook_Inbound(t *testing.T) {
+	inbound := make(chan channel.InboundMessage, 4)
+	c := webhook.New(webhook.Options{Secret: "s3cret"}, []string{"alice"}, inbound)
+	h := c.Handler()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	body := `{"chat_id":"ops","sender_id":"alice","text":"#snap"}`
+	if code := post(t, h, now, body, webhook.Sign("s3cret", now, []byte(body))); code != http.StatusAccepted {
+		t.Fatalf("signed request: got status %d", code)
+	}
+	msg := <-inbound
+	if msg.Channel != "webhook" || msg.ChatID != "ops" || msg.SenderID != "alice" || msg.Text != "#snap" || !msg.PreAuthorized {
+		t.Errorf("unexpected inbound message: %+v", msg)
+	}
+
+	if code := post(t, h, now, body, webhook.Sign("s3cret", now, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("replayed request: got status %d", code)
+	}
+	if code := post(t, h, now, body, webhook.Sign("wrong", now, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("bad signature: got status %d", code)
+	}
+	if code := post(t, h, now, body, ""); code != http.StatusUnauthorized {
+		t.Errorf("missing signature: got status %d", code)
+	}
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	if code := post(t, h, stale, body, webhook.Sign("s3cret", stale, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("stale request: got status %d", code)
+	}
+	// The timestamp is signed: moving it forward breaks the signature.
+	if code := post(t, h, now+"0", body, webhook.Sign("s3cret", now, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("altered timestamp: got status %d", code)
+	}
+	other := `{"chat_id":"ops","sender_id":"mallory","text":"ls"}`
+	if code := post(t, h, now, other, webhook.Sign("s3cret", now, []byte(other))); code != http.StatusForbidden {
+		t.Errorf("disallowed sender: got status %d", code)
+	}
+	bad := `{"chat_id":"ops"}`
+	if code := post(t, h, now, bad, webhook.Sign("s3cret", now, []byte(bad))); code != http.StatusBadRequest {
+		t.Errorf("incomplete payload: got status %d", code)
+	}
+	if len(inbound) != 0 {
+		t.Errorf("rejected requests reached the inbound queue")
+	}
+}
+
+func TestWebhook_CallbackRetries(t *testing.T) {
+	var calls atomic.Int32
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("s3cret", r.Header.Get(webhook.TimestampHeader), body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("callback signature did not verify")
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		got <- string(body)
+	}))
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := webhook.New(webhook.Options{Listen: addr, Secret: "s3cret", CallbackURL: srv.URL}, nil, make(chan channel.InboundMessage))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	if err := c.Send(channel.OutboundMessage{Channel: "webhook", ChatID: "ops", Text: "done"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case body := <-got:
+		if !strings.Contains(body, `"chat_id":"ops"`) || !strings.Contains(body, `"text":"done"`) {
+			t.Errorf("unexpected callback body: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not retried")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 callback attempts, got %d", n)
+	}
+}
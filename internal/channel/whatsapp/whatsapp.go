@@ -1,10 +1,13 @@
 package whatsapp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -129,15 +132,16 @@ func (c *Channel) eventHandler(evt interface{}) {
 			slog.Debug("whatsapp: allowing IsFromMe from other device", "senderDevice", v.Info.Sender.Device)
 		}
 
-		// Skip non-text events (receipts, stickers, system messages).
+		// Skip events without text or a file (receipts, stickers, system messages).
 		text := ""
 		if v.Message.GetConversation() != "" {
 			text = v.Message.GetConversation()
 		} else if v.Message.GetExtendedTextMessage() != nil {
 			text = v.Message.GetExtendedTextMessage().GetText()
 		}
+		image, doc := v.Message.GetImageMessage(), v.Message.GetDocumentMessage()
 		slog.Debug("whatsapp: extracted text", "text", text, "len", len(text))
-		if text == "" {
+		if text == "" && image == nil && doc == nil {
 			slog.Debug("whatsapp: skipping (no text)")
 			return
 		}
@@ -163,6 +167,17 @@ func (c *Channel) eventHandler(evt interface{}) {
 			Text:          text,
 			PreAuthorized: preAuthorized,
 		}
+		switch {
+		case doc != nil:
+			msg.AddAttachment(doc.GetFileName(), func() (string, error) {
+				return c.download(doc, doc.GetFileName(), doc.GetFileLength())
+			})
+		case image != nil:
+			name := "image-" + v.Info.ID + ".jpg"
+			msg.AddAttachment(name, func() (string, error) {
+				return c.download(image, name, image.GetFileLength())
+			})
+		}
 		slog.Debug("whatsapp: sending to inbound", "chatID", msg.ChatID, "preAuthorized", preAuthorized)
 		select {
 		case c.inbound <- msg:
@@ -172,6 +187,20 @@ func (c *Channel) eventHandler(evt interface{}) {
 	}
 }
 
+// download fetches and decrypts an attached image or document.
+func (c *Channel) download(m whatsmeow.DownloadableMessage, name string, size uint64) (string, error) {
+	if size > uint64(channel.MaxUploadSize()) {
+		return "", channel.ErrUploadTooLarge
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	data, err := c.client.Download(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	return channel.SaveUpload(name, bytes.NewReader(data))
+}
+
 func (c *Channel) Stop() error {
 	if c.client != nil {
 		c.client.Disconnect()
@@ -179,6 +208,9 @@ func (c *Channel) Stop() error {
 	return nil
 }
 
+// SupportsMedia reports that Send uploads msg.Media as images or documents.
+func (c *Channel) SupportsMedia() bool { return true }
+
 func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if c.client == nil {
 		return fmt.Errorf("whatsapp: not connected")
@@ -187,6 +219,14 @@ func (c *Channel) Send(msg channel.OutboundMessage) error {
 	if err != nil {
 		return err
 	}
+	for _, path := range msg.Media {
+		if err := c.sendFile(jid, path); err != nil {
+			return fmt.Errorf("whatsapp: upload: %w", err)
+		}
+	}
+	if msg.Text == "" {
+		return nil
+	}
 	for _, chunk := range splitMessage(msg.Text, 4000) {
 		if err := c.sendChunk(jid, chunk); err != nil {
 			return err
@@ -204,6 +244,53 @@ func (c *Channel) sendChunk(jid types.JID, text string) error {
 	return err
 }
 
+// sendFile encrypts and uploads path to the WhatsApp media servers, then
+// sends it as an image or document message.
+func (c *Channel) sendFile(jid types.JID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	mimeType := http.DetectContentType(data)
+	mediaType := whatsmeow.MediaDocument
+	if channel.IsImage(path) {
+		mediaType = whatsmeow.MediaImage
+	}
+	up, err := c.client.Upload(ctx, data, mediaType)
+	if err != nil {
+		return err
+	}
+
+	var m *waE2E.Message
+	if mediaType == whatsmeow.MediaImage {
+		m = &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			Mimetype:      proto.String(mimeType),
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}}
+	} else {
+		m = &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			Mimetype:      proto.String(mimeType),
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+			FileName:      proto.String(filepath.Base(path)),
+		}}
+	}
+	_, err = c.client.SendMessage(ctx, jid, m)
+	return err
+}
+
 // splitMessage splits text into chunks of at most maxLen bytes, breaking on
 // newlines where possible. This keeps messages under WhatsApp's effective size
 // limit (~65535 bytes; 4000 is used for safety and consistency with other
@@ -8,12 +8,72 @@ import (
 )
 
 type Config struct {
-	Prefix       string         `yaml:"prefix"`
-	LogLevel     string         `yaml:"loglevel"`
-	LogFile      string         `yaml:"logfile"`
-	CmdHistoryDB string         `yaml:"cmd_history_db"`
-	Tmux         TmuxConfig     `yaml:"tmux"`
-	Channels     ChannelConfigs `yaml:"channels"`
+	Prefix       string        `yaml:"prefix"`
+	LogLevel     string        `yaml:"loglevel"`
+	LogFile      string        `yaml:"logfile"`
+	CmdHistoryDB string        `yaml:"cmd_history_db"`
+	History      HistoryConfig `yaml:"history"`
+	AuditLog     string        `yaml:"audit_log"`      // default ~/.im2code/audit.jsonl
+	ControlSock  string        `yaml:"control_socket"` // default ~/.im2code/im2code.sock
+	Tmux         TmuxConfig    `yaml:"tmux"`
+	Uploads      UploadsConfig `yaml:"uploads"`
+	// Roles maps "channel:senderID" to owner, operator or viewer. Senders
+	// admitted by allow_from without an entry here are operators.
+	Roles      map[string]string `yaml:"roles,omitempty"`
+	SessionACL SessionACLConfig  `yaml:"session_acl"`
+	Guard      GuardConfig       `yaml:"guard"`
+	TOTP       TOTPConfig        `yaml:"totp"`
+	Channels   ChannelConfigs    `yaml:"channels"`
+}
+
+// HistoryConfig controls what the command history keeps and for how long.
+type HistoryConfig struct {
+	MaxAge        string   `yaml:"max_age"`        // e.g. 720h; empty = forever
+	MaxRows       int      `yaml:"max_rows"`       // newest inputs (and outputs) kept; 0 = no limit
+	Redact        []string `yaml:"redact"`         // extra regexps replaced by [REDACTED] before writing
+	RedactBuiltin bool     `yaml:"redact_builtin"` // also redact AWS keys, GitHub and Slack tokens, JWTs, private keys
+	// Backends lists where history is written; empty = the SQLite database
+	// at cmd_history_db only.
+	Backends []HistoryBackend `yaml:"backends,omitempty"`
+}
+
+// HistoryBackend is one destination for command history.
+type HistoryBackend struct {
+	Type     string `yaml:"type"`               // sqlite | jsonl | syslog
+	Path     string `yaml:"path,omitempty"`     // sqlite (default cmd_history_db), jsonl (required)
+	Network  string `yaml:"network,omitempty"`  // syslog: "" = local daemon or journald, udp, tcp
+	Address  string `yaml:"address,omitempty"`  // syslog: host:port with network
+	Tag      string `yaml:"tag,omitempty"`      // syslog: default im2code
+	Facility string `yaml:"facility,omitempty"` // syslog: user (default), daemon, auth, authpriv, local0-7
+}
+
+// GuardConfig holds the regular expressions plain text is checked against
+// before it is typed into tmux.
+type GuardConfig struct {
+	Deny           []string `yaml:"deny"`            // never sent
+	Confirm        []string `yaml:"confirm"`         // sent only after #confirm <code>
+	ConfirmTimeout string   `yaml:"confirm_timeout"` // default 60s
+}
+
+// TOTPConfig enables step-up authentication with an authenticator app. The
+// secret is written by "im2code totp enroll".
+type TOTPConfig struct {
+	Secret      string   `yaml:"secret"`       // base32; empty = TOTP off
+	Protected   []string `yaml:"protected"`    // sessions whose #attach needs a code; patterns as in session_acl
+	ReauthAfter string   `yaml:"reauth_after"` // idle period after which #auth is required; empty = never
+}
+
+// SessionACLConfig limits the tmux sessions chats may attach to, list and
+// watch. Patterns are globs, or regular expressions prefixed with "re:".
+type SessionACLConfig struct {
+	Default []string            `yaml:"default,omitempty"` // for senders and chats without a rule; empty with no rules = all sessions
+	Rules   map[string][]string `yaml:"rules,omitempty"`   // "channel:senderID" or "channel:chatID" → patterns
+}
+
+// UploadsConfig controls files sent to the bot from chat.
+type UploadsConfig struct {
+	Dir       string `yaml:"dir"`         // default: the bound pane's working directory
+	MaxSizeMB int    `yaml:"max_size_mb"` // default 20
 }
 
 type TmuxConfig struct {
@@ -22,16 +82,29 @@ type TmuxConfig struct {
 	PromptPatterns []string `yaml:"prompt_patterns"`
 	WatchTimeMin   string   `yaml:"watchtime_min"` // min interval between watch pushes (1s–3600s), default 5s
 	WatchTimeMax   string   `yaml:"watchtime_max"` // periodic push interval when idle (1s–3600s), default 20s
+	WatchMode      string   `yaml:"watch_mode"`    // full | diff, default full
+	// DiffRedraw is the fraction of new lines above which diff mode sends a
+	// full snapshot instead (screen cleared or redrawn), default 0.6.
+	DiffRedraw float64 `yaml:"diff_redraw_threshold"`
+	// WatchImages sends watch pushes as rendered screenshots on channels that
+	// support images; watch_mode then has no effect for those chats.
+	WatchImages bool `yaml:"watch_images"`
 }
 
 type ChannelConfigs struct {
-	Telegram TelegramConfig `yaml:"telegram"`
-	Discord  DiscordConfig  `yaml:"discord"`
-	Slack    SlackConfig    `yaml:"slack"`
-	WhatsApp WhatsAppConfig `yaml:"whatsapp"`
-	Feishu   FeishuConfig   `yaml:"feishu"`
-	DingTalk DingTalkConfig `yaml:"dingtalk"`
-	QQ       QQConfig       `yaml:"qq"`
+	Telegram   TelegramConfig   `yaml:"telegram"`
+	Discord    DiscordConfig    `yaml:"discord"`
+	Slack      SlackConfig      `yaml:"slack"`
+	WhatsApp   WhatsAppConfig   `yaml:"whatsapp"`
+	Feishu     FeishuConfig     `yaml:"feishu"`
+	DingTalk   DingTalkConfig   `yaml:"dingtalk"`
+	QQ         QQConfig         `yaml:"qq"`
+	Web        WebConfig        `yaml:"web"`
+	Matrix     MatrixConfig     `yaml:"matrix"`
+	IRC        IRCConfig        `yaml:"irc"`
+	Mattermost MattermostConfig `yaml:"mattermost"`
+	Email      EmailConfig      `yaml:"email"`
+	Webhook    WebhookConfig    `yaml:"webhook"`
 }
 
 type TelegramConfig struct {
@@ -71,6 +144,68 @@ type QQConfig struct {
 	AllowFrom []string `yaml:"allow_from"`
 }
 
+type MattermostConfig struct {
+	URL       string   `yaml:"url"`   // server URL, e.g. https://mattermost.example.com
+	Token     string   `yaml:"token"` // personal access token
+	AllowFrom []string `yaml:"allow_from"`
+}
+
+// EmailConfig watches an IMAP mailbox and replies over SMTP. Username and
+// Password are used for both servers. The From header proves nothing, so at
+// least one of AuthServID and Secret is required.
+type EmailConfig struct {
+	IMAPServer string   `yaml:"imap_server"` // host:port, e.g. imap.example.com:993
+	IMAPTLS    bool     `yaml:"imap_tls"`
+	SMTPServer string   `yaml:"smtp_server"` // host:port, e.g. smtp.example.com:587
+	SMTPTLS    bool     `yaml:"smtp_tls"`    // implicit TLS (465); otherwise STARTTLS when offered
+	Username   string   `yaml:"username"`
+	Password   string   `yaml:"password"`
+	Address    string   `yaml:"address"`     // From address; defaults to username
+	Mailbox    string   `yaml:"mailbox"`     // defaults to INBOX
+	AuthServID string   `yaml:"authserv_id"` // trusted Authentication-Results server, e.g. mx.example.com
+	Secret     string   `yaml:"secret"`      // shared secret required in the subject or body
+	AllowFrom  []string `yaml:"allow_from"`
+}
+
+// WebConfig enables the built-in browser chat page. Listen is the HTTP address
+// (e.g. "0.0.0.0:8787"); the channel is disabled when it is empty. Tokens maps
+// user IDs to access tokens: a browser passes ?token= and is that user.
+// Without tokens the page picks its own user ID, so the listener must then be
+// on a loopback address.
+type WebConfig struct {
+	Listen    string            `yaml:"listen"`
+	Tokens    map[string]string `yaml:"tokens"`
+	AllowFrom []string          `yaml:"allow_from"`
+}
+
+// WebhookConfig exposes a signed HTTP endpoint for inbound messages and POSTs
+// replies to CallbackURL. Both directions are signed with Secret (HMAC-SHA256).
+type WebhookConfig struct {
+	Listen      string   `yaml:"listen"`
+	Path        string   `yaml:"path"` // defaults to /webhook
+	Secret      string   `yaml:"secret"`
+	CallbackURL string   `yaml:"callback_url"`
+	AllowFrom   []string `yaml:"allow_from"`
+}
+
+type MatrixConfig struct {
+	Homeserver  string   `yaml:"homeserver"`
+	UserID      string   `yaml:"user_id"`
+	AccessToken string   `yaml:"access_token"`
+	AllowFrom   []string `yaml:"allow_from"`
+}
+
+type IRCConfig struct {
+	Server    string   `yaml:"server"` // host:port, e.g. irc.libera.chat:6697
+	TLS       bool     `yaml:"tls"`
+	Nick      string   `yaml:"nick"`
+	Username  string   `yaml:"username"` // SASL account; defaults to nick
+	Password  string   `yaml:"password"`
+	Auth      string   `yaml:"auth"` // sasl | nickserv | "" (server password)
+	Channels  []string `yaml:"channels"`
+	AllowFrom []string `yaml:"allow_from"`
+}
+
 // Defaults returns a Config populated with all default values.
 func Defaults() *Config {
 	return defaults()
@@ -87,6 +222,26 @@ func defaults() *Config {
 			PromptPatterns: []string{`[$#>]\s*$`, `>>>\s*$`},
 			WatchTimeMin:   "5s",
 			WatchTimeMax:   "20s",
+			WatchMode:      "full",
+			DiffRedraw:     0.6,
+		},
+		Uploads: UploadsConfig{
+			MaxSizeMB: 20,
+		},
+		History: HistoryConfig{
+			Redact:        []string{},
+			RedactBuiltin: true,
+		},
+		Guard: GuardConfig{
+			Deny: []string{},
+			Confirm: []string{
+				`\brm\s+-\w*[rRf]`,
+				`\bgit\s+push\b.*\s(-f|--force)`,
+				`\bgit\s+reset\s+--hard\b`,
+				`\b(mkfs(\.\w+)?|shutdown|reboot|poweroff)\b`,
+				`\bdd\b.*\bof=`,
+			},
+			ConfirmTimeout: "60s",
 		},
 	}
 }
@@ -0,0 +1,220 @@
+// Package control implements the daemon's local control API: newline-delimited
+// JSON requests and responses over a Unix-domain socket.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+// ErrNotRunning is returned by Call when no daemon is listening on the socket.
+var ErrNotRunning = errors.New("im2code is not running")
+
+// Request is one line sent by a client.
+type Request struct {
+	Action  string `json:"action"`            // status | attach | detach | watch | revoke
+	Chat    string `json:"chat,omitempty"`    // "channel:chatID"; "channel:senderID" for revoke
+	Session string `json:"session,omitempty"` // attach only
+	On      bool   `json:"on,omitempty"`      // watch only
+}
+
+// Response is the daemon's answer to one Request.
+type Response struct {
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+// Status is the live state of the daemon.
+type Status struct {
+	PID       int              `json:"pid"`
+	StartedAt time.Time        `json:"started_at"`
+	Channels  []channel.Status `json:"channels"`
+	Bindings  []router.Binding `json:"bindings"`
+	Detectors []Detector       `json:"detectors"`
+	Queues    Queues           `json:"queues"`
+}
+
+// Detector describes one running idle detector.
+type Detector struct {
+	Session string `json:"session"`
+	Min     string `json:"min"`
+	Max     string `json:"max"`
+}
+
+// Queues reports the number of buffered messages between channels and router.
+type Queues struct {
+	Inbound  int `json:"inbound"`
+	Outbound int `json:"outbound"`
+}
+
+// Handler is implemented by the daemon to answer control requests.
+type Handler interface {
+	Status() Status
+	Attach(chat, session string) error
+	Detach(chat string) error
+	Watch(chat string, on bool) error
+	Revoke(sender string) error
+}
+
+// Server accepts control connections on a Unix-domain socket.
+type Server struct {
+	path string
+	h    Handler
+	ln   net.Listener
+	wg   sync.WaitGroup
+}
+
+// Listen creates the socket at path, replacing a stale socket left by a
+// crashed daemon. It fails if another daemon is still listening there. The
+// socket is created in a private directory and moved to path only once it is
+// 0600, so other local users cannot connect in between.
+func Listen(path string, h Handler) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control: %s is in use by another im2code process", path)
+		}
+		os.Remove(path)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".im2code-control-*") // 0700
+	if err != nil {
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	// Serve removes the socket at path; tmp is gone by then.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	return &Server{path: path, h: h, ln: ln}, nil
+}
+
+// Serve handles connections until ctx is done, then removes the socket.
+func (s *Server) Serve(ctx context.Context) {
+	stop := context.AfterFunc(ctx, func() { s.ln.Close() })
+	defer stop()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			break
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+	s.wg.Wait()
+	os.Remove(s.path)
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+		if !sc.Scan() {
+			return
+		}
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			resp = Response{Error: "invalid request: " + err.Error()}
+		} else {
+			resp = s.dispatch(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(req Request) Response {
+	slog.Debug("control: request", "action", req.Action, "chat", req.Chat)
+	var err error
+	switch req.Action {
+	case "status":
+		st := s.h.Status()
+		return Response{OK: true, Status: &st}
+	case "attach":
+		if req.Session == "" {
+			return Response{Error: "attach: session is required"}
+		}
+		if err = validChat(req.Chat); err == nil {
+			err = s.h.Attach(req.Chat, req.Session)
+		}
+	case "detach":
+		if err = validChat(req.Chat); err == nil {
+			err = s.h.Detach(req.Chat)
+		}
+	case "watch":
+		if err = validChat(req.Chat); err == nil {
+			err = s.h.Watch(req.Chat, req.On)
+		}
+	case "revoke":
+		if err = validChat(req.Chat); err == nil {
+			err = s.h.Revoke(req.Chat)
+		}
+	default:
+		return Response{Error: fmt.Sprintf("unknown action %q", req.Action)}
+	}
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	return Response{OK: true}
+}
+
+func validChat(chat string) error {
+	ch, id, ok := strings.Cut(chat, ":")
+	if !ok || ch == "" || id == "" {
+		return fmt.Errorf("chat must be channel:chatID, got %q", chat)
+	}
+	return nil
+}
+
+// Call sends req to the daemon listening on path and waits for the response.
+// A response with OK == false is returned as an error.
+func Call(path string, req Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrNotRunning, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
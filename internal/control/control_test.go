@@ -0,0 +1,131 @@
+package control_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/control"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+type fakeHandler struct {
+	bindings map[string]string
+	watching map[string]bool
+}
+
+func (f *fakeHandler) Status() control.Status {
+	var b []router.Binding
+	for chat, session := range f.bindings {
+		b = append(b, router.Binding{Chat: chat, Session: session, Watch: f.watching[chat]})
+	}
+	return control.Status{PID: 42, Bindings: b, Queues: control.Queues{Inbound: 1}}
+}
+
+func (f *fakeHandler) Attach(chat, session string) error {
+	f.bindings[chat] = session
+	return nil
+}
+
+func (f *fakeHandler) Detach(chat string) error {
+	delete(f.bindings, chat)
+	return nil
+}
+
+func (f *fakeHandler) Watch(chat string, on bool) error {
+	if _, ok := f.bindings[chat]; !ok {
+		return errors.New("not attached")
+	}
+	f.watching[chat] = on
+	return nil
+}
+
+func (f *fakeHandler) Revoke(sender string) error {
+	return errors.New("no role")
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "im2code.sock")
+	srv, err := control.Listen(path, &fakeHandler{bindings: map[string]string{}, watching: map[string]bool{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go srv.Serve(ctx)
+	return path
+}
+
+func TestControl_AttachWatchStatus(t *testing.T) {
+	path := startServer(t)
+
+	if _, err := control.Call(path, control.Request{Action: "watch", Chat: "telegram:1", On: true}); err == nil {
+		t.Error("expected watch on an unbound chat to fail")
+	}
+	if _, err := control.Call(path, control.Request{Action: "attach", Chat: "telegram:1", Session: "dev"}); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if _, err := control.Call(path, control.Request{Action: "watch", Chat: "telegram:1", On: true}); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	resp, err := control.Call(path, control.Request{Action: "status"})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	st := resp.Status
+	if st == nil || st.PID != 42 || st.Queues.Inbound != 1 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if len(st.Bindings) != 1 || st.Bindings[0] != (router.Binding{Chat: "telegram:1", Session: "dev", Watch: true}) {
+		t.Errorf("unexpected bindings: %+v", st.Bindings)
+	}
+}
+
+func TestControl_InvalidRequests(t *testing.T) {
+	path := startServer(t)
+	for _, req := range []control.Request{
+		{Action: "reboot"},
+		{Action: "attach", Chat: "telegram:1"},
+		{Action: "detach", Chat: "telegram"},
+		{Action: "revoke", Chat: "telegram:1"},
+	} {
+		if _, err := control.Call(path, req); err == nil {
+			t.Errorf("%+v: expected error", req)
+		}
+	}
+}
+
+func TestControl_NotRunning(t *testing.T) {
+	_, err := control.Call(filepath.Join(t.TempDir(), "missing.sock"), control.Request{Action: "status"})
+	if !errors.Is(err, control.ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning, got %v", err)
+	}
+}
+
+func TestControl_SocketPrivate(t *testing.T) {
+	path := startServer(t)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Type() != os.ModeSocket || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected a 0600 socket, got %v", fi.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the socket to be left, got %v", entries)
+	}
+	if _, err := control.Call(path, control.Request{Action: "status"}); err != nil {
+		t.Errorf("expected the moved socket to accept connections, got %v", err)
+	}
+}
+
+func TestControl_ListenRefusesLiveSocket(t *testing.T) {
+	path := startServer(t)
+	if _, err := control.Listen(path, &fakeHandler{}); err == nil {
+		t.Error("expected Listen to refuse a socket in use")
+	}
+}
@@ -0,0 +1,150 @@
+package history_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/history"
+)
+
+func readLines(t *testing.T, path string) []history.Line {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []history.Line
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var l history.Line
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func TestJSONL(t *testing.T) {
+	path := t.TempDir() + "/history.jsonl"
+	j, err := history.NewJSONL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Record("telegram", "1", "alice", "make build")
+	j.RecordOutput("telegram", "1", "dev", "ok")
+	j.Close()
+
+	// Reopening appends.
+	j, _ = history.NewJSONL(path)
+	j.Record("telegram", "1", "alice", "make test")
+	j.Close()
+
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %+v", lines)
+	}
+	if l := lines[0]; l.Type != "input" || l.SenderID != "alice" || l.Text != "make build" || l.Time == "" {
+		t.Errorf("unexpected input line %+v", l)
+	}
+	if l := lines[1]; l.Type != "output" || l.Session != "dev" || l.SenderID != "" {
+		t.Errorf("unexpected output line %+v", l)
+	}
+	if lines[2].Text != "make test" {
+		t.Errorf("expected the appended line, got %+v", lines[2])
+	}
+}
+
+func TestJSONLPrune(t *testing.T) {
+	path := t.TempDir() + "/history.jsonl"
+	old, _ := json.Marshal(history.Line{Type: "input", Time: "2020-01-01T00:00:00.000Z", Channel: "slack", ChatID: "C1", Text: "old"})
+	if err := os.WriteFile(path, append(old, []byte("\nnot json\n")...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j, err := history.NewJSONL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for _, text := range []string{"a", "b", "c"} {
+		j.Record("slack", "C1", "bob", text)
+		j.RecordOutput("slack", "C1", "dev", text+"-out")
+	}
+
+	// The old line goes by age, then the oldest input and output by count.
+	n, err := j.Prune(time.Now().Add(-time.Hour), 2)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 pruned lines, got %d, %v", n, err)
+	}
+	if n, err := j.Prune(time.Now().Add(-time.Hour), 2); err != nil || n != 0 {
+		t.Errorf("expected nothing left to prune, got %d, %v", n, err)
+	}
+	// Writes after a prune go to the new file.
+	j.Record("slack", "C1", "bob", "d")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var l history.Line
+		if json.Unmarshal(line, &l) != nil {
+			texts = append(texts, string(line))
+			continue
+		}
+		texts = append(texts, l.Text)
+	}
+	want := []string{"not json", "b", "b-out", "c", "c-out", "d"}
+	if strings.Join(texts, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, texts)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	dir := t.TempDir()
+	j, err := history.NewJSONL(dir + "/history.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := history.NewMulti(j).(interface {
+		Get(int64) (history.Entry, error)
+	}); ok {
+		t.Error("expected a fan-out of JSONL only not to be readable")
+	}
+
+	h, err := history.New(dir + "/history.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := history.NewMulti(j, h)
+	if err := m.Record("slack", "C1", "bob", "git status"); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := m.(interface {
+		Query(history.Filter) ([]history.Entry, error)
+	})
+	if !ok {
+		t.Fatal("expected a fan-out with SQLite to be readable")
+	}
+	got, err := r.Query(history.Filter{})
+	if err != nil || len(got) != 1 || got[0].Text != "git status" {
+		t.Errorf("expected the row in SQLite, got %+v, %v", got, err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLines(t, dir+"/history.jsonl"); len(lines) != 1 || lines[0].ChatID != "C1" {
+		t.Errorf("expected the row in the JSONL file, got %+v", lines)
+	}
+	// Both are closed: every write fails, and the errors are joined.
+	if err := m.Record("slack", "C1", "bob", "ls"); err == nil {
+		t.Error("expected writes to closed backends to fail")
+	}
+}
@@ -2,17 +2,42 @@ package history
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// ErrNotFound is returned by Get for an id that has no row.
+var ErrNotFound = errors.New("history: no such entry")
+
 // History records every user input to a SQLite database.
 type History struct {
 	db *sql.DB
 }
 
+// Entry is one recorded input.
+type Entry struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Channel  string    `json:"channel"`
+	ChatID   string    `json:"chat_id"`
+	SenderID string    `json:"sender_id"`
+	Text     string    `json:"text"`
+}
+
+// Filter selects entries for Query. Zero fields match everything.
+type Filter struct {
+	Channel  string
+	ChatID   string
+	SenderID string
+	Since    time.Time
+	Grep     string // substring of the text, case-sensitive
+	Limit    int    // most recent n entries; 0 = all
+}
+
 // New opens (or creates) the SQLite database at dbPath and ensures the
 // cmd_history table exists.
 func New(dbPath string) (*History, error) {
@@ -26,24 +51,183 @@ func New(dbPath string) (*History, error) {
 		ts        TEXT    NOT NULL,
 		channel   TEXT    NOT NULL,
 		sender_id TEXT    NOT NULL,
-		text      TEXT    NOT NULL
+		text      TEXT    NOT NULL,
+		chat_id   TEXT    NOT NULL DEFAULT ''
 	)`); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("history: create table: %w", err)
 	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS cmd_output (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		ts       TEXT    NOT NULL,
+		channel  TEXT    NOT NULL,
+		chat_id  TEXT    NOT NULL,
+		session  TEXT    NOT NULL,
+		input_id INTEGER,
+		text     TEXT    NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history: create output table: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return &History{db: db}, nil
 }
 
+// migrate adds chat_id to databases created before it existed. Their rows
+// keep an empty chat_id.
+func migrate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('cmd_history')`)
+	if err != nil {
+		return fmt.Errorf("history: read schema: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("history: read schema: %w", err)
+		}
+		if name == "chat_id" {
+			return nil
+		}
+	}
+	if _, err := db.Exec(`ALTER TABLE cmd_history ADD COLUMN chat_id TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("history: add chat_id: %w", err)
+	}
+	return nil
+}
+
+// tsLayout is how timestamps are stored: UTC with milliseconds, so inputs and
+// the output they caused sort correctly within a second. Rows written before
+// used time.RFC3339, which parses the same way.
+const tsLayout = "2006-01-02T15:04:05.000Z07:00"
+
 // Record inserts one row. It is safe to call concurrently.
-func (h *History) Record(channel, senderID, text string) error {
-	ts := time.Now().UTC().Format(time.RFC3339)
+func (h *History) Record(channel, chatID, senderID, text string) error {
+	ts := time.Now().UTC().Format(tsLayout)
+	_, err := h.db.Exec(
+		`INSERT INTO cmd_history (ts, channel, chat_id, sender_id, text) VALUES (?, ?, ?, ?, ?)`,
+		ts, channel, chatID, senderID, text,
+	)
+	return err
+}
+
+// RecordOutput stores pane output sent to a chat. It is linked to the chat's
+// latest input, the one that led to it.
+func (h *History) RecordOutput(channel, chatID, session, text string) error {
+	ts := time.Now().UTC().Format(tsLayout)
 	_, err := h.db.Exec(
-		`INSERT INTO cmd_history (ts, channel, sender_id, text) VALUES (?, ?, ?, ?)`,
-		ts, channel, senderID, text,
+		`INSERT INTO cmd_output (ts, channel, chat_id, session, input_id, text)
+		 VALUES (?, ?, ?, ?, (SELECT max(id) FROM cmd_history WHERE channel = ? AND chat_id = ?), ?)`,
+		ts, channel, chatID, session, channel, chatID, text,
 	)
 	return err
 }
 
+// Query returns the entries matching f, oldest first.
+func (h *History) Query(f Filter) ([]Entry, error) {
+	var where []string
+	var args []any
+	for _, c := range []struct{ col, val string }{
+		{"channel", f.Channel},
+		{"chat_id", f.ChatID},
+		{"sender_id", f.SenderID},
+	} {
+		if c.val != "" {
+			where = append(where, c.col+" = ?")
+			args = append(args, c.val)
+		}
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "ts >= ?")
+		args = append(args, f.Since.UTC().Format(tsLayout))
+	}
+	if f.Grep != "" {
+		where = append(where, "instr(text, ?) > 0")
+		args = append(args, f.Grep)
+	}
+	q := `SELECT id, ts, channel, chat_id, sender_id, text FROM cmd_history`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		q += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+
+	rows, err := h.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history: query: %w", err)
+	}
+	defer rows.Close()
+	var out []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history: query: %w", err)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Get returns the entry with id, or ErrNotFound.
+func (h *History) Get(id int64) (Entry, error) {
+	row := h.db.QueryRow(`SELECT id, ts, channel, chat_id, sender_id, text FROM cmd_history WHERE id = ?`, id)
+	e, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrNotFound
+	}
+	return e, err
+}
+
+func scanEntry(s interface{ Scan(...any) error }) (Entry, error) {
+	var e Entry
+	var ts string
+	if err := s.Scan(&e.ID, &ts, &e.Channel, &e.ChatID, &e.SenderID, &e.Text); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Entry{}, err
+		}
+		return Entry{}, fmt.Errorf("history: scan: %w", err)
+	}
+	e.Time, _ = time.Parse(time.RFC3339, ts)
+	return e, nil
+}
+
+// Prune deletes inputs and outputs recorded before cutoff and, with maxRows
+// above zero, all but the newest maxRows of each. A zero cutoff keeps rows of
+// any age. It returns the number of rows deleted.
+func (h *History) Prune(cutoff time.Time, maxRows int) (int64, error) {
+	var total int64
+	for _, table := range []string{"cmd_history", "cmd_output"} {
+		if !cutoff.IsZero() {
+			res, err := h.db.Exec(`DELETE FROM `+table+` WHERE ts < ?`, cutoff.UTC().Format(tsLayout))
+			if err != nil {
+				return total, fmt.Errorf("history: prune %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+		if maxRows > 0 {
+			res, err := h.db.Exec(`DELETE FROM `+table+` WHERE id <= (SELECT id FROM `+table+` ORDER BY id DESC LIMIT 1 OFFSET ?)`, maxRows)
+			if err != nil {
+				return total, fmt.Errorf("history: prune %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+	}
+	return total, nil
+}
+
 // Close closes the underlying database connection.
 func (h *History) Close() error {
 	return h.db.Close()
@@ -0,0 +1,150 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Backend is a destination for recorded inputs and outputs. *History is the
+// SQLite backend; only it can be read back.
+type Backend interface {
+	Record(channel, chatID, senderID, text string) error
+	RecordOutput(channel, chatID, session, text string) error
+	Close() error
+}
+
+// Pruner is a backend that can drop old records: those before cutoff (unless
+// zero) and all but the newest maxRows inputs and maxRows outputs (unless 0).
+// It returns how many were dropped.
+type Pruner interface {
+	Prune(cutoff time.Time, maxRows int) (int64, error)
+}
+
+// Line is one record written by the JSONL and syslog backends.
+type Line struct {
+	Type      string `json:"type"` // "input" or "output"
+	Time      string `json:"time"`
+	Channel   string `json:"channel"`
+	ChatID    string `json:"chat_id"`
+	SenderID  string `json:"sender_id,omitempty"` // inputs only
+	Session   string `json:"session,omitempty"`   // outputs only
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func inputLine(channel, chatID, senderID, text string) Line {
+	return Line{Type: "input", Time: time.Now().UTC().Format(tsLayout), Channel: channel, ChatID: chatID, SenderID: senderID, Text: text}
+}
+
+func outputLine(channel, chatID, session, text string) Line {
+	return Line{Type: "output", Time: time.Now().UTC().Format(tsLayout), Channel: channel, ChatID: chatID, Session: session, Text: text}
+}
+
+// JSONL appends one JSON object per line to a file, for log shippers that
+// tail files.
+type JSONL struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONL opens path for appending, creating it with mode 0600.
+func NewJSONL(path string) (*JSONL, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("history: open jsonl: %w", err)
+	}
+	return &JSONL{path: path, f: f}, nil
+}
+
+// Record appends an input line. It is safe to call concurrently.
+func (j *JSONL) Record(channel, chatID, senderID, text string) error {
+	return j.write(inputLine(channel, chatID, senderID, text))
+}
+
+// RecordOutput appends an output line.
+func (j *JSONL) RecordOutput(channel, chatID, session, text string) error {
+	return j.write(outputLine(channel, chatID, session, text))
+}
+
+func (j *JSONL) write(l Line) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// One write per line, so lines stay whole when another process appends.
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+// Prune rewrites the file without the dropped lines and replaces it by
+// rename, as log rotation does. Lines that cannot be parsed are kept.
+func (j *JSONL) Prune(cutoff time.Time, maxRows int) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return 0, fmt.Errorf("history: prune jsonl: %w", err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	drop := make([]bool, len(lines))
+	kept := map[string]int{} // type → newer lines kept, counted from the end
+	var n int64
+	for i := len(lines) - 1; i >= 0; i-- {
+		var l Line
+		if json.Unmarshal(lines[i], &l) != nil {
+			continue
+		}
+		t, err := time.Parse(tsLayout, l.Time)
+		if (err == nil && !cutoff.IsZero() && t.Before(cutoff)) || (maxRows > 0 && kept[l.Type] >= maxRows) {
+			drop[i] = true
+			n++
+			continue
+		}
+		kept[l.Type]++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return 0, fmt.Errorf("history: prune jsonl: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	for i, line := range lines {
+		if drop[i] {
+			continue
+		}
+		if _, err := tmp.Write(line); err != nil {
+			tmp.Close()
+			return 0, fmt.Errorf("history: prune jsonl: %w", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("history: prune jsonl: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return 0, fmt.Errorf("history: prune jsonl: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return n, fmt.Errorf("history: reopen jsonl: %w", err)
+	}
+	j.f.Close()
+	j.f = f
+	return n, nil
+}
+
+// Close closes the file.
+func (j *JSONL) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,59 @@
+package history
+
+import "errors"
+
+// multi writes to several backends at once.
+type multi []Backend
+
+// readableMulti is a multi whose reads go to reader.
+type readableMulti struct {
+	multi
+	reader interface {
+		Query(f Filter) ([]Entry, error)
+		Get(id int64) (Entry, error)
+	}
+}
+
+// NewMulti returns a backend that writes to all of backends. A failing backend
+// does not keep the others from being written. If one of them can be read
+// back, as *History can, the result can too.
+func NewMulti(backends ...Backend) Backend {
+	m := multi(backends)
+	for _, b := range backends {
+		if r, ok := b.(interface {
+			Query(f Filter) ([]Entry, error)
+			Get(id int64) (Entry, error)
+		}); ok {
+			return &readableMulti{multi: m, reader: r}
+		}
+	}
+	return m
+}
+
+func (m multi) Record(channel, chatID, senderID, text string) error {
+	var errs []error
+	for _, b := range m {
+		errs = append(errs, b.Record(channel, chatID, senderID, text))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) RecordOutput(channel, chatID, session, text string) error {
+	var errs []error
+	for _, b := range m {
+		errs = append(errs, b.RecordOutput(channel, chatID, session, text))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) Close() error {
+	var errs []error
+	for _, b := range m {
+		errs = append(errs, b.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *readableMulti) Query(f Filter) ([]Entry, error) { return m.reader.Query(f) }
+
+func (m *readableMulti) Get(id int64) (Entry, error) { return m.reader.Get(id) }
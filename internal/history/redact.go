@@ -0,0 +1,71 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Redacted replaces secrets in recorded text.
+const Redacted = "[REDACTED]"
+
+// BuiltinRedactions catch common credentials. For a pattern with a capture
+// group only the first group is replaced, so the key name stays readable.
+var BuiltinRedactions = []string{
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,                                              // AWS access key ID
+	`(?i)aws_secret_access_key\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`,               // AWS secret key
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,                                             // GitHub token
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,                                           // GitHub fine-grained token
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}`,                                             // Slack token
+	`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,                     // JWT
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`, // private key block
+}
+
+// Redactor removes secrets from text before it is recorded.
+type Redactor struct {
+	res []*regexp.Regexp
+}
+
+// NewRedactor compiles patterns, plus BuiltinRedactions if builtin is set.
+func NewRedactor(patterns []string, builtin bool) (*Redactor, error) {
+	all := patterns
+	if builtin {
+		all = append(append([]string{}, BuiltinRedactions...), patterns...)
+	}
+	r := &Redactor{}
+	for _, p := range all {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.res = append(r.res, re)
+	}
+	return r, nil
+}
+
+// Redact returns text with every match replaced by Redacted. A nil Redactor
+// returns text unchanged.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, re := range r.res {
+		if re.NumSubexp() == 0 {
+			text = re.ReplaceAllLiteralString(text, Redacted)
+			continue
+		}
+		var out []byte
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			if m[2] < 0 {
+				continue
+			}
+			out = append(out, text[last:m[2]]...)
+			out = append(out, Redacted...)
+			last = m[3]
+		}
+		if out != nil {
+			text = string(append(out, text[last:]...))
+		}
+	}
+	return text
+}
@@ -0,0 +1,75 @@
+//go:build !windows && !plan9
+
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// maxSyslogText is where pane output is cut in syslog records; larger
+// messages are dropped by many relays.
+const maxSyslogText = 4096
+
+var facilities = map[string]syslog.Priority{
+	"user": syslog.LOG_USER, "daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "authpriv": syslog.LOG_AUTHPRIV,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2, "local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5, "local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// Syslog sends each record as a JSON message to syslog. With an empty
+// network it uses the local daemon, which is journald on systemd hosts;
+// network "udp" or "tcp" sends to a remote collector at address.
+type Syslog struct {
+	w *syslog.Writer
+}
+
+// NewSyslog connects to syslog. tag defaults to "im2code" and facility to
+// "user".
+func NewSyslog(network, address, tag, facility string) (*Syslog, error) {
+	if tag == "" {
+		tag = "im2code"
+	}
+	if facility == "" {
+		facility = "user"
+	}
+	prio, ok := facilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("history: unknown syslog facility %q", facility)
+	}
+	w, err := syslog.Dial(network, address, prio|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("history: connect to syslog: %w", err)
+	}
+	return &Syslog{w: w}, nil
+}
+
+// Record sends an input at info level.
+func (s *Syslog) Record(channel, chatID, senderID, text string) error {
+	b, err := json.Marshal(inputLine(channel, chatID, senderID, text))
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(b))
+}
+
+// RecordOutput sends an output at info level, cut to maxSyslogText bytes.
+func (s *Syslog) RecordOutput(channel, chatID, session, text string) error {
+	l := outputLine(channel, chatID, session, text)
+	if len(l.Text) > maxSyslogText {
+		l.Text = strings.ToValidUTF8(l.Text[:maxSyslogText], "")
+		l.Truncated = true
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(b))
+}
+
+// Close closes the connection.
+func (s *Syslog) Close() error {
+	return s.w.Close()
+}
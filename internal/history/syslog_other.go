@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package history
+
+import "errors"
+
+// Syslog is not available on this platform.
+type Syslog struct{ Backend }
+
+// NewSyslog always fails: there is no syslog here.
+func NewSyslog(network, address, tag, facility string) (*Syslog, error) {
+	return nil, errors.New("history: syslog is not supported on this platform")
+}
@@ -0,0 +1,198 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is one step of a transcript: an input from chat or the pane output
+// sent back.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Output   bool      `json:"output"`
+	Channel  string    `json:"channel"`
+	ChatID   string    `json:"chat_id"`
+	SenderID string    `json:"sender_id,omitempty"` // inputs only
+	Session  string    `json:"session,omitempty"`   // outputs only
+	Text     string    `json:"text"`
+}
+
+// TranscriptFilter selects a transcript: one chat (Channel and ChatID) or one
+// session, within [Since, Until). Zero times are open ends. A session includes
+// output of its windows and panes; a session:window.pane target selects only
+// output recorded under exactly that target.
+type TranscriptFilter struct {
+	Channel string
+	ChatID  string
+	Session string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Transcript returns the inputs and outputs matching f in time order. For a
+// session it is the output of that session and the inputs it is linked to.
+func (h *History) Transcript(f TranscriptFilter) ([]Event, error) {
+	if f.Session == "" && (f.Channel == "" || f.ChatID == "") {
+		return nil, fmt.Errorf("history: transcript needs a chat or a session")
+	}
+	var timeWhere string
+	var timeArgs []any
+	if !f.Since.IsZero() {
+		timeWhere += " AND ts >= ?"
+		timeArgs = append(timeArgs, f.Since.UTC().Format(tsLayout))
+	}
+	if !f.Until.IsZero() {
+		timeWhere += " AND ts < ?"
+		timeArgs = append(timeArgs, f.Until.UTC().Format(tsLayout))
+	}
+
+	var inQ, outQ string
+	var inArgs, outArgs []any
+	if f.Session != "" {
+		const sessionWhere = `(session = ? OR substr(session, 1, length(?) + 1) = ? || ':')`
+		sessionArgs := []any{f.Session, f.Session, f.Session}
+		outQ = `SELECT ts, channel, chat_id, session, text FROM cmd_output WHERE ` + sessionWhere + timeWhere
+		outArgs = append(sessionArgs, timeArgs...)
+		inQ = `SELECT ts, channel, chat_id, sender_id, text FROM cmd_history
+			WHERE id IN (SELECT input_id FROM cmd_output WHERE ` + sessionWhere + timeWhere + `)` + timeWhere
+		inArgs = append(append(append([]any{}, sessionArgs...), timeArgs...), timeArgs...)
+	} else {
+		outQ = `SELECT ts, channel, chat_id, session, text FROM cmd_output WHERE channel = ? AND chat_id = ?` + timeWhere
+		outArgs = append([]any{f.Channel, f.ChatID}, timeArgs...)
+		inQ = `SELECT ts, channel, chat_id, sender_id, text FROM cmd_history WHERE channel = ? AND chat_id = ?` + timeWhere
+		inArgs = outArgs
+	}
+
+	var events []Event
+	for _, q := range []struct {
+		sql    string
+		args   []any
+		output bool
+	}{{inQ, inArgs, false}, {outQ, outArgs, true}} {
+		rows, err := h.db.Query(q.sql, q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("history: transcript: %w", err)
+		}
+		for rows.Next() {
+			e := Event{Output: q.output}
+			var ts, who string
+			if err := rows.Scan(&ts, &e.Channel, &e.ChatID, &who, &e.Text); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("history: transcript: %w", err)
+			}
+			e.Time, _ = time.Parse(time.RFC3339, ts)
+			if q.output {
+				e.Session = who
+			} else {
+				e.SenderID = who
+			}
+			events = append(events, e)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("history: transcript: %w", err)
+		}
+	}
+	// Stable: an input and its output recorded in the same millisecond keep
+	// input first.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+// WriteMarkdown writes events as a Markdown document titled title.
+func WriteMarkdown(w io.Writer, title string, events []Event) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	for _, e := range events {
+		ts := e.Time.Local().Format("2006-01-02 15:04:05")
+		if e.Output {
+			fmt.Fprintf(&b, "\n**%s** — output of `%s` to %s:%s\n\n", ts, e.Session, e.Channel, e.ChatID)
+			fence := "```"
+			for strings.Contains(e.Text, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "%s\n%s\n%s\n", fence, e.Text, fence)
+		} else {
+			fmt.Fprintf(&b, "\n**%s** — %s in %s:%s\n\n", ts, e.SenderID, e.Channel, e.ChatID)
+			for _, line := range strings.Split(e.Text, "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes events as a standalone HTML page titled title.
+func WriteHTML(w io.Writer, title string, events []Event) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%s</title>
+<style>
+body{font-family:sans-serif;max-width:60em;margin:2em auto;color:#222}
+.meta{color:#777;font-size:.85em;margin-top:1.2em}
+.in{background:#eef4ff;border-left:3px solid #36c;padding:.3em .6em;white-space:pre-wrap;font-family:monospace}
+pre{background:#1e1e1e;color:#ddd;padding:.6em;overflow-x:auto}
+</style></head><body>
+<h1>%s</h1>
+`, html.EscapeString(title), html.EscapeString(title))
+	for _, e := range events {
+		ts := e.Time.Local().Format("2006-01-02 15:04:05")
+		if e.Output {
+			fmt.Fprintf(&b, "<div class=\"meta\">%s — output of %s to %s:%s</div>\n<pre>%s</pre>\n",
+				ts, html.EscapeString(e.Session), html.EscapeString(e.Channel), html.EscapeString(e.ChatID), html.EscapeString(e.Text))
+		} else {
+			fmt.Fprintf(&b, "<div class=\"meta\">%s — %s in %s:%s</div>\n<div class=\"in\">%s</div>\n",
+				ts, html.EscapeString(e.SenderID), html.EscapeString(e.Channel), html.EscapeString(e.ChatID), html.EscapeString(e.Text))
+		}
+	}
+	b.WriteString("</body></html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteAsciicast writes events as an asciicast v2 recording for asciinema
+// play. Each output is drawn on a cleared screen, as the chat showed it;
+// inputs are "i" events.
+func WriteAsciicast(w io.Writer, title string, events []Event) error {
+	width, height := 80, 24
+	for _, e := range events {
+		if !e.Output {
+			continue
+		}
+		lines := strings.Split(e.Text, "\n")
+		height = max(height, len(lines)+1)
+		for _, l := range lines {
+			width = max(width, len([]rune(l)))
+		}
+	}
+	header := map[string]any{"version": 2, "width": width, "height": height, "title": title}
+	var start time.Time
+	if len(events) > 0 {
+		start = events[0].Time
+		header["timestamp"] = start.Unix()
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, e := range events {
+		at := e.Time.Sub(start).Seconds()
+		var ev []any
+		if e.Output {
+			ev = []any{at, "o", "\x1b[2J\x1b[H" + strings.ReplaceAll(e.Text, "\n", "\r\n")}
+		} else {
+			ev = []any{at, "i", e.Text + "\r"}
+		}
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package render draws terminal pane captures as PNG images. SGR colors
+// (16, 256 and 24-bit) and the bold, dim, underline and reverse attributes
+// are honoured; text is set in the bundled Go Mono font.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	fontSize = 14
+	padding  = 8
+	maxCols  = 300
+	tabWidth = 8
+)
+
+var (
+	defaultFG = color.RGBA{0xd4, 0xd4, 0xd4, 0xff}
+	defaultBG = color.RGBA{0x1e, 0x1e, 0x1e, 0xff}
+)
+
+// style is the SGR state applied to a cell.
+type style struct {
+	fg, bg    color.RGBA
+	fgIndex   int // palette index for 30–37 so bold can brighten it; -1 otherwise
+	bold      bool
+	dim       bool
+	underline bool
+	reverse   bool
+}
+
+func defaultStyle() style {
+	return style{fg: defaultFG, bg: defaultBG, fgIndex: -1}
+}
+
+type cell struct {
+	r     rune
+	st    style
+	width int // 1, or 2 for wide runes; 0 for the trailing half of a wide rune
+}
+
+type faces struct {
+	regular, bold font.Face
+	cellW, cellH  int
+	ascent        int
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *faces
+	loadErr  error
+)
+
+func loadFaces() (*faces, error) {
+	loadOnce.Do(func() {
+		newFace := func(ttf []byte) (font.Face, error) {
+			f, err := opentype.Parse(ttf)
+			if err != nil {
+				return nil, err
+			}
+			return opentype.NewFace(f, &opentype.FaceOptions{Size: fontSize, DPI: 72, Hinting: font.HintingFull})
+		}
+		regular, err := newFace(gomono.TTF)
+		if err != nil {
+			loadErr = fmt.Errorf("render: %w", err)
+			return
+		}
+		bold, err := newFace(gomonobold.TTF)
+		if err != nil {
+			loadErr = fmt.Errorf("render: %w", err)
+			return
+		}
+		adv, _ := regular.GlyphAdvance('M')
+		m := regular.Metrics()
+		loaded = &faces{
+			regular: regular,
+			bold:    bold,
+			cellW:   adv.Ceil(),
+			cellH:   m.Height.Ceil(),
+			ascent:  m.Ascent.Ceil(),
+		}
+	})
+	return loaded, loadErr
+}
+
+// PNG renders raw, the output of `tmux capture-pane -e`, as a PNG image.
+func PNG(raw string) ([]byte, error) {
+	f, err := loadFaces()
+	if err != nil {
+		return nil, err
+	}
+	grid := parse(raw)
+	cols := 20
+	for _, row := range grid {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	rows := len(grid)
+	if rows == 0 {
+		rows = 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cols*f.cellW+2*padding, rows*f.cellH+2*padding))
+	draw.Draw(img, img.Bounds(), image.NewUniform(defaultBG), image.Point{}, draw.Src)
+
+	for y, row := range grid {
+		top := padding + y*f.cellH
+		for x, c := range row {
+			if c.width == 0 {
+				continue
+			}
+			fg, bg := c.st.colors()
+			left := padding + x*f.cellW
+			rect := image.Rect(left, top, left+c.width*f.cellW, top+f.cellH)
+			if bg != defaultBG {
+				draw.Draw(img, rect, image.NewUniform(bg), image.Point{}, draw.Src)
+			}
+			if c.r != ' ' {
+				face := f.regular
+				if c.st.bold {
+					face = f.bold
+				}
+				d := font.Drawer{
+					Dst:  img,
+					Src:  image.NewUniform(fg),
+					Face: face,
+					Dot:  fixed.P(left, top+f.ascent),
+				}
+				d.DrawString(string(c.r))
+			}
+			if c.st.underline {
+				uy := top + f.ascent + 2
+				draw.Draw(img, image.Rect(left, uy, rect.Max.X, uy+1), image.NewUniform(fg), image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("render: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// colors resolves the cell's final foreground and background.
+func (s style) colors() (fg, bg color.RGBA) {
+	fg, bg = s.fg, s.bg
+	if s.bold && s.fgIndex >= 0 && s.fgIndex < 8 {
+		fg = palette(s.fgIndex + 8)
+	}
+	if s.dim {
+		fg = color.RGBA{fg.R / 2, fg.G / 2, fg.B / 2, 0xff}
+	}
+	if s.reverse {
+		fg, bg = bg, fg
+	}
+	return fg, bg
+}
+
+// parse splits raw into rows of cells, interpreting SGR sequences and
+// dropping every other escape or control sequence.
+func parse(raw string) [][]cell {
+	lines := strings.Split(strings.TrimRight(raw, "\n"), "\n")
+	grid := make([][]cell, 0, len(lines))
+	st := defaultStyle()
+	for _, line := range lines {
+		var row []cell
+		rs := []rune(line)
+		for i := 0; i < len(rs); i++ {
+			r := rs[i]
+			switch {
+			case r == 0x1b && i+1 < len(rs) && rs[i+1] == '[':
+				j := i + 2
+				for j < len(rs) && (rs[j] < 0x40 || rs[j] > 0x7e) {
+					j++
+				}
+				if j < len(rs) && rs[j] == 'm' {
+					st = applySGR(st, string(rs[i+2:j]))
+				}
+				i = j
+			case r == 0x1b && i+1 < len(rs) && rs[i+1] == ']':
+				// OSC: skip to BEL or ST (ESC \).
+				j := i + 2
+				for j < len(rs) && rs[j] != 0x07 && !(rs[j] == 0x1b && j+1 < len(rs) && rs[j+1] == '\\') {
+					j++
+				}
+				if j < len(rs) && rs[j] == 0x1b {
+					j++
+				}
+				i = j
+			case r == 0x1b:
+				i++ // two-character escape
+			case r == '\t':
+				for n := tabWidth - len(row)%tabWidth; n > 0; n-- {
+					row = append(row, cell{r: ' ', st: st, width: 1})
+				}
+			case r < 0x20 || r == 0x7f:
+				// other control characters are not printable
+			case isWide(r):
+				row = append(row, cell{r: r, st: st, width: 2}, cell{st: st})
+			default:
+				row = append(row, cell{r: r, st: st, width: 1})
+			}
+			if len(row) > maxCols {
+				row = row[:maxCols]
+			}
+		}
+		grid = append(grid, row)
+	}
+	// Drop trailing blank rows: tmux pads captures to the pane height.
+	for len(grid) > 1 && blank(grid[len(grid)-1]) {
+		grid = grid[:len(grid)-1]
+	}
+	return grid
+}
+
+func blank(row []cell) bool {
+	for _, c := range row {
+		if (c.r != ' ' && c.width != 0) || c.st.bg != defaultBG {
+			return false
+		}
+	}
+	return true
+}
+
+func applySGR(st style, params string) style {
+	if params == "" {
+		return defaultStyle()
+	}
+	ps := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	num := func(i int) int {
+		if i >= len(ps) {
+			return 0
+		}
+		n, _ := strconv.Atoi(ps[i])
+		return n
+	}
+	for i := 0; i < len(ps); i++ {
+		switch n := num(i); {
+		case n == 0:
+			st = defaultStyle()
+		case n == 1:
+			st.bold = true
+		case n == 2:
+			st.dim = true
+		case n == 4:
+			st.underline = true
+		case n == 7:
+			st.reverse = true
+		case n == 22:
+			st.bold, st.dim = false, false
+		case n == 24:
+			st.underline = false
+		case n == 27:
+			st.reverse = false
+		case n >= 30 && n <= 37:
+			st.fg, st.fgIndex = palette(n-30), n-30
+		case n == 39:
+			st.fg, st.fgIndex = defaultFG, -1
+		case n >= 40 && n <= 47:
+			st.bg = palette(n - 40)
+		case n == 49:
+			st.bg = defaultBG
+		case n >= 90 && n <= 97:
+			st.fg, st.fgIndex = palette(n-90+8), -1
+		case n >= 100 && n <= 107:
+			st.bg = palette(n - 100 + 8)
+		case n == 38 || n == 48:
+			var c color.RGBA
+			switch num(i + 1) {
+			case 5:
+				c = palette(num(i + 2))
+				i += 2
+			case 2:
+				c = color.RGBA{uint8(num(i + 2)), uint8(num(i + 3)), uint8(num(i + 4)), 0xff}
+				i += 4
+			default:
+				continue
+			}
+			if n == 38 {
+				st.fg, st.fgIndex = c, -1
+			} else {
+				st.bg = c
+			}
+		}
+	}
+	return st
+}
+
+var basic16 = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, {0xcd, 0x31, 0x31, 0xff}, {0x0d, 0xbc, 0x79, 0xff}, {0xe5, 0xe5, 0x10, 0xff},
+	{0x24, 0x72, 0xc8, 0xff}, {0xbc, 0x3f, 0xbc, 0xff}, {0x11, 0xa8, 0xcd, 0xff}, {0xe5, 0xe5, 0xe5, 0xff},
+	{0x66, 0x66, 0x66, 0xff}, {0xf1, 0x4c, 0x4c, 0xff}, {0x23, 0xd1, 0x8b, 0xff}, {0xf5, 0xf5, 0x43, 0xff},
+	{0x3b, 0x8e, 0xea, 0xff}, {0xd6, 0x70, 0xd6, 0xff}, {0x29, 0xb8, 0xdb, 0xff}, {0xff, 0xff, 0xff, 0xff},
+}
+
+// palette returns xterm-256 color n.
+func palette(n int) color.RGBA {
+	switch {
+	case n < 0 || n > 255:
+		return defaultFG
+	case n < 16:
+		return basic16[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) uint8 {
+			if v == 0 {
+				return 0
+			}
+			return uint8(55 + v*40)
+		}
+		return color.RGBA{level(n / 36), level(n / 6 % 6), level(n % 6), 0xff}
+	default:
+		g := uint8(8 + (n-232)*10)
+		return color.RGBA{g, g, g, 0xff}
+	}
+}
+
+// isWide reports whether r occupies two terminal cells (CJK, Hangul,
+// full-width forms and most emoji).
+func isWide(r rune) bool {
+	return (r >= 0x1100 && r <= 0x115f) ||
+		(r >= 0x2e80 && r <= 0xa4cf && r != 0x303f) ||
+		(r >= 0xac00 && r <= 0xd7a3) ||
+		(r >= 0xf900 && r <= 0xfaff) ||
+		(r >= 0xfe30 && r <= 0xfe4f) ||
+		(r >= 0xff00 && r <= 0xff60) ||
+		(r >= 0xffe0 && r <= 0xffe6) ||
+		(r >= 0x1f300 && r <= 0x1faff) ||
+		(r >= 0x20000 && r <= 0x3fffd)
+}
+
+// WriteFile stores png in dir under a unique name and returns its path, for
+// use in OutboundMessage.Media. Images older than an hour are removed first,
+// so dir does not grow without bound.
+func WriteFile(dir string, png []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+				os.Remove(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	f, err := os.CreateTemp(dir, "shot-*.png")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(png); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,80 @@
+package render_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/render"
+)
+
+func decode(t *testing.T, raw string) image.Image {
+	t.Helper()
+	data, err := render.PNG(raw)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return img
+}
+
+func rgba(c color.Color) color.RGBA {
+	r, g, b, a := c.RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+func TestPNG_Colors(t *testing.T) {
+	// Line 1: red background ("41"), line 2: 24-bit blue background.
+	img := decode(t, "\x1b[41m    \x1b[0m plain\n\x1b[48;2;0;0;255m    \x1b[m\n\n\n")
+
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		t.Fatalf("empty image: %v", b)
+	}
+	// Trailing blank lines are trimmed: two text rows remain.
+	rowH := (b.Dy() - 16) / 2
+
+	if got := rgba(img.At(10, 8+rowH/2)); got.R < 0xa0 || got.G > 0x60 || got.B > 0x60 {
+		t.Errorf("red cell rendered as %v", got)
+	}
+	if got := rgba(img.At(10, 8+rowH+rowH/2)); got.B != 0xff || got.R != 0 {
+		t.Errorf("blue cell rendered as %v", got)
+	}
+}
+
+func TestPNG_WideAndControl(t *testing.T) {
+	narrow := decode(t, "ab")
+	wide := decode(t, "中文\x1b]0;title\x07\x1b(B")
+	// Two wide runes take four cells; OSC and charset escapes take none. Both
+	// are under the 20-column minimum, so widths match.
+	if narrow.Bounds().Dx() != wide.Bounds().Dx() {
+		t.Errorf("widths differ: %d vs %d", narrow.Bounds().Dx(), wide.Bounds().Dx())
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "shot-old.png")
+	os.WriteFile(stale, []byte("x"), 0600)
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	path, err := render.WriteFile(dir, []byte("png"))
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "png" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale image was not pruned")
+	}
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/tmux"
+)
+
+// SessionACL restricts the tmux sessions chats may use. Rules maps
+// "channel:id" — a sender ID or a chat ID — to session patterns. A sender's
+// rule takes precedence over the chat's, so a permissive chat does not widen
+// a restricted sender; Default applies when neither has a rule. With no
+// Default and no Rules every session is allowed.
+//
+// A pattern is a glob ("dev-*"), or a regular expression after "re:"
+// ("re:^ci-[0-9]+$"); both must match the whole session name.
+type SessionACL struct {
+	Default []string
+	Rules   map[string][]string
+}
+
+// sessionMatcher is a compiled SessionACL.
+type sessionMatcher struct {
+	def   []func(string) bool
+	rules map[string][]func(string) bool
+}
+
+func compilePatterns(patterns []string) ([]func(string) bool, error) {
+	out := make([]func(string) bool, 0, len(patterns))
+	for _, p := range patterns {
+		if expr, ok := strings.CutPrefix(p, "re:"); ok {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("session pattern %q: %w", p, err)
+			}
+			out = append(out, re.MatchString)
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("session pattern %q: %w", p, err)
+		}
+		out = append(out, func(session string) bool {
+			ok, _ := path.Match(p, session)
+			return ok
+		})
+	}
+	return out, nil
+}
+
+// SetSessionACL replaces the session ACL, e.g. from config on startup or
+// reload. It fails without changing anything if a pattern is invalid.
+func (r *Router) SetSessionACL(acl SessionACL) error {
+	var m *sessionMatcher
+	if len(acl.Default) > 0 || len(acl.Rules) > 0 {
+		def, err := compilePatterns(acl.Default)
+		if err != nil {
+			return err
+		}
+		m = &sessionMatcher{def: def, rules: make(map[string][]func(string) bool, len(acl.Rules))}
+		for key, patterns := range acl.Rules {
+			if m.rules[key], err = compilePatterns(patterns); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acl = m
+	return nil
+}
+
+// SessionAllowed reports whether the session ACL lets senderID use target's
+// session from chat ("channel:chatID"). An empty senderID checks the chat
+// alone, as for attaches through the control socket.
+func (r *Router) SessionAllowed(chat, senderID, target string) bool {
+	session := tmux.SessionOf(target)
+	r.mu.RLock()
+	m := r.acl
+	r.mu.RUnlock()
+	if m == nil {
+		return true
+	}
+	patterns, found := m.rules[chat]
+	if senderID != "" {
+		ch, _, _ := strings.Cut(chat, ":")
+		if p, ok := m.rules[ch+":"+senderID]; ok {
+			patterns, found = p, true
+		}
+	}
+	if !found {
+		patterns = m.def
+	}
+	for _, match := range patterns {
+		if match(session) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedSessions filters sessions down to those senderID may use from chat.
+func (r *Router) allowedSessions(chat, senderID string, sessions []string) []string {
+	var out []string
+	for _, s := range sessions {
+		if r.SessionAllowed(chat, senderID, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// boundSession returns the session msg's chat is bound to. When there is
+// none, or the session ACL does not allow it (it may have changed since the
+// attach), it replies to msg and returns false.
+func (r *Router) boundSession(msg channel.InboundMessage) (string, bool) {
+	session, ok := r.subs.Get(chatKey(msg))
+	if !ok {
+		r.reply(msg, "Not attached to any session.")
+		return "", false
+	}
+	if !r.SessionAllowed(chatKey(msg), msg.SenderID, session) {
+		r.reply(msg, fmt.Sprintf("Session %q is not allowed for you here.", session))
+		return "", false
+	}
+	return session, true
+}
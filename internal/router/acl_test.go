@@ -0,0 +1,107 @@
+package router_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+func TestSessionACL_Allowed(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if !r.SessionAllowed("telegram:1", "u1", "prod") {
+		t.Error("expected every session to be allowed without an ACL")
+	}
+
+	err := r.SetSessionACL(router.SessionACL{
+		Default: []string{"dev-*"},
+		Rules: map[string][]string{
+			"telegram:admin": {"*"},
+			"slack:C42":      {`re:ci-[0-9]+`},
+			"slack:C7":       {"*"},
+			"slack:intern":   {"dev-*"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		chat, sender, session string
+		want                  bool
+	}{
+		{"telegram:1", "u1", "dev-api", true},
+		{"telegram:1", "u1", "prod", false},
+		{"telegram:1", "admin", "prod", true},     // sender rule
+		{"slack:C42", "u1", "ci-17", true},        // chat rule
+		{"slack:C42", "u1", "ci-17x", false},      // regexps match the whole name
+		{"slack:C42", "u1", "dev-api", false},     // a rule replaces the default
+		{"slack:C42", "", "ci-3", true},           // control socket: chat only
+		{"discord:9", "admin", "prod", false},     // rules are per channel
+		{"slack:C7", "u1", "prod", true},          // a permissive chat
+		{"slack:C7", "intern", "prod", false},     // does not widen a restricted sender
+		{"slack:C7", "intern", "dev-api", true},   // the sender rule applies
+		{"telegram:1", "u1", "dev-api:1.0", true}, // a pane: its session is checked
+		{"telegram:1", "u1", "prod:dev-api", false},
+	}
+	for _, tt := range tests {
+		if got := r.SessionAllowed(tt.chat, tt.sender, tt.session); got != tt.want {
+			t.Errorf("SessionAllowed(%q, %q, %q) = %v, want %v", tt.chat, tt.sender, tt.session, got, tt.want)
+		}
+	}
+
+	if err := r.SetSessionACL(router.SessionACL{Default: []string{"re:("}}); err == nil {
+		t.Error("expected an invalid regexp to be rejected")
+	}
+	if r.SessionAllowed("telegram:1", "u1", "prod") {
+		t.Error("a rejected ACL must leave the previous one in place")
+	}
+}
+
+func TestSessionACL_AttachAndWatch(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	if err := r.SetSessionACL(router.SessionACL{Default: []string{"dev"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Text: "#attach prod", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "not allowed") {
+		t.Errorf("expected attach to be denied, got %q", msg.Text)
+	}
+	if _, ok := r.WatchedChats()["telegram:1"]; ok {
+		t.Error("denied attach must not bind the chat")
+	}
+
+	// A binding made before the ACL was tightened gets no watch pushes.
+	r.Attach("telegram:1", "dev")
+	r.SetWatch("telegram:1", true)
+	if got := r.WatchedChats()["telegram:1"]; got != "dev" {
+		t.Fatalf("expected dev to be watched, got %q", got)
+	}
+	if err := r.SetSessionACL(router.SessionACL{Default: []string{"other"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.WatchedChats()["telegram:1"]; ok {
+		t.Error("expected watch to be suppressed once the ACL denies the session")
+	}
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Text: "ls", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "not allowed") {
+		t.Errorf("expected input to a denied session to be refused, got %q", msg.Text)
+	}
+
+	// Nor can files be uploaded into the denied session's pane.
+	dir := t.TempDir()
+	r.SetUploadDir(dir)
+	path, err := channel.SaveUpload("notes.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Media: []string{path}, PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "not allowed") {
+		t.Errorf("expected an upload to a denied session to be refused, got %q", msg.Text)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected nothing saved, got %v", entries)
+	}
+}
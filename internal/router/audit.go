@@ -0,0 +1,40 @@
+package router
+
+import (
+	"log/slog"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+// Auditor receives privileged actions and their outcome.
+type Auditor interface {
+	Write(e audit.Event) error
+}
+
+// SetAuditor sets where privileged actions are recorded; nil turns auditing
+// off.
+func (r *Router) SetAuditor(a Auditor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auditor = a
+}
+
+// Audit records e, e.g. for actions taken through the control socket.
+func (r *Router) Audit(e audit.Event) {
+	r.mu.RLock()
+	a := r.auditor
+	r.mu.RUnlock()
+	if a == nil {
+		return
+	}
+	if err := a.Write(e); err != nil {
+		slog.Warn("audit: write failed", "action", e.Action, "err", err)
+	}
+}
+
+// audit records an action taken by msg's sender.
+func (r *Router) audit(msg channel.InboundMessage, e audit.Event) {
+	e.Actor, e.Channel, e.ChatID = msg.SenderID, msg.Channel, msg.ChatID
+	r.Audit(e)
+}
@@ -0,0 +1,65 @@
+package router_test
+
+import (
+	"testing"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+type memAudit struct{ events []audit.Event }
+
+func (m *memAudit) Write(e audit.Event) error {
+	m.events = append(m.events, e)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	log := &memAudit{}
+	r.SetAuditor(log)
+	if err := r.SetSessionACL(router.SessionACL{Default: []string{"dev"}}); err != nil {
+		t.Fatal(err)
+	}
+	r.SetRoles(map[string]string{"web:v": "viewer"})
+	send := func(sender, text string) {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: sender, Text: text})
+		select {
+		case <-outbound:
+		default:
+		}
+	}
+
+	send("mallory", "hello")
+	send("alice", "#im2code")
+	send("alice", "#attach prod")
+	send("alice", "#attach dev")
+	send("alice", "#setivl 5s,20s")
+	send("v", "#key ctrl-c")
+	send("alice", "#grant bob viewer")
+	send("alice", "#detach")
+
+	want := []struct{ actor, action, session, outcome string }{
+		{"mallory", "message", "", audit.Denied},
+		{"alice", "activate", "", audit.OK},
+		{"alice", "attach", "prod", audit.Denied},
+		{"alice", "attach", "dev", audit.OK},
+		{"alice", "setivl", "dev", audit.OK},
+		{"v", "key", "", audit.Denied},
+		{"alice", "grant", "", audit.OK},
+		{"alice", "detach", "dev", audit.OK},
+	}
+	if len(log.events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), log.events)
+	}
+	for i, w := range want {
+		e := log.events[i]
+		if e.Actor != w.actor || e.Action != w.action || e.Session != w.session || e.Outcome != w.outcome || e.Channel != "web" || e.ChatID != "c" {
+			t.Errorf("event %d: expected %+v, got %+v", i, w, e)
+		}
+	}
+	if args := log.events[6].Args; len(args) != 2 || args[0] != "bob" || args[1] != "viewer" {
+		t.Errorf("expected grant args bob viewer, got %v", args)
+	}
+}
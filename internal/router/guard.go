@@ -0,0 +1,188 @@
+package router
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"time"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+// GuardRules screen plain text before it is typed into tmux. Text matching a
+// Deny pattern is never sent; text matching a Confirm pattern is held until
+// the sender replies "#confirm <code>" within Timeout. Patterns are regular
+// expressions searched anywhere in the message.
+type GuardRules struct {
+	Deny    []string
+	Confirm []string
+	Timeout time.Duration
+}
+
+// DefaultConfirmTimeout applies when GuardRules.Timeout is not positive.
+const DefaultConfirmTimeout = time.Minute
+
+type guard struct {
+	deny, confirm []*regexp.Regexp
+	timeout       time.Duration
+}
+
+// pendingCommand is guarded text waiting for #confirm.
+type pendingCommand struct {
+	text    string
+	session string
+	code    string
+	expires time.Time
+	secret  bool // sent with #secret: not recorded
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("guard pattern %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// SetGuard replaces the dangerous-command rules, e.g. from config on startup
+// or reload. It fails without changing anything if a pattern is invalid.
+func (r *Router) SetGuard(rules GuardRules) error {
+	deny, err := compileRegexps(rules.Deny)
+	if err != nil {
+		return err
+	}
+	confirm, err := compileRegexps(rules.Confirm)
+	if err != nil {
+		return err
+	}
+	g := &guard{deny: deny, confirm: confirm, timeout: rules.Timeout}
+	if g.timeout <= 0 {
+		g.timeout = DefaultConfirmTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guard = g
+	return nil
+}
+
+func firstMatch(res []*regexp.Regexp, text string) *regexp.Regexp {
+	for _, re := range res {
+		if re.MatchString(text) {
+			return re
+		}
+	}
+	return nil
+}
+
+// guardText decides whether text may be sent to session now. Denied text is
+// dropped; text that needs confirmation is held and the sender is asked for
+// a code. Both outcomes are replied to and recorded in history.
+func (r *Router) guardText(msg channel.InboundMessage, session string, secret bool) bool {
+	r.mu.RLock()
+	g := r.guard
+	r.mu.RUnlock()
+	if g == nil {
+		return true
+	}
+	if re := firstMatch(g.deny, msg.Text); re != nil {
+		slog.Info("router: guard denied input", "chat", chatKey(msg), "senderID", msg.SenderID, "rule", re.String())
+		r.recordDecision(msg, "denied", msg.Text, secret)
+		r.audit(msg, audit.Event{Action: "input", Session: session, Outcome: audit.Denied, Detail: "guard deny rule " + re.String()})
+		r.reply(msg, fmt.Sprintf("Blocked: this matches the deny rule `%s` and was not sent.", re.String()))
+		return false
+	}
+	re := firstMatch(g.confirm, msg.Text)
+	if re == nil {
+		return true
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		r.reply(msg, fmt.Sprintf("Cannot create a confirmation code: %v", err))
+		return false
+	}
+	p := pendingCommand{
+		text:    msg.Text,
+		session: session,
+		code:    fmt.Sprintf("%04d", n.Int64()),
+		expires: time.Now().Add(g.timeout),
+		secret:  secret,
+	}
+	r.mu.Lock()
+	r.pending[senderKey(chatKey(msg), msg.SenderID)] = p
+	r.mu.Unlock()
+
+	slog.Info("router: guard holding input for confirmation", "chat", chatKey(msg), "senderID", msg.SenderID, "rule", re.String())
+	r.recordDecision(msg, "confirmation requested", msg.Text, secret)
+	r.reply(msg, fmt.Sprintf("This matches the confirm rule `%s`. Reply %sconfirm %s within %s to send it to %s.",
+		re.String(), r.Prefix(), p.code, g.timeout, session))
+	return false
+}
+
+// handleConfirm implements "#confirm <code>": it sends the sender's held
+// command if code matches. One wrong code discards the command.
+func (r *Router) handleConfirm(msg channel.InboundMessage, args []string) {
+	if len(args) != 1 {
+		r.reply(msg, fmt.Sprintf("Usage: %sconfirm <code>", r.Prefix()))
+		return
+	}
+	key := senderKey(chatKey(msg), msg.SenderID)
+	r.mu.Lock()
+	p, ok := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+
+	switch {
+	case !ok:
+		r.reply(msg, "Nothing to confirm.")
+		return
+	case time.Now().After(p.expires):
+		r.recordDecision(msg, "confirmation expired", p.text, p.secret)
+		r.audit(msg, audit.Event{Action: "confirm", Session: p.session, Outcome: audit.Denied, Detail: "code expired"})
+		r.reply(msg, "The confirmation code has expired; the command was not sent.")
+		return
+	case args[0] != p.code:
+		r.recordDecision(msg, "confirmation failed", p.text, p.secret)
+		r.audit(msg, audit.Event{Action: "confirm", Session: p.session, Outcome: audit.Denied, Detail: "wrong code"})
+		r.reply(msg, "Wrong code; the command was discarded.")
+		return
+	}
+
+	if session, bound := r.subs.Get(chatKey(msg)); !bound || session != p.session {
+		r.recordDecision(msg, "confirmation failed", p.text, p.secret)
+		r.audit(msg, audit.Event{Action: "confirm", Session: p.session, Outcome: audit.Denied, Detail: "chat no longer attached"})
+		r.reply(msg, fmt.Sprintf("This chat is no longer attached to %s; the command was not sent.", p.session))
+		return
+	}
+	if _, ok := r.boundSession(msg); !ok {
+		return
+	}
+	r.recordDecision(msg, "confirmed", p.text, p.secret)
+	if r.bridge == nil {
+		r.reply(msg, "[tmux bridge not available]")
+		return
+	}
+	r.markSensitive(p.session, p.secret)
+	if err := r.bridge.SendKeys(p.session, p.text); err != nil {
+		r.audit(msg, audit.Event{Action: "confirm", Session: p.session, Outcome: audit.Failed, Detail: err.Error()})
+		r.reply(msg, fmt.Sprintf("Error sending to tmux: %v", err))
+		return
+	}
+	r.audit(msg, audit.Event{Action: "confirm", Session: p.session, Outcome: audit.OK})
+	go r.snapAfterCommand(msg, p.session)
+}
+
+// recordDecision writes a guard decision about text to history; for secret
+// text only the decision is kept.
+func (r *Router) recordDecision(msg channel.InboundMessage, decision, text string, secret bool) {
+	if secret {
+		text = "(secret input)"
+	}
+	r.recordText(msg, "[guard "+decision+"] "+text)
+}
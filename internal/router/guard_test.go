@@ -0,0 +1,140 @@
+package router_test
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/config"
+	"github.com/dfbb/im2code/internal/router"
+	"github.com/dfbb/im2code/internal/state"
+)
+
+type memHistory struct {
+	mu      sync.Mutex
+	rows    []string
+	outputs []string
+}
+
+func (h *memHistory) Record(channel, chatID, senderID, text string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rows = append(h.rows, text)
+	return nil
+}
+
+func (h *memHistory) RecordOutput(channel, chatID, session, text string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outputs = append(h.outputs, text)
+	return nil
+}
+
+func (h *memHistory) outputCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.outputs)
+}
+
+func (h *memHistory) has(prefix string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, row := range h.rows {
+		if strings.HasPrefix(row, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newGuardedRouter(t *testing.T) (*router.Router, chan channel.OutboundMessage, *memHistory) {
+	t.Helper()
+	f, _ := os.CreateTemp("", "subs*.json")
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	subs, _ := state.NewSubscriptions(f.Name())
+	outbound := make(chan channel.OutboundMessage, 10)
+	hist := &memHistory{}
+	r := router.New("#", subs, nil, outbound, nil, hist, nil, 0, 0, 0)
+	err := r.SetGuard(router.GuardRules{
+		Deny:    []string{`rm\s+-rf\s+/$`},
+		Confirm: []string{`git\s+push\s+--force`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Attach("telegram:1", "dev")
+	return r, outbound, hist
+}
+
+func TestGuard_Deny(t *testing.T) {
+	r, outbound, hist := newGuardedRouter(t)
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Text: "rm -rf /", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Blocked") {
+		t.Errorf("expected deny reply, got %q", msg.Text)
+	}
+	if !hist.has("[guard denied] rm -rf /") {
+		t.Errorf("expected denial in history, got %v", hist.rows)
+	}
+}
+
+func TestGuard_Confirm(t *testing.T) {
+	r, outbound, hist := newGuardedRouter(t)
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Text: text, PreAuthorized: true})
+		return (<-outbound).Text
+	}
+
+	got := send("git push --force origin main")
+	code := regexp.MustCompile(`#confirm (\d{4})`).FindStringSubmatch(got)
+	if code == nil {
+		t.Fatalf("expected a confirmation code, got %q", got)
+	}
+	if got := send("#confirm " + code[1]); got != "[tmux bridge not available]" {
+		t.Errorf("expected the command to pass the guard, got %q", got)
+	}
+	if got := send("#confirm " + code[1]); got != "Nothing to confirm." {
+		t.Errorf("expected a code to work once, got %q", got)
+	}
+	if !hist.has("[guard confirmation requested]") || !hist.has("[guard confirmed] git push --force origin main") {
+		t.Errorf("expected guard decisions in history, got %v", hist.rows)
+	}
+
+	send("git push --force")
+	if got := send("#confirm 99999"); !strings.Contains(got, "Wrong code") {
+		t.Errorf("expected wrong code reply, got %q", got)
+	}
+	if !hist.has("[guard confirmation failed]") {
+		t.Errorf("expected failed confirmation in history, got %v", hist.rows)
+	}
+}
+
+func TestGuard_DefaultRules(t *testing.T) {
+	r, outbound, _ := newGuardedRouter(t)
+	g := config.Defaults().Guard
+	if err := r.SetGuard(router.GuardRules{Deny: g.Deny, Confirm: g.Confirm}); err != nil {
+		t.Fatal(err)
+	}
+	for text, guarded := range map[string]bool{
+		"rm -rf build":            true,
+		"rm -f a.out":             true,
+		"git push -f origin main": true,
+		"git reset --hard HEAD~1": true,
+		"sudo reboot":             true,
+		"dd if=x.iso of=/dev/sdb": true,
+		"ls -la":                  false,
+		"git push origin main":    false,
+		"rm notes.txt":            false,
+		"grep -r shutdown_hook .": false,
+	} {
+		r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Text: text, PreAuthorized: true})
+		got := strings.Contains((<-outbound).Text, "confirm rule")
+		if got != guarded {
+			t.Errorf("%q: guarded = %v, want %v", text, got, guarded)
+		}
+	}
+}
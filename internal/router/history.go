@@ -0,0 +1,143 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/history"
+)
+
+// HistoryReader is implemented by command histories that can be read back.
+// #history and #redo are unavailable without one.
+type HistoryReader interface {
+	Query(f history.Filter) ([]history.Entry, error)
+	Get(id int64) (history.Entry, error)
+}
+
+// OutputRecorder is implemented by command histories that also keep the pane
+// output sent to chats, for transcripts.
+type OutputRecorder interface {
+	RecordOutput(channel, chatID, session, text string) error
+}
+
+// RecordOutput stores pane output sent to chat ("channel:chatID"), if the
+// command history keeps output and the last input to session was not secret.
+func (r *Router) RecordOutput(chat, session, text string) {
+	rec, ok := r.history.(OutputRecorder)
+	if !ok || r.isSensitive(session) {
+		return
+	}
+	ch, chatID, _ := strings.Cut(chat, ":")
+	if err := rec.RecordOutput(ch, chatID, session, r.redact(text)); err != nil {
+		slog.Warn("history: record output failed", "err", err)
+	}
+}
+
+const (
+	defaultHistoryLines = 10
+	maxHistoryLines     = 50
+)
+
+func (r *Router) historyReader(msg channel.InboundMessage) (HistoryReader, bool) {
+	hr, ok := r.history.(HistoryReader)
+	if !ok {
+		r.reply(msg, "Command history is not available.")
+		return nil, false
+	}
+	return hr, true
+}
+
+// isInput reports whether a history row is text that was typed into the
+// terminal, as opposed to a bridge command or a guard decision.
+func (r *Router) isInput(text string) bool {
+	return !strings.HasPrefix(text, r.Prefix()) && !strings.HasPrefix(text, "[guard ")
+}
+
+// handleHistory implements "#history [n]": the chat's last n terminal inputs.
+func (r *Router) handleHistory(msg channel.InboundMessage, args []string) {
+	n := defaultHistoryLines
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			r.reply(msg, fmt.Sprintf("Usage: %shistory [n]", r.Prefix()))
+			return
+		}
+		n = min(v, maxHistoryLines)
+	}
+	hr, ok := r.historyReader(msg)
+	if !ok {
+		return
+	}
+	// Bridge commands are interleaved with inputs; read enough to skip them.
+	entries, err := hr.Query(history.Filter{Channel: msg.Channel, ChatID: msg.ChatID, Limit: n * 5})
+	if err != nil {
+		r.reply(msg, fmt.Sprintf("Reading history failed: %v", err))
+		return
+	}
+	var lines []string
+	for _, e := range entries {
+		if r.isInput(e.Text) {
+			lines = append(lines, fmt.Sprintf("  %d  %s  %s: %s", e.ID, e.Time.Local().Format("01-02 15:04"), e.SenderID, truncate(e.Text, 80)))
+		}
+	}
+	if len(lines) == 0 {
+		r.reply(msg, "No inputs recorded in this chat yet.")
+		return
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	r.reply(msg, "Recent inputs:\n"+strings.Join(lines, "\n")+fmt.Sprintf("\nSend %sredo <id> to run one again.", r.Prefix()))
+}
+
+// handleRedo implements "#redo <id>": an input from this chat's history is
+// sent to the bound session again, through the same checks as new text.
+func (r *Router) handleRedo(msg channel.InboundMessage, args []string) {
+	if len(args) != 1 {
+		r.reply(msg, fmt.Sprintf("Usage: %sredo <id>", r.Prefix()))
+		return
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		r.reply(msg, fmt.Sprintf("Usage: %sredo <id>", r.Prefix()))
+		return
+	}
+	hr, ok := r.historyReader(msg)
+	if !ok {
+		return
+	}
+	e, err := hr.Get(id)
+	if errors.Is(err, history.ErrNotFound) || (err == nil && (e.Channel != msg.Channel || e.ChatID != msg.ChatID)) {
+		r.reply(msg, fmt.Sprintf("No input %d in this chat's history.", id))
+		return
+	}
+	if err != nil {
+		r.reply(msg, fmt.Sprintf("Reading history failed: %v", err))
+		return
+	}
+	if !r.isInput(e.Text) {
+		r.reply(msg, fmt.Sprintf("Entry %d is not terminal input and cannot be redone.", id))
+		return
+	}
+	// The stored text is not what was typed: replaying it would type the
+	// placeholder, and the guard would never see the original.
+	if strings.Contains(e.Text, history.Redacted) {
+		r.reply(msg, fmt.Sprintf("Entry %d was recorded with secrets redacted and cannot be redone; send it again instead.", id))
+		return
+	}
+	redo := msg
+	redo.Text = e.Text
+	r.reply(msg, "Sending: "+truncate(e.Text, 200))
+	r.sendInput(redo, false)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
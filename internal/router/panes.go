@@ -0,0 +1,111 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/tmux"
+)
+
+// CheckTarget validates a target for a binding — a session, session:window or
+// session:window.pane — and returns it as it is to be bound. With a bridge the
+// target must exist, and tmux must resolve it into the named session; the
+// session ACL and TOTP protection are then checked against that name.
+func (r *Router) CheckTarget(target string) (string, error) {
+	session, rest, hasRest := strings.Cut(target, ":")
+	if session == "" || (hasRest && rest == "") {
+		return "", fmt.Errorf("expected session, session:window or session:window.pane")
+	}
+	if r.bridge == nil {
+		return target, nil
+	}
+	pane, err := r.bridge.ResolveTarget(target)
+	if err != nil {
+		return "", fmt.Errorf("no such session, window or pane")
+	}
+	if tmux.SessionOf(pane) != session {
+		return "", fmt.Errorf("%s is not in session %s", pane, session)
+	}
+	return target, nil
+}
+
+// handlePanes implements "#panes [session]": the windows and panes of the
+// bound session, or of session, with the command running in each.
+func (r *Router) handlePanes(msg channel.InboundMessage, args []string) {
+	key := chatKey(msg)
+	bound, _ := r.subs.Get(key)
+	session := tmux.SessionOf(bound)
+	if len(args) > 0 {
+		session = args[0]
+	}
+	if session == "" {
+		r.reply(msg, fmt.Sprintf("Usage: %spanes [session] — without a session, this chat must be attached.", r.Prefix()))
+		return
+	}
+	if !r.SessionAllowed(key, msg.SenderID, session) {
+		r.reply(msg, fmt.Sprintf("Session %q is not allowed for you here.", session))
+		return
+	}
+	if r.bridge == nil {
+		r.reply(msg, "[tmux bridge not available]")
+		return
+	}
+	panes, err := r.bridge.ListPanes(session)
+	if err != nil || len(panes) == 0 {
+		r.reply(msg, fmt.Sprintf("No panes found for session %q.", session))
+		return
+	}
+	// The pane this chat sends to, to mark it.
+	var current string
+	if bound != "" && tmux.SessionOf(bound) == session {
+		current, _ = r.bridge.ResolveTarget(bound)
+	}
+	lines := make([]string, 0, len(panes))
+	for _, p := range panes {
+		line := fmt.Sprintf("  %s  [%s]  %s  %s", p.Target, p.Window, p.Command, p.Path)
+		if p.Active {
+			line += "  (active)"
+		}
+		if p.Target == current {
+			line += "  ← this chat"
+		}
+		lines = append(lines, line)
+	}
+	r.reply(msg, fmt.Sprintf("Panes of %s:\n%s\nSend %sselect <window.pane> to switch.", session, strings.Join(lines, "\n"), r.Prefix()))
+}
+
+// handleSelect implements "#select [window[.pane]]": it moves the chat's
+// binding to another window or pane of the same session without a new
+// #attach. Without an argument the chat follows the session's active pane
+// again.
+func (r *Router) handleSelect(msg channel.InboundMessage, args []string) {
+	current, ok := r.boundSession(msg)
+	if !ok {
+		return
+	}
+	session := tmux.SessionOf(current)
+	target := session
+	if len(args) > 0 {
+		target = args[0]
+		if !strings.Contains(target, ":") {
+			target = session + ":" + target
+		}
+	}
+	if tmux.SessionOf(target) != session {
+		r.reply(msg, fmt.Sprintf("%sselect switches within %s; use %sattach for another session.", r.Prefix(), session, r.Prefix()))
+		return
+	}
+	checked, err := r.CheckTarget(target)
+	if err != nil {
+		r.audit(msg, audit.Event{Action: "select", Session: target, Outcome: audit.Denied, Detail: err.Error()})
+		r.reply(msg, fmt.Sprintf("Cannot select %s: %v", target, err))
+		return
+	}
+	target = checked
+	r.Attach(chatKey(msg), target)
+	r.audit(msg, audit.Event{Action: "select", Session: target, Outcome: audit.OK})
+	r.reply(msg, fmt.Sprintf("Now sending to %s.", target))
+	go r.snapAfterCommand(msg, target)
+}
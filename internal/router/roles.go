@@ -0,0 +1,287 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+)
+
+// Role is a sender's authorization level on one channel.
+type Role string
+
+const (
+	RoleOwner    Role = "owner"    // everything, plus #grant and #revoke
+	RoleOperator Role = "operator" // everything except managing roles
+	RoleViewer   Role = "viewer"   // read-only: may never send input to tmux
+)
+
+// ParseRole returns the Role named s, or false if s is not a role.
+func ParseRole(s string) (Role, bool) {
+	switch r := Role(strings.ToLower(s)); r {
+	case RoleOwner, RoleOperator, RoleViewer:
+		return r, true
+	}
+	return "", false
+}
+
+// viewerCommands are the only bridge commands a viewer may run.
+var viewerCommands = map[string]bool{
+	"help":    true,
+	"status":  true,
+	"snap":    true,
+	"shot":    true,
+	"watch":   true,
+	"auth":    true,
+	"history": true,
+	"panes":   true,
+}
+
+// SetRoles replaces the roles declared in config, keyed by "channel:senderID",
+// e.g. on startup or reload. Entries with unknown roles are ignored.
+func (r *Router) SetRoles(roles map[string]string) {
+	table := parseRoles(roles)
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.roles = table
+}
+
+// SetGrants replaces the roles given from chat, e.g. from the grant store on
+// startup. They take precedence over config roles.
+func (r *Router) SetGrants(grants map[string]string) {
+	table := parseRoles(grants)
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.granted = table
+}
+
+// SetAllowFrom records each channel's allow_from list. The adapters do the
+// filtering; the router only uses it to tell owners when a #grant or #revoke
+// is overridden by config.
+func (r *Router) SetAllowFrom(allowFrom map[string][]string) {
+	table := make(map[string]map[string]bool, len(allowFrom))
+	for ch, ids := range allowFrom {
+		if len(ids) == 0 {
+			continue
+		}
+		table[ch] = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			table[ch][id] = true
+		}
+	}
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.allowFrom = table
+}
+
+func parseRoles(roles map[string]string) map[string]Role {
+	table := make(map[string]Role, len(roles))
+	for key, s := range roles {
+		if role, ok := ParseRole(s); ok {
+			table[key] = role
+		} else {
+			slog.Warn("router: ignoring unknown role", "sender", key, "role", s)
+		}
+	}
+	return table
+}
+
+// OnRoleChange registers fn to be called after #grant or #revoke changes a
+// sender's role; role is "" for a revoke. It is used to persist the change.
+func (r *Router) OnRoleChange(fn func(ch, senderID string, role Role)) {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.onRoleChange = fn
+}
+
+// roleOf returns the sender's role, or "" if the sender is not authorized.
+// Senders passed by the adapter's allow_from without a role entry are
+// operators, or owners on a channel that has no owner yet — which keeps
+// single-user setups from before roles existed fully in control.
+func (r *Router) roleOf(msg channel.InboundMessage) Role {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	if role, ok := r.roleLocked(senderKey(msg.Channel, msg.SenderID)); ok {
+		return role
+	}
+	if !msg.PreAuthorized {
+		return ""
+	}
+	if r.hasOwnerLocked(msg.Channel) {
+		return RoleOperator
+	}
+	return RoleOwner
+}
+
+func (r *Router) roleLocked(key string) (Role, bool) {
+	if role, ok := r.granted[key]; ok {
+		return role, true
+	}
+	role, ok := r.roles[key]
+	return role, ok
+}
+
+func (r *Router) hasOwnerLocked(ch string) bool {
+	for _, table := range []map[string]Role{r.granted, r.roles} {
+		for key, role := range table {
+			if role == RoleOwner && strings.HasPrefix(key, ch+":") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// activate makes senderID the owner of ch if ch has no owner yet.
+func (r *Router) activate(ch, senderID string) bool {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	if r.hasOwnerLocked(ch) {
+		return false
+	}
+	r.granted[senderKey(ch, senderID)] = RoleOwner
+	return true
+}
+
+// Revoke removes the role given to senderID on ch from chat, as #revoke does.
+// It reports false if the sender had none. Roles declared in config are not
+// touched.
+func (r *Router) Revoke(ch, senderID string) bool {
+	key := senderKey(ch, senderID)
+	r.rolesMu.Lock()
+	_, ok := r.granted[key]
+	delete(r.granted, key)
+	onChange := r.onRoleChange
+	r.rolesMu.Unlock()
+	if ok && onChange != nil {
+		onChange(ch, senderID, "")
+	}
+	return ok
+}
+
+// configAccess describes how config.yaml still lets senderID in on ch after
+// a revoke, or "" if it does not.
+func (r *Router) configAccess(ch, senderID string) string {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	if role, ok := r.roles[senderKey(ch, senderID)]; ok {
+		return fmt.Sprintf("roles in config.yaml (%s)", role)
+	}
+	if r.allowFrom[ch][senderID] {
+		return "allow_from in config.yaml"
+	}
+	return ""
+}
+
+// filteredOut reports whether ch's allow_from is set and does not list
+// senderID, so the adapter drops the sender's messages whatever their role.
+func (r *Router) filteredOut(ch, senderID string) bool {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	allow, ok := r.allowFrom[ch]
+	return ok && !allow[senderID]
+}
+
+func senderKey(ch, senderID string) string { return ch + ":" + senderID }
+
+// permitted reports whether role may run the bridge command cmd.
+func permitted(role Role, cmd string) bool {
+	switch role {
+	case RoleOwner:
+		return true
+	case RoleOperator:
+		return cmd != "grant" && cmd != "revoke"
+	case RoleViewer:
+		return viewerCommands[cmd]
+	}
+	return false
+}
+
+// handleGrant implements "#grant [<senderID> <role>]" and "#revoke <senderID>"
+// for the sender's own channel.
+func (r *Router) handleGrant(msg channel.InboundMessage, cmd string, args []string) {
+	if cmd == "grant" && len(args) == 0 {
+		r.reply(msg, r.rolesText(msg.Channel))
+		return
+	}
+	if (cmd == "grant" && len(args) != 2) || (cmd == "revoke" && len(args) != 1) {
+		r.reply(msg, fmt.Sprintf("Usage: %sgrant <senderID> owner|operator|viewer, %srevoke <senderID>", r.Prefix(), r.Prefix()))
+		return
+	}
+	target := args[0]
+	if target == msg.SenderID {
+		r.audit(msg, audit.Event{Action: cmd, Args: args, Outcome: audit.Denied, Detail: "own role"})
+		r.reply(msg, "You cannot change your own role.")
+		return
+	}
+	var role Role
+	if cmd == "grant" {
+		var ok bool
+		if role, ok = ParseRole(args[1]); !ok {
+			r.reply(msg, fmt.Sprintf("Unknown role %q: use owner, operator or viewer.", args[1]))
+			return
+		}
+	}
+
+	if role == "" {
+		revoked := r.Revoke(msg.Channel, target)
+		if revoked {
+			slog.Info("role revoked", "channel", msg.Channel, "senderID", target, "by", msg.SenderID)
+			r.audit(msg, audit.Event{Action: "revoke", Args: args, Outcome: audit.OK})
+		}
+		if via := r.configAccess(msg.Channel, target); via != "" {
+			r.reply(msg, fmt.Sprintf("%s still has access through %s; edit the file to remove it.", target, via))
+			return
+		}
+		if !revoked {
+			r.reply(msg, fmt.Sprintf("%s has no role on this channel.", target))
+			return
+		}
+		r.reply(msg, fmt.Sprintf("Revoked all access for %s.", target))
+		return
+	}
+
+	r.rolesMu.Lock()
+	r.granted[senderKey(msg.Channel, target)] = role
+	onChange := r.onRoleChange
+	r.rolesMu.Unlock()
+	if onChange != nil {
+		onChange(msg.Channel, target, role)
+	}
+	slog.Info("role granted", "channel", msg.Channel, "senderID", target, "role", role, "by", msg.SenderID)
+	r.audit(msg, audit.Event{Action: "grant", Args: []string{target, string(role)}, Outcome: audit.OK})
+	reply := fmt.Sprintf("%s is now %s.", target, role)
+	if r.filteredOut(msg.Channel, target) {
+		reply += fmt.Sprintf(" Their messages are still dropped until they are added to %s allow_from in config.yaml.", msg.Channel)
+	}
+	r.reply(msg, reply)
+}
+
+// rolesText lists the roles on ch; those declared in config are marked.
+func (r *Router) rolesText(ch string) string {
+	r.rolesMu.Lock()
+	var lines []string
+	for key, role := range r.granted {
+		if id, ok := strings.CutPrefix(key, ch+":"); ok {
+			lines = append(lines, fmt.Sprintf("  %s  %s", id, role))
+		}
+	}
+	for key, role := range r.roles {
+		if _, ok := r.granted[key]; ok {
+			continue
+		}
+		if id, ok := strings.CutPrefix(key, ch+":"); ok {
+			lines = append(lines, fmt.Sprintf("  %s  %s (config)", id, role))
+		}
+	}
+	r.rolesMu.Unlock()
+	sort.Strings(lines)
+	usage := fmt.Sprintf("Usage: %sgrant <senderID> owner|operator|viewer, %srevoke <senderID>", r.Prefix(), r.Prefix())
+	if len(lines) == 0 {
+		return "No roles assigned on this channel.\n" + usage
+	}
+	return "Roles on this channel:\n" + strings.Join(lines, "\n") + "\n" + usage
+}
@@ -0,0 +1,157 @@
+package router_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/router"
+)
+
+func TestRoles_Activation(t *testing.T) {
+	r, outbound := newTestRouter(t)
+
+	// Unknown senders are ignored until someone activates the channel.
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: "#help"})
+	select {
+	case msg := <-outbound:
+		t.Fatalf("expected no reply before activation, got %q", msg.Text)
+	default:
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: "#im2code"})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Activated") {
+		t.Errorf("expected activation reply, got %q", msg.Text)
+	}
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: "#help"})
+	if msg := <-outbound; !strings.Contains(msg.Text, "#grant") {
+		t.Errorf("expected owner help to list #grant, got %q", msg.Text)
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "bob", Text: "#im2code"})
+	if msg := <-outbound; !strings.Contains(msg.Text, "#grant bob") {
+		t.Errorf("expected already-activated reply naming bob, got %q", msg.Text)
+	}
+}
+
+func TestRoles_Viewer(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetRoles(map[string]string{"web:v": "viewer"})
+	viewer := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "v", Text: text})
+		return (<-outbound).Text
+	}
+
+	if got := viewer("ls -la"); !strings.Contains(got, "cannot send input") {
+		t.Errorf("expected text to be denied, got %q", got)
+	}
+	if got := viewer("#key ctrl-c"); !strings.Contains(got, "not allowed") {
+		t.Errorf("expected #key to be denied, got %q", got)
+	}
+	if got := viewer("#attach prod"); !strings.Contains(got, "not allowed") {
+		t.Errorf("expected #attach to be denied, got %q", got)
+	}
+	if got := viewer("#status"); strings.Contains(got, "not allowed") {
+		t.Errorf("expected #status to be allowed, got %q", got)
+	}
+	if got := viewer("#help"); strings.Contains(got, "#key") || !strings.Contains(got, "#snap") {
+		t.Errorf("expected viewer help without #key, got %q", got)
+	}
+}
+
+func TestRoles_GrantRevoke(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetRoles(map[string]string{"web:owner": "owner", "web:op": "operator"})
+	type change struct {
+		ch, sender string
+		role       router.Role
+	}
+	var changes []change
+	r.OnRoleChange(func(ch, senderID string, role router.Role) {
+		changes = append(changes, change{ch, senderID, role})
+	})
+	send := func(sender, text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: sender, Text: text})
+		return (<-outbound).Text
+	}
+
+	if got := send("op", "#grant bob viewer"); !strings.Contains(got, "not allowed") {
+		t.Errorf("expected operator #grant to be denied, got %q", got)
+	}
+	if got := send("owner", "#grant bob admin"); !strings.Contains(got, "Unknown role") {
+		t.Errorf("expected unknown role error, got %q", got)
+	}
+	if got := send("owner", "#grant owner viewer"); !strings.Contains(got, "own role") {
+		t.Errorf("expected self-change to be refused, got %q", got)
+	}
+	if got := send("owner", "#grant bob viewer"); !strings.Contains(got, "bob is now viewer") {
+		t.Errorf("unexpected grant reply %q", got)
+	}
+	if got := send("bob", "echo hi"); !strings.Contains(got, "cannot send input") {
+		t.Errorf("expected bob to be a viewer, got %q", got)
+	}
+	if got := send("owner", "#grant"); !strings.Contains(got, "bob  viewer") || !strings.Contains(got, "op  operator") {
+		t.Errorf("expected role list, got %q", got)
+	}
+	if got := send("owner", "#revoke bob"); !strings.Contains(got, "Revoked") {
+		t.Errorf("unexpected revoke reply %q", got)
+	}
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "bob", Text: "#status"})
+	select {
+	case msg := <-outbound:
+		t.Errorf("expected revoked sender to be ignored, got %q", msg.Text)
+	default:
+	}
+
+	want := []change{{"web", "bob", router.RoleViewer}, {"web", "bob", ""}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("role changes = %v, want %v", changes, want)
+	}
+}
+
+func TestRoles_AllowFromFallback(t *testing.T) {
+	r, outbound := newTestRouter(t)
+
+	// Without an owner, an allow_from sender owns the channel...
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "a", Text: "#grant", PreAuthorized: true})
+	if msg := <-outbound; strings.Contains(msg.Text, "not allowed") {
+		t.Errorf("expected allow_from sender to be owner, got %q", msg.Text)
+	}
+
+	// ...once there is one, other allow_from senders are operators.
+	r.SetRoles(map[string]string{"web:o": "owner"})
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "a", Text: "#grant", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "not allowed") {
+		t.Errorf("expected allow_from sender to be operator, got %q", msg.Text)
+	}
+}
+
+func TestRoles_GrantsSurviveConfigReload(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetGrants(map[string]string{"web:alice": "owner"})
+	r.SetRoles(map[string]string{"web:op": "operator"})
+	r.SetAllowFrom(map[string][]string{"web": {"alice", "op"}})
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: text})
+		return (<-outbound).Text
+	}
+
+	if got := send("#grant"); !strings.Contains(got, "alice  owner") || !strings.Contains(got, "op  operator (config)") {
+		t.Errorf("expected grants and config roles listed, got %q", got)
+	}
+	if got := send("#revoke op"); !strings.Contains(got, "roles in config.yaml") {
+		t.Errorf("expected revoke of a config role to point at config, got %q", got)
+	}
+	if got := send("#grant bob viewer"); !strings.Contains(got, "allow_from") {
+		t.Errorf("expected a grant outside allow_from to warn, got %q", got)
+	}
+
+	// A config reload replaces config roles only.
+	r.SetRoles(nil)
+	if got := send("#grant"); !strings.Contains(got, "bob  viewer") || strings.Contains(got, "op  operator") {
+		t.Errorf("expected grants to outlive the reload, got %q", got)
+	}
+	if !r.Revoke("web", "bob") || r.Revoke("web", "bob") {
+		t.Error("expected Revoke to report whether a grant existed")
+	}
+}
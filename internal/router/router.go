@@ -2,30 +2,57 @@ package router
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/dfbb/im2code/internal/audit"
 	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/history"
+	"github.com/dfbb/im2code/internal/render"
 	"github.com/dfbb/im2code/internal/state"
 	"github.com/dfbb/im2code/internal/tmux"
 )
 
-const helpText = `Available commands:
-  {P}list              — list tmux sessions
-  {P}attach <session>  — bind this chat to a session
-  {P}detach            — remove binding
-  {P}status            — show current binding
-  {P}snap              — capture and send current pane
-  {P}watch on|off      — toggle real-time push
-  {P}setivl min,max    — set watch intervals (e.g. 5s,20s); no args prints current
-  {P}key <key>         — send control key (e.g. ctrl-c)
-  {P}help              — show this message`
+// commandHelp holds the help line of every bridge command, listed by #help
+// in commandOrder.
+var commandHelp = map[string]string{
+	"list":    "{P}list              — list tmux sessions",
+	"attach":  "{P}attach <target>   — bind this chat to a session, or to session:window.pane",
+	"detach":  "{P}detach            — remove binding",
+	"status":  "{P}status            — show current binding",
+	"panes":   "{P}panes [session]   — list windows and panes with their commands",
+	"select":  "{P}select [win.pane] — send to another window or pane of the session; no args = active pane",
+	"snap":    "{P}snap              — capture and send current pane",
+	"shot":    "{P}shot              — send current pane as a colored image",
+	"get":     "{P}get <path>        — send a file (relative to the pane's working directory)",
+	"watch":   "{P}watch on|off      — toggle real-time push",
+	"setivl":  "{P}setivl min,max    — set this chat's watch intervals (e.g. 5s,20s); reset = defaults; no args prints current",
+	"key":     "{P}key <key>         — send control key (e.g. ctrl-c)",
+	"confirm": "{P}confirm <code>    — send a command held by a confirm rule",
+	"secret":  "{P}secret [text]     — send text (or your next message) without recording it",
+	"history": "{P}history [n]       — show this chat's last n inputs (default 10)",
+	"redo":    "{P}redo <id>         — send an input from #history again",
+	"auth":    "{P}auth <code>       — authenticate with a code from the authenticator app",
+	"grant":   "{P}grant <id> <role> — give a sender a role: owner, operator or viewer; no args lists roles",
+	"revoke":  "{P}revoke <id>       — remove a sender's access",
+	"help":    "{P}help              — show this message",
+}
+
+var commandOrder = []string{"list", "attach", "detach", "status", "panes", "select", "snap", "shot", "get", "watch", "setivl", "key", "secret", "confirm", "history", "redo", "auth", "grant", "revoke", "help"}
+
+// maxGetSize is the largest file #get sends; most platforms reject bigger
+// bot uploads anyway.
+const maxGetSize = 50 << 20
 
 // CommandHistory records user inputs.
 type CommandHistory interface {
-	Record(channel, senderID, text string) error
+	Record(channel, chatID, senderID, text string) error
 }
 
 // Router dispatches inbound IM messages: prefix-commands → bridge handlers, others → tmux.
@@ -34,16 +61,38 @@ type Router struct {
 	subs          *state.Subscriptions
 	bridge        *tmux.Bridge
 	outbound      chan<- channel.OutboundMessage
-	onActivate    func(ch, senderID string) // called when a channel is first activated
+	onActivate    func(ch, senderID string) // called when a sender activates a channel and becomes its owner
 	history       CommandHistory
 	promptMatcher *tmux.PromptMatcher
 	watchMin      time.Duration
 	watchMax      time.Duration
 	maxLines      int
+	watchMode     string  // "full" or "diff"
+	diffRedraw    float64 // diff mode: fraction of new lines that forces a full snapshot
+	mediaDir      string  // where rendered screenshots are written; "" disables media
+	supportsMedia func(channel string) bool
+	watchImages   bool   // watch pushes are screenshots where the channel supports them
+	uploadDir     string // destination of inbound files; "" = the pane's working directory
+	dataDir       string // im2code's own files, never sent by #get
 	watching      map[string]bool
+	watchedBy     map[string]string         // chat → sender who turned watch on; "" = control socket
+	acl           *sessionMatcher           // nil = every session allowed
+	guard         *guard                    // nil = no dangerous-command rules
+	pending       map[string]pendingCommand // "channel:chatID:senderID" → text awaiting #confirm
+	totp          *stepUp                   // nil = TOTP off
+	lastCounter   map[string]int64          // "channel:senderID" → TOTP time step of the last accepted code
+	codeFails     map[string]*codeFailures  // "channel:senderID" → wrong TOTP codes
+	lastActive    map[string]time.Time      // "channel:senderID" → last message, for re-auth
+	redactor      *history.Redactor         // applied to everything recorded; nil = verbatim
+	secretNext    map[string]bool           // "channel:chatID:senderID" armed by #secret
+	sensitive     map[string]bool           // sessions whose last input was secret: output not recorded
+	auditor       Auditor                   // nil = privileged actions are not audited
 	mu            sync.RWMutex
-	activated     map[string]string // channel name → locked senderID
-	activeMu      sync.Mutex
+	roles         map[string]Role            // "channel:senderID" → role declared in config
+	granted       map[string]Role            // "channel:senderID" → role given from chat
+	allowFrom     map[string]map[string]bool // channel → allow_from, when set
+	onRoleChange  func(ch, senderID string, role Role)
+	rolesMu       sync.Mutex
 }
 
 func New(
@@ -69,44 +118,188 @@ func New(
 		watchMin:      watchMin,
 		watchMax:      watchMax,
 		maxLines:      maxLines,
+		watchMode:     "full",
+		diffRedraw:    0.6,
 		watching:      make(map[string]bool),
-		activated:     make(map[string]string),
+		watchedBy:     make(map[string]string),
+		pending:       make(map[string]pendingCommand),
+		lastCounter:   make(map[string]int64),
+		codeFails:     make(map[string]*codeFailures),
+		lastActive:    make(map[string]time.Time),
+		secretNext:    make(map[string]bool),
+		sensitive:     make(map[string]bool),
+		roles:         make(map[string]Role),
+		granted:       make(map[string]Role),
+	}
+}
+
+// Prefix returns the current bridge command prefix.
+func (r *Router) Prefix() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.prefix
+}
+
+// SetPrefix changes the bridge command prefix, e.g. on config reload.
+func (r *Router) SetPrefix(prefix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefix = prefix
+}
+
+// MaxLines returns the number of pane lines captured for snaps and pushes.
+func (r *Router) MaxLines() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.maxLines
+}
+
+// SetMaxLines changes the capture size, e.g. on config reload.
+func (r *Router) SetMaxLines(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxLines = n
+}
+
+// WatchOutput returns how watch pushes are rendered: "full" snapshots, or
+// "diff" with the redraw threshold passed to tmux.DiffLines.
+func (r *Router) WatchOutput() (mode string, redraw float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.watchMode, r.diffRedraw
+}
+
+// SetWatchOutput changes the watch push mode. Unknown modes select "full";
+// thresholds outside (0, 1] fall back to 0.6.
+func (r *Router) SetWatchOutput(mode string, redraw float64) {
+	if mode != "diff" {
+		mode = "full"
+	}
+	if redraw <= 0 || redraw > 1 {
+		redraw = 0.6
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchMode = mode
+	r.diffRedraw = redraw
+}
+
+// SetMediaOutput enables screenshots and #get: images are written to dir, and
+// media are sent to channels for which supports returns true.
+func (r *Router) SetMediaOutput(dir string, supports func(channel string) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mediaDir = dir
+	r.supportsMedia = supports
+}
+
+// CanSendMedia reports whether screenshots and files can be delivered on ch.
+func (r *Router) CanSendMedia(ch string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mediaDir != "" && r.supportsMedia != nil && r.supportsMedia(ch)
+}
+
+// WatchImages reports whether watch pushes are sent as screenshots.
+func (r *Router) WatchImages() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.watchImages
+}
+
+// SetWatchImages switches watch pushes between text and screenshots, e.g. on
+// config reload. Chats on channels without image support still get text.
+func (r *Router) SetWatchImages(on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchImages = on
+}
+
+// Shot renders session's pane, colors included, as a PNG and returns the path
+// of the image file, for OutboundMessage.Media.
+func (r *Router) Shot(session string) (string, error) {
+	if r.bridge == nil {
+		return "", fmt.Errorf("tmux bridge not available")
+	}
+	maxLines := r.MaxLines()
+	if maxLines <= 0 {
+		maxLines = 50
+	}
+	raw, err := r.bridge.CaptureRaw(session, maxLines)
+	if err != nil {
+		return "", err
+	}
+	img, err := render.PNG(raw)
+	if err != nil {
+		return "", err
 	}
+	r.mu.RLock()
+	dir := r.mediaDir
+	r.mu.RUnlock()
+	return render.WriteFile(dir, img)
+}
+
+// SetDataDir sets im2code's data directory, whose files #get refuses to send.
+func (r *Router) SetDataDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dataDir = dir
+}
+
+// UploadDir returns where uploaded files are saved; "" means the bound
+// pane's working directory.
+func (r *Router) UploadDir() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.uploadDir
+}
+
+// SetUploadDir changes where uploaded files are saved, e.g. on config reload.
+func (r *Router) SetUploadDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploadDir = dir
 }
 
-// WatchIntervals returns the current watchMin and watchMax durations.
+// WatchIntervals returns the default watchMin and watchMax durations.
 func (r *Router) WatchIntervals() (min, max time.Duration) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.watchMin, r.watchMax
 }
 
-func (r *Router) setWatchIntervals(min, max time.Duration) {
+// SetWatchIntervals replaces the default intervals used by chats that have
+// not set their own with #setivl.
+func (r *Router) SetWatchIntervals(min, max time.Duration) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.watchMin = min
 	r.watchMax = max
 }
 
-func (r *Router) record(msg channel.InboundMessage) {
+// recordText writes text to history on behalf of msg's sender, redacted.
+func (r *Router) recordText(msg channel.InboundMessage, text string) {
 	if r.history == nil {
 		return
 	}
-	if err := r.history.Record(msg.Channel, msg.SenderID, msg.Text); err != nil {
+	if err := r.history.Record(msg.Channel, msg.ChatID, msg.SenderID, r.redact(text)); err != nil {
 		slog.Warn("history: record failed", "err", err)
 	}
 }
 
 func (r *Router) reply(msg channel.InboundMessage, text string) {
-	out := channel.OutboundMessage{
+	r.send(channel.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
 		Text:    text,
-	}
+	})
+}
+
+func (r *Router) send(out channel.OutboundMessage) {
 	select {
 	case r.outbound <- out:
 	default:
-		slog.Warn("router: outbound full, dropping reply", "channel", msg.Channel, "chatID", msg.ChatID)
+		slog.Warn("router: outbound full, dropping reply", "channel", out.Channel, "chatID", out.ChatID)
 	}
 }
 
@@ -116,67 +309,111 @@ func chatKey(msg channel.InboundMessage) string {
 
 // Handle dispatches a message: bridge command or tmux forward.
 func (r *Router) Handle(msg channel.InboundMessage) {
+	// Uploads not moved into place below (e.g. from unauthorized senders) are
+	// discarded.
+	defer func() {
+		for _, path := range msg.Media {
+			channel.RemoveUpload(path)
+		}
+	}()
+
 	slog.Debug("router: handle",
 		"channel", msg.Channel,
 		"senderID", msg.SenderID,
 		"chatID", msg.ChatID,
-		"text", msg.Text,
+		"text", r.logText(msg),
 		"preAuthorized", msg.PreAuthorized,
 	)
 
-	// Gate: channels without a pre-configured allowFrom require the sender to
-	// activate with "{prefix}im2code" before any other interaction is accepted.
-	if !msg.PreAuthorized {
-		activationCmd := r.prefix + "im2code"
-		trimmed := strings.TrimSpace(msg.Text)
-
-		slog.Debug("router: activation gate",
-			"channel", msg.Channel,
-			"activationCmd", activationCmd,
-			"trimmedText", trimmed,
-			"match", trimmed == activationCmd,
-		)
-
-		r.activeMu.Lock()
-		lockedSender := r.activated[msg.Channel]
-		r.activeMu.Unlock()
-
-		slog.Debug("router: activated state", "channel", msg.Channel, "lockedSender", lockedSender)
-
-		if lockedSender == "" {
-			// Channel not yet activated.
-			if trimmed == activationCmd {
-				r.activeMu.Lock()
-				r.activated[msg.Channel] = msg.SenderID
-				r.activeMu.Unlock()
-				slog.Info("channel activated", "channel", msg.Channel, "senderID", msg.SenderID)
-				if r.onActivate != nil {
-					go r.onActivate(msg.Channel, msg.SenderID)
-				}
-				r.reply(msg, fmt.Sprintf("Activated. Send %shelp to see available commands.", r.prefix))
-			}
-			// Any other message from anyone: ignore silently.
+	// Gate: senders need a role. On channels without a pre-configured
+	// allowFrom, the first sender to send "{prefix}im2code" becomes the owner;
+	// owners let others in with #grant.
+	role := r.roleOf(msg)
+	if role == "" {
+		fields := strings.Fields(msg.Text)
+		if len(fields) == 0 || fields[0] != r.Prefix()+"im2code" {
+			// Any other message from an unknown sender: ignore silently.
+			slog.Debug("router: sender has no role, ignoring", "channel", msg.Channel, "senderID", msg.SenderID)
+			r.audit(msg, audit.Event{Action: "message", Outcome: audit.Denied, Detail: "sender has no role"})
+			return
+		}
+		if r.stepUp() != nil && (len(fields) != 2 || !r.checkCode(msg, fields[1])) {
+			slog.Info("router: activation without a valid TOTP code", "channel", msg.Channel, "senderID", msg.SenderID)
+			r.audit(msg, audit.Event{Action: "activate", Outcome: audit.Denied, Detail: "no valid TOTP code"})
+			r.reply(msg, r.codeRefusal(msg, fmt.Sprintf("Activation requires a code from the authenticator app: %sim2code <code>", r.Prefix())))
+			return
+		}
+		if !r.activate(msg.Channel, msg.SenderID) {
+			r.audit(msg, audit.Event{Action: "activate", Outcome: audit.Denied, Detail: "already activated"})
+			r.reply(msg, fmt.Sprintf("This bot is already activated. Ask an owner to run: %sgrant %s viewer", r.Prefix(), msg.SenderID))
 			return
 		}
+		slog.Info("channel activated", "channel", msg.Channel, "senderID", msg.SenderID)
+		r.audit(msg, audit.Event{Action: "activate", Outcome: audit.OK})
+		if r.onActivate != nil {
+			go r.onActivate(msg.Channel, msg.SenderID)
+		}
+		r.touch(msg)
+		r.reply(msg, fmt.Sprintf("Activated. Send %shelp to see available commands.", r.Prefix()))
+		return
+	}
+	if !r.freshAuth(msg) {
+		return
+	}
 
-		if lockedSender != msg.SenderID {
-			slog.Debug("router: wrong sender, ignoring", "lockedSender", lockedSender, "got", msg.SenderID)
+	// Uploads are saved, not typed: a caption is not forwarded to the terminal.
+	if len(msg.Media) > 0 || len(msg.MediaErrors) > 0 || len(msg.Attachments) > 0 {
+		if role == RoleViewer {
+			r.audit(msg, audit.Event{Action: "upload", Outcome: audit.Denied, Detail: "viewer role"})
+			r.reply(msg, "Viewers cannot upload files.")
+			return
+		}
+		if len(msg.Attachments) > 0 {
+			// Downloads can take minutes; the goroutine owns msg.Media now.
+			go r.fetchUploads(msg)
+			msg.Media = nil
 			return
 		}
+		r.handleUploads(msg)
+		return
 	}
 
-	// Record every authorized message (bridge commands and plain text alike).
-	r.record(msg)
+	// A message after a bare #secret, and #secret <text> itself, is never
+	// recorded.
+	secret := r.takeSecret(msg)
+	if !secret && !r.isSecretCommand(msg.Text) {
+		// Record every authorized message (bridge commands and plain text
+		// alike), without TOTP codes.
+		r.recordText(msg, r.withoutCode(msg.Text))
+	}
+
+	if strings.HasPrefix(msg.Text, r.Prefix()) {
+		r.handleCommand(msg, role)
+		return
+	}
 
-	if strings.HasPrefix(msg.Text, r.prefix) {
-		r.handleCommand(msg)
+	if role == RoleViewer {
+		r.audit(msg, audit.Event{Action: "input", Outcome: audit.Denied, Detail: "viewer role"})
+		r.reply(msg, "Viewers cannot send input to the terminal.")
 		return
 	}
+	r.sendInput(msg, secret)
+}
 
+// sendInput types msg.Text into the chat's bound session, subject to the
+// session ACL and the guard, and snaps the pane shortly after. Secret input
+// is kept out of history, including guard decisions about it.
+func (r *Router) sendInput(msg channel.InboundMessage, secret bool) {
 	key := chatKey(msg)
-	session, ok := r.subs.Get(key)
+	if _, ok := r.subs.Get(key); !ok {
+		r.reply(msg, fmt.Sprintf("No session bound. Use %sattach <session> to bind one.\nRun %slist to see available sessions.", r.Prefix(), r.Prefix()))
+		return
+	}
+	session, ok := r.boundSession(msg)
 	if !ok {
-		r.reply(msg, fmt.Sprintf("No session bound. Use %sattach <session> to bind one.\nRun %slist to see available sessions.", r.prefix, r.prefix))
+		return
+	}
+	if !r.guardText(msg, session, secret) {
 		return
 	}
 
@@ -184,6 +421,7 @@ func (r *Router) Handle(msg channel.InboundMessage) {
 		r.reply(msg, "[tmux bridge not available]")
 		return
 	}
+	r.markSensitive(session, secret)
 	if err := r.bridge.SendKeys(session, msg.Text); err != nil {
 		r.reply(msg, fmt.Sprintf("Error sending to tmux: %v", err))
 		return
@@ -194,13 +432,108 @@ func (r *Router) Handle(msg channel.InboundMessage) {
 	go r.snapAfterCommand(msg, session)
 }
 
+// fetchUploads downloads msg's attachments, then saves them like
+// handleUploads. Files not moved into place are discarded.
+func (r *Router) fetchUploads(msg channel.InboundMessage) {
+	defer func() {
+		for _, path := range msg.Media {
+			channel.RemoveUpload(path)
+		}
+	}()
+	for _, a := range msg.Attachments {
+		path, err := a.Fetch()
+		msg.AddUpload(a.Name, path, err)
+	}
+	r.handleUploads(msg)
+}
+
+// handleUploads saves the files a sender uploaded into the configured upload
+// directory, or else the bound pane's working directory, and reports where
+// they went.
+func (r *Router) handleUploads(msg channel.InboundMessage) {
+	for _, e := range msg.MediaErrors {
+		r.reply(msg, "Upload failed: "+e)
+	}
+	if len(msg.Media) == 0 {
+		return
+	}
+	if _, ok := r.subs.Get(chatKey(msg)); !ok {
+		r.reply(msg, fmt.Sprintf("No session bound, upload discarded. Use %sattach <session> to bind one.", r.Prefix()))
+		return
+	}
+	session, ok := r.boundSession(msg)
+	if !ok {
+		return
+	}
+	dir := r.UploadDir()
+	if dir == "" {
+		if r.bridge == nil {
+			r.reply(msg, "[tmux bridge not available]")
+			return
+		}
+		var err error
+		if dir, err = r.bridge.PaneDir(session); err != nil {
+			r.reply(msg, fmt.Sprintf("Cannot resolve the pane's working directory: %v", err))
+			return
+		}
+	}
+	for _, src := range msg.Media {
+		dst, err := moveUpload(src, dir)
+		if err != nil {
+			r.audit(msg, audit.Event{Action: "upload", Session: session, Args: []string{filepath.Base(src)}, Outcome: audit.Failed, Detail: err.Error()})
+			r.reply(msg, fmt.Sprintf("Saving %s failed: %v", filepath.Base(src), err))
+			continue
+		}
+		r.audit(msg, audit.Event{Action: "upload", Session: session, Args: []string{dst}, Outcome: audit.OK})
+		r.reply(msg, "Saved: "+dst)
+	}
+}
+
+// moveUpload copies src into dir under its own name, or name-1.ext,
+// name-2.ext… if that exists, so nothing is overwritten.
+func moveUpload(src, dir string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	base := filepath.Base(src)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 0; i < 100; i++ {
+		dst := filepath.Join(dir, base)
+		if i > 0 {
+			dst = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		}
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			os.Remove(dst)
+			return "", err
+		}
+		if err := out.Close(); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+		return dst, nil
+	}
+	return "", fmt.Errorf("too many files named like %s in %s", base, dir)
+}
+
 // snapAfterCommand waits 500ms then captures the pane once and sends the
 // result back to the originating chat.
 func (r *Router) snapAfterCommand(msg channel.InboundMessage, session string) {
 	if r.bridge == nil {
 		return
 	}
-	maxLines := r.maxLines
+	maxLines := r.MaxLines()
 	if maxLines <= 0 {
 		maxLines = 50
 	}
@@ -211,6 +544,7 @@ func (r *Router) snapAfterCommand(msg channel.InboundMessage, session string) {
 	if err != nil {
 		return
 	}
+	r.RecordOutput(chatKey(msg), session, content)
 	out := channel.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
@@ -223,20 +557,50 @@ func (r *Router) snapAfterCommand(msg channel.InboundMessage, session string) {
 	}
 }
 
-func (r *Router) handleCommand(msg channel.InboundMessage) {
-	text := strings.TrimPrefix(msg.Text, r.prefix)
+func (r *Router) handleCommand(msg channel.InboundMessage, role Role) {
+	text := strings.TrimPrefix(msg.Text, r.Prefix())
 	parts := strings.Fields(text)
 	if len(parts) == 0 {
-		r.reply(msg, r.helpText())
+		r.reply(msg, r.helpText(role))
 		return
 	}
 	cmd := strings.ToLower(parts[0])
 	args := parts[1:]
 	key := chatKey(msg)
 
+	if _, known := commandHelp[cmd]; known && !permitted(role, cmd) {
+		r.audit(msg, audit.Event{Action: cmd, Outcome: audit.Denied, Detail: string(role) + " role"})
+		r.reply(msg, fmt.Sprintf("%s%s is not allowed for %s role.", r.Prefix(), cmd, role))
+		return
+	}
+
 	switch cmd {
 	case "help":
-		r.reply(msg, r.helpText())
+		r.reply(msg, r.helpText(role))
+
+	case "grant", "revoke":
+		r.handleGrant(msg, cmd, args)
+
+	case "confirm":
+		r.handleConfirm(msg, args)
+
+	case "auth":
+		r.handleAuth(msg, args)
+
+	case "secret":
+		r.handleSecret(msg)
+
+	case "history":
+		r.handleHistory(msg, args)
+
+	case "redo":
+		r.handleRedo(msg, args)
+
+	case "panes":
+		r.handlePanes(msg, args)
+
+	case "select":
+		r.handleSelect(msg, args)
 
 	case "list":
 		if r.bridge == nil {
@@ -248,22 +612,45 @@ func (r *Router) handleCommand(msg channel.InboundMessage) {
 			r.reply(msg, "No tmux sessions found (is tmux running?)")
 			return
 		}
+		sessions = r.allowedSessions(key, msg.SenderID, sessions)
+		if len(sessions) == 0 {
+			r.reply(msg, "No tmux sessions available to you.")
+			return
+		}
 		r.reply(msg, "Sessions:\n  "+strings.Join(sessions, "\n  "))
 
 	case "attach":
 		if len(args) == 0 {
-			r.reply(msg, fmt.Sprintf("Usage: %sattach <session>", r.prefix))
+			r.reply(msg, fmt.Sprintf("Usage: %sattach <session>[:window[.pane]]", r.Prefix()))
+			return
+		}
+		target, err := r.CheckTarget(args[0])
+		if err != nil {
+			r.audit(msg, audit.Event{Action: "attach", Session: args[0], Outcome: audit.Denied, Detail: err.Error()})
+			r.reply(msg, fmt.Sprintf("Cannot attach to %s: %v", args[0], err))
+			return
+		}
+		if !r.SessionAllowed(key, msg.SenderID, target) {
+			slog.Info("router: attach denied by session ACL", "chat", key, "senderID", msg.SenderID, "session", target)
+			r.audit(msg, audit.Event{Action: "attach", Session: target, Outcome: audit.Denied, Detail: "session ACL"})
+			r.reply(msg, fmt.Sprintf("Session %q is not allowed for you here.", target))
+			return
+		}
+		if r.totpProtected(target) && (len(args) < 2 || !r.checkCode(msg, args[1])) {
+			slog.Info("router: attach to protected session without a valid TOTP code", "chat", key, "senderID", msg.SenderID, "session", target)
+			r.audit(msg, audit.Event{Action: "attach", Session: target, Outcome: audit.Denied, Detail: "no valid TOTP code"})
+			r.reply(msg, r.codeRefusal(msg, fmt.Sprintf("Session %q is protected: send %sattach %s <code> with a code from the authenticator app.", target, r.Prefix(), target)))
 			return
 		}
-		r.subs.Set(key, args[0])
-		r.reply(msg, fmt.Sprintf("Attached to session: %s", args[0]))
-		go r.snapAfterCommand(msg, args[0])
+		r.Attach(key, target)
+		r.audit(msg, audit.Event{Action: "attach", Session: target, Outcome: audit.OK})
+		r.reply(msg, fmt.Sprintf("Attached to session: %s", target))
+		go r.snapAfterCommand(msg, target)
 
 	case "detach":
-		r.subs.Delete(key)
-		r.mu.Lock()
-		defer r.mu.Unlock()
-		r.watching[key] = false
+		session, _ := r.subs.Get(key)
+		r.Detach(key)
+		r.audit(msg, audit.Event{Action: "detach", Session: session, Outcome: audit.OK})
 		r.reply(msg, "Detached.")
 
 	case "status":
@@ -278,9 +665,8 @@ func (r *Router) handleCommand(msg channel.InboundMessage) {
 		r.reply(msg, fmt.Sprintf("Session: %s\nWatch: %v", session, watch))
 
 	case "snap":
-		session, ok := r.subs.Get(key)
+		session, ok := r.boundSession(msg)
 		if !ok {
-			r.reply(msg, "Not attached to any session.")
 			return
 		}
 		if r.bridge == nil {
@@ -292,46 +678,129 @@ func (r *Router) handleCommand(msg channel.InboundMessage) {
 			r.reply(msg, fmt.Sprintf("Capture failed: %v", err))
 			return
 		}
+		r.RecordOutput(key, session, content)
 		r.reply(msg, "```\n"+content+"\n```")
 
+	case "shot":
+		session, ok := r.boundSession(msg)
+		if !ok {
+			return
+		}
+		if r.bridge == nil {
+			r.reply(msg, "[tmux bridge not available]")
+			return
+		}
+		if !r.CanSendMedia(msg.Channel) {
+			content, err := r.bridge.Capture(session, 50)
+			if err != nil {
+				r.reply(msg, fmt.Sprintf("Capture failed: %v", err))
+				return
+			}
+			r.reply(msg, "This channel cannot send images; here is the text.\n```\n"+content+"\n```")
+			return
+		}
+		path, err := r.Shot(session)
+		if err != nil {
+			r.reply(msg, fmt.Sprintf("Screenshot failed: %v", err))
+			return
+		}
+		r.send(channel.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Media: []string{path}})
+
+	case "get":
+		if len(args) == 0 {
+			r.reply(msg, fmt.Sprintf("Usage: %sget <path>", r.Prefix()))
+			return
+		}
+		session, ok := r.boundSession(msg)
+		if !ok {
+			return
+		}
+		if r.bridge == nil {
+			r.reply(msg, "[tmux bridge not available]")
+			return
+		}
+		if !r.CanSendMedia(msg.Channel) {
+			r.reply(msg, "This channel cannot send files.")
+			return
+		}
+		// The path may contain spaces: take everything after the command.
+		arg := strings.TrimSpace(text[strings.Index(text, parts[0])+len(parts[0]):])
+		path, err := r.getPath(session, arg)
+		if err != nil {
+			r.audit(msg, audit.Event{Action: "get", Session: session, Args: []string{arg}, Outcome: audit.Denied, Detail: err.Error()})
+			r.reply(msg, fmt.Sprintf("Cannot send %s: %v", arg, err))
+			return
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			r.audit(msg, audit.Event{Action: "get", Session: session, Args: []string{path}, Outcome: audit.Failed, Detail: err.Error()})
+			r.reply(msg, fmt.Sprintf("Cannot read %s: %v", path, err))
+			return
+		}
+		if !fi.Mode().IsRegular() {
+			r.reply(msg, fmt.Sprintf("%s is not a regular file.", path))
+			return
+		}
+		if fi.Size() > maxGetSize {
+			r.reply(msg, fmt.Sprintf("%s is too large (%d MB, limit %d MB).", path, fi.Size()>>20, maxGetSize>>20))
+			return
+		}
+		r.audit(msg, audit.Event{Action: "get", Session: session, Args: []string{path}, Outcome: audit.OK})
+		r.send(channel.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Media: []string{path}})
+
 	case "watch":
 		if len(args) == 0 {
-			r.reply(msg, fmt.Sprintf("Usage: %swatch on|off", r.prefix))
+			r.reply(msg, fmt.Sprintf("Usage: %swatch on|off", r.Prefix()))
 			return
 		}
+		session, bound := r.subs.Get(key)
 		switch strings.ToLower(args[0]) {
 		case "on":
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			r.watching[key] = true
+			if bound && !r.SessionAllowed(key, msg.SenderID, session) {
+				r.audit(msg, audit.Event{Action: "watch", Session: session, Args: []string{"on"}, Outcome: audit.Denied, Detail: "session ACL"})
+				r.reply(msg, fmt.Sprintf("Session %q is not allowed for you here.", session))
+				return
+			}
+			r.setWatch(key, msg.SenderID, true)
+			r.audit(msg, audit.Event{Action: "watch", Session: session, Args: []string{"on"}, Outcome: audit.OK})
 			r.reply(msg, "Watch mode enabled.")
 		case "off":
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			r.watching[key] = false
+			r.setWatch(key, msg.SenderID, false)
+			r.audit(msg, audit.Event{Action: "watch", Session: session, Args: []string{"off"}, Outcome: audit.OK})
 			r.reply(msg, "Watch mode disabled.")
 		default:
-			r.reply(msg, fmt.Sprintf("Usage: %swatch on|off", r.prefix))
+			r.reply(msg, fmt.Sprintf("Usage: %swatch on|off", r.Prefix()))
 		}
 
 	case "setivl":
-		const setivlUsage = "Usage: %ssetivl min,max — both in range 1s–3600s (e.g. 5s,20s)\nCurrent: min=%s max=%s"
+		const setivlUsage = "Usage: %ssetivl min,max — both in range 1s–3600s (e.g. 5s,20s), or %ssetivl reset\nCurrent: min=%s max=%s"
+		session, ok := r.subs.Get(key)
+		if !ok {
+			r.reply(msg, "Not attached to any session.")
+			return
+		}
+		min, max := r.ChatIntervals(key)
+		usage := fmt.Sprintf(setivlUsage, r.Prefix(), r.Prefix(), min, max)
 		if len(args) == 0 {
-			min, max := r.WatchIntervals()
-			r.reply(msg, fmt.Sprintf(setivlUsage, r.prefix, min, max))
+			r.reply(msg, usage)
+			return
+		}
+		if strings.EqualFold(args[0], "reset") {
+			r.subs.SetIntervals(key, 0, 0)
+			r.audit(msg, audit.Event{Action: "setivl", Session: session, Args: []string{"reset"}, Outcome: audit.OK})
+			min, max := r.ChatIntervals(key)
+			r.reply(msg, fmt.Sprintf("Watch intervals reset to defaults: min=%s max=%s", min, max))
 			return
 		}
 		pair := strings.SplitN(args[0], ",", 2)
 		if len(pair) != 2 {
-			min, max := r.WatchIntervals()
-			r.reply(msg, fmt.Sprintf(setivlUsage, r.prefix, min, max))
+			r.reply(msg, usage)
 			return
 		}
 		newMin, errMin := time.ParseDuration(strings.TrimSpace(pair[0]))
 		newMax, errMax := time.ParseDuration(strings.TrimSpace(pair[1]))
 		if errMin != nil || errMax != nil || newMin <= 0 || newMax <= 0 {
-			min, max := r.WatchIntervals()
-			r.reply(msg, fmt.Sprintf(setivlUsage, r.prefix, min, max))
+			r.reply(msg, usage)
 			return
 		}
 		// Clamp both to 1s–3600s.
@@ -345,17 +814,17 @@ func (r *Router) handleCommand(msg channel.InboundMessage) {
 		} else if newMax > 3600*time.Second {
 			newMax = 3600 * time.Second
 		}
-		r.setWatchIntervals(newMin, newMax)
-		r.reply(msg, fmt.Sprintf("Watch intervals updated: min=%s max=%s", newMin, newMax))
+		r.subs.SetIntervals(key, newMin, newMax)
+		r.audit(msg, audit.Event{Action: "setivl", Session: session, Args: []string{newMin.String(), newMax.String()}, Outcome: audit.OK})
+		r.reply(msg, fmt.Sprintf("Watch intervals for this chat updated: min=%s max=%s", newMin, newMax))
 
 	case "key":
 		if len(args) == 0 {
-			r.reply(msg, fmt.Sprintf("Usage: %skey <key> (e.g. ctrl-c)", r.prefix))
+			r.reply(msg, fmt.Sprintf("Usage: %skey <key> (e.g. ctrl-c)", r.Prefix()))
 			return
 		}
-		session, ok := r.subs.Get(key)
+		session, ok := r.boundSession(msg)
 		if !ok {
-			r.reply(msg, "Not attached to any session.")
 			return
 		}
 		if r.bridge == nil {
@@ -363,34 +832,179 @@ func (r *Router) handleCommand(msg channel.InboundMessage) {
 			return
 		}
 		if err := r.bridge.SendRawKey(session, toTmuxKey(args[0])); err != nil {
+			r.audit(msg, audit.Event{Action: "key", Session: session, Args: []string{args[0]}, Outcome: audit.Failed, Detail: err.Error()})
 			r.reply(msg, fmt.Sprintf("Error: %v", err))
+			return
 		}
+		r.audit(msg, audit.Event{Action: "key", Session: session, Args: []string{args[0]}, Outcome: audit.OK})
 
 	default:
-		r.reply(msg, fmt.Sprintf("Unknown command: %s%s\nRun %shelp for available commands.", r.prefix, cmd, r.prefix))
+		r.reply(msg, fmt.Sprintf("Unknown command: %s%s\nRun %shelp for available commands.", r.Prefix(), cmd, r.Prefix()))
+	}
+}
+
+// getPath resolves a #get argument to a real path, which must lie inside the
+// pane's working directory — symlinks and ".." included — and outside
+// im2code's data directory, where credentials and the TOTP secret are kept.
+func (r *Router) getPath(session, arg string) (string, error) {
+	dir, err := r.bridge.PaneDir(session)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve the pane's working directory: %v", err)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve the pane's working directory: %v", err)
+	}
+	path := arg
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("no such file")
+	}
+	if !within(root, path) {
+		return "", fmt.Errorf("only files under the pane's working directory %s can be sent", dir)
+	}
+	r.mu.RLock()
+	dataDir := r.dataDir
+	r.mu.RUnlock()
+	if dataDir != "" {
+		if real, err := filepath.EvalSymlinks(dataDir); err == nil && within(real, path) {
+			return "", fmt.Errorf("files in im2code's data directory cannot be sent")
+		}
 	}
+	return path, nil
 }
 
-func (r *Router) helpText() string {
-	return strings.ReplaceAll(helpText, "{P}", r.prefix)
+// within reports whether path is dir or lies below it. Both must be clean.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// helpText lists the commands role may use.
+func (r *Router) helpText(role Role) string {
+	var b strings.Builder
+	b.WriteString("Available commands:")
+	totpOn := r.stepUp() != nil
+	for _, cmd := range commandOrder {
+		if permitted(role, cmd) && (cmd != "auth" || totpOn) {
+			b.WriteString("\n  ")
+			b.WriteString(strings.ReplaceAll(commandHelp[cmd], "{P}", r.Prefix()))
+		}
+	}
+	return b.String()
+}
+
+// ChatIntervals returns chat's watch intervals: its own if set with #setivl,
+// otherwise the defaults.
+func (r *Router) ChatIntervals(chat string) (min, max time.Duration) {
+	min, max = r.WatchIntervals()
+	if b, ok := r.subs.Binding(chat); ok && b.WatchMin > 0 && b.WatchMax > 0 {
+		return b.WatchMin, b.WatchMax
+	}
+	return min, max
+}
+
+// Binding is one chat's session binding as reported by Bindings.
+type Binding struct {
+	Chat     string `json:"chat"` // "channel:chatID"
+	Session  string `json:"session"`
+	Watch    bool   `json:"watch"`
+	WatchMin string `json:"watch_min"` // effective intervals
+	WatchMax string `json:"watch_max"`
+}
+
+// Attach binds chat ("channel:chatID") to session, as #attach does.
+func (r *Router) Attach(chat, session string) {
+	r.subs.Set(chat, session)
+}
+
+// Detach removes chat's binding and turns its watch mode off, as #detach does.
+func (r *Router) Detach(chat string) {
+	r.subs.Delete(chat)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watching[chat] = false
+}
+
+// SetWatch toggles watch mode for chat, as #watch on|off does.
+func (r *Router) SetWatch(chat string, on bool) {
+	r.setWatch(chat, "", on)
+}
+
+// setWatch toggles watch mode for chat on behalf of senderID, whose session
+// ACL then applies to the pushes.
+func (r *Router) setWatch(chat, senderID string, on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watching[chat] = on
+	r.watchedBy[chat] = senderID
+}
+
+// Bindings returns all bound chats with their watch flags, sorted by chat.
+func (r *Router) Bindings() []Binding {
+	all := r.subs.All()
+	out := make([]Binding, 0, len(all))
+	for chat, session := range all {
+		min, max := r.ChatIntervals(chat)
+		r.mu.RLock()
+		watch := r.watching[chat]
+		r.mu.RUnlock()
+		out = append(out, Binding{Chat: chat, Session: session, Watch: watch, WatchMin: min.String(), WatchMax: max.String()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Chat < out[j].Chat })
+	return out
 }
 
 // WatchedChats returns a snapshot of {chatKey: session} for all currently watched chats.
-// Called by watchSubscriptions to manage idle detectors.
+// Called by watchSubscriptions to manage idle detectors. Chats whose session
+// the session ACL does not allow for the sender who turned watch on are left
+// out, so they get no pushes.
 func (r *Router) WatchedChats() map[string]string {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-	result := make(map[string]string)
+	watchedBy := make(map[string]string)
 	for key, watching := range r.watching {
 		if watching {
-			if session, ok := r.subs.Get(key); ok {
-				result[key] = session
-			}
+			watchedBy[key] = r.watchedBy[key]
 		}
 	}
+	r.mu.RUnlock()
+	result := make(map[string]string)
+	for key, senderID := range watchedBy {
+		session, ok := r.subs.Get(key)
+		if !ok {
+			continue
+		}
+		if !r.SessionAllowed(key, senderID, session) {
+			slog.Debug("router: watch suppressed by session ACL", "chat", key, "session", session)
+			continue
+		}
+		result[key] = session
+	}
 	return result
 }
 
+// Watch is one watched chat with its effective push intervals.
+type Watch struct {
+	Chat    string // "channel:chatID"
+	Session string
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// Watches returns every watched, bound chat. Called by watchSubscriptions,
+// which runs one idle detector per distinct (session, intervals).
+func (r *Router) Watches() []Watch {
+	var out []Watch
+	for chat, session := range r.WatchedChats() {
+		min, max := r.ChatIntervals(chat)
+		out = append(out, Watch{Chat: chat, Session: session, Min: min, Max: max})
+	}
+	return out
+}
+
 // keyAliases maps short/common names to the tmux key names expected by send-keys.
 var keyAliases = map[string]string{
 	"esc":       "Escape",
@@ -2,13 +2,60 @@ package router_test
 
 import (
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dfbb/im2code/internal/channel"
 	"github.com/dfbb/im2code/internal/router"
 	"github.com/dfbb/im2code/internal/state"
+	"github.com/dfbb/im2code/internal/tmux"
 )
 
+// startTmux starts a tmux server private to the test with the given
+// sessions, or skips the test without tmux.
+func startTmux(t *testing.T, sessions ...string) *tmux.Bridge {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	dir, err := os.MkdirTemp("", "tmux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMUX_TMPDIR", dir)
+	t.Setenv("TMUX", "")
+	t.Cleanup(func() {
+		exec.Command("tmux", "kill-server").Run()
+		os.RemoveAll(dir)
+	})
+	for _, s := range sessions {
+		if out, err := exec.Command("tmux", "new-session", "-d", "-s", s, "-x", "80", "-y", "24", "sh").CombinedOutput(); err != nil {
+			t.Fatalf("tmux new-session %s: %v: %s", s, err, out)
+		}
+	}
+	return tmux.New()
+}
+
+// waitSnap returns the next pane snapshot sent to chat, skipping replies.
+func waitSnap(t *testing.T, outbound chan channel.OutboundMessage) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-outbound:
+			if strings.HasPrefix(msg.Text, "```") {
+				return msg.Text
+			}
+		case <-timeout:
+			t.Fatal("no snapshot sent")
+		}
+	}
+}
+
 func newTestRouter(t *testing.T) (*router.Router, chan channel.OutboundMessage) {
 	t.Helper()
 	f, _ := os.CreateTemp("", "subs*.json")
@@ -123,3 +170,293 @@ func TestRoute_UnknownCommand(t *testing.T) {
 		t.Error("expected error reply for unknown command")
 	}
 }
+
+func TestRouter_Bindings(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	r.Attach("telegram:1", "dev")
+	r.Attach("slack:C1", "ops")
+	r.SetWatch("slack:C1", true)
+
+	got := r.Bindings()
+	want := []router.Binding{
+		{Chat: "slack:C1", Session: "ops", Watch: true, WatchMin: "0s", WatchMax: "0s"},
+		{Chat: "telegram:1", Session: "dev", WatchMin: "0s", WatchMax: "0s"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Bindings() = %+v, want %+v", got, want)
+	}
+
+	r.Detach("slack:C1")
+	if w := r.WatchedChats(); len(w) != 0 {
+		t.Errorf("detached chat still watched: %v", w)
+	}
+	if got := r.Bindings(); len(got) != 1 {
+		t.Errorf("Bindings() after detach = %+v", got)
+	}
+}
+
+func TestRouter_SetPrefix(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetPrefix("!")
+
+	r.Handle(channel.InboundMessage{
+		Channel: "telegram", ChatID: "123", Text: "!help", PreAuthorized: true,
+	})
+	msg := <-outbound
+	if !strings.Contains(msg.Text, "!attach") {
+		t.Errorf("help text does not use the new prefix: %q", msg.Text)
+	}
+}
+
+func TestRouter_SetivlIsPerChat(t *testing.T) {
+	f, _ := os.CreateTemp("", "subs*.json")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	subs, _ := state.NewSubscriptions(f.Name())
+	outbound := make(chan channel.OutboundMessage, 10)
+	r := router.New("#", subs, nil, outbound, nil, nil, nil, 5*time.Second, 20*time.Second, 0)
+
+	r.Attach("telegram:1", "dev")
+	r.Attach("telegram:2", "dev")
+	r.SetWatch("telegram:1", true)
+	r.SetWatch("telegram:2", true)
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", Text: "#setivl 2s,60s", PreAuthorized: true})
+	<-outbound
+
+	if min, max := r.ChatIntervals("telegram:1"); min != 2*time.Second || max != 60*time.Second {
+		t.Errorf("chat 1 intervals = %s,%s; want 2s,60s", min, max)
+	}
+	if min, max := r.ChatIntervals("telegram:2"); min != 5*time.Second || max != 20*time.Second {
+		t.Errorf("chat 2 intervals = %s,%s; want defaults", min, max)
+	}
+	if len(r.Watches()) != 2 {
+		t.Errorf("Watches() = %+v", r.Watches())
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", Text: "#setivl reset", PreAuthorized: true})
+	<-outbound
+	if min, _ := r.ChatIntervals("telegram:1"); min != 5*time.Second {
+		t.Errorf("after reset min = %s, want 5s", min)
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "9", Text: "#setivl 2s,60s", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Not attached") {
+		t.Errorf("setivl on unbound chat: %q", msg.Text)
+	}
+}
+
+func TestRouter_SetWatchOutput(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if mode, _ := r.WatchOutput(); mode != "full" {
+		t.Errorf("default mode = %q, want full", mode)
+	}
+	r.SetWatchOutput("diff", 0.8)
+	if mode, redraw := r.WatchOutput(); mode != "diff" || redraw != 0.8 {
+		t.Errorf("WatchOutput() = %q, %v; want diff, 0.8", mode, redraw)
+	}
+	r.SetWatchOutput("bogus", 7)
+	if mode, redraw := r.WatchOutput(); mode != "full" || redraw != 0.6 {
+		t.Errorf("invalid values not defaulted: %q, %v", mode, redraw)
+	}
+}
+
+func TestRouter_MediaOutput(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	if r.CanSendMedia("telegram") {
+		t.Error("media enabled before SetMediaOutput")
+	}
+	r.SetMediaOutput(t.TempDir(), func(ch string) bool { return ch == "telegram" })
+	if !r.CanSendMedia("telegram") || r.CanSendMedia("irc") {
+		t.Error("CanSendMedia does not follow the supports func")
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", Text: "#shot", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Not attached") {
+		t.Errorf("shot on unbound chat: %q", msg.Text)
+	}
+}
+
+func TestRoute_GetUsage(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", Text: "#get", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Usage: #get") {
+		t.Errorf("#get without path: %q", msg.Text)
+	}
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", Text: "#get out.log", PreAuthorized: true})
+	if msg := <-outbound; !strings.Contains(msg.Text, "Not attached") {
+		t.Errorf("#get on unbound chat: %q", msg.Text)
+	}
+}
+
+func TestRoute_GetConfined(t *testing.T) {
+	bridge := startTmux(t)
+	base := t.TempDir()
+	work, data := filepath.Join(base, "work"), filepath.Join(base, "work", ".im2code")
+	os.MkdirAll(data, 0o700)
+	os.WriteFile(filepath.Join(work, "a.txt"), []byte("a"), 0o600)
+	os.WriteFile(filepath.Join(base, "outside.txt"), []byte("x"), 0o600)
+	os.WriteFile(filepath.Join(data, "config.yaml"), []byte("token: t"), 0o600)
+	os.Symlink(filepath.Join(base, "outside.txt"), filepath.Join(work, "link.txt"))
+	if out, err := exec.Command("tmux", "new-session", "-d", "-s", "dev", "-c", work, "sh").CombinedOutput(); err != nil {
+		t.Fatalf("tmux new-session: %v: %s", err, out)
+	}
+	f, _ := os.CreateTemp("", "subs*.json")
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	subs, _ := state.NewSubscriptions(f.Name())
+	outbound := make(chan channel.OutboundMessage, 10)
+	r := router.New("#", subs, bridge, outbound, nil, nil, nil, 0, 0, 0)
+	r.SetMediaOutput(t.TempDir(), func(string) bool { return true })
+	r.SetDataDir(data)
+	r.Attach("web:c", "dev")
+	get := func(path string) channel.OutboundMessage {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "u", Text: "#get " + path, PreAuthorized: true})
+		return <-outbound
+	}
+
+	if msg := get("a.txt"); len(msg.Media) != 1 || filepath.Base(msg.Media[0]) != "a.txt" {
+		t.Errorf("expected a.txt to be sent, got %+v", msg)
+	}
+	if msg := get(filepath.Join(work, "a.txt")); len(msg.Media) != 1 {
+		t.Errorf("expected an absolute path inside the pane's directory to be sent, got %+v", msg)
+	}
+	for _, path := range []string{
+		filepath.Join(base, "outside.txt"),
+		"../outside.txt",
+		"link.txt",
+		"/etc/passwd",
+		".im2code/config.yaml",
+	} {
+		if msg := get(path); len(msg.Media) != 0 || !strings.Contains(msg.Text, "Cannot send") {
+			t.Errorf("#get %s: expected a refusal, got %+v", path, msg)
+		}
+	}
+}
+
+func TestRoute_Upload(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	dir := t.TempDir()
+	r.SetUploadDir(dir)
+	upload := func() channel.InboundMessage {
+		path, err := channel.SaveUpload("notes.txt", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return channel.InboundMessage{Channel: "telegram", ChatID: "1", Media: []string{path}, PreAuthorized: true}
+	}
+
+	// Unbound chat: the upload is discarded.
+	msg := upload()
+	r.Handle(msg)
+	if reply := <-outbound; !strings.Contains(reply.Text, "discarded") {
+		t.Errorf("upload on unbound chat: %q", reply.Text)
+	}
+	if _, err := os.Stat(msg.Media[0]); !os.IsNotExist(err) {
+		t.Error("discarded upload was not removed")
+	}
+
+	r.Attach("telegram:1", "dev")
+	r.Handle(upload())
+	r.Handle(upload())
+	for _, want := range []string{"notes.txt", "notes-1.txt"} {
+		reply := <-outbound
+		if reply.Text != "Saved: "+filepath.Join(dir, want) {
+			t.Errorf("reply = %q, want saved %s", reply.Text, want)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, want)); string(data) != "hello" {
+			t.Errorf("%s content = %q", want, data)
+		}
+	}
+
+	r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "1", MediaErrors: []string{"big.iso: too large"}, PreAuthorized: true})
+	if reply := <-outbound; reply.Text != "Upload failed: big.iso: too large" {
+		t.Errorf("reply = %q", reply.Text)
+	}
+}
+
+func TestRoute_Attachments(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	dir := t.TempDir()
+	r.SetUploadDir(dir)
+	r.Attach("telegram:1", "dev")
+	var fetched atomic.Int32
+	attach := func(msg channel.InboundMessage) channel.InboundMessage {
+		msg.AddAttachment("notes.txt", func() (string, error) {
+			fetched.Add(1)
+			return channel.SaveUpload("notes.txt", strings.NewReader("hello"))
+		})
+		return msg
+	}
+
+	// Neither a sender without a role nor a viewer gets anything downloaded.
+	r.Handle(attach(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "mallory"}))
+	r.SetRoles(map[string]string{"telegram:v": "viewer"})
+	r.Handle(attach(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "v"}))
+	if reply := <-outbound; reply.Text != "Viewers cannot upload files." {
+		t.Errorf("reply = %q", reply.Text)
+	}
+	if n := fetched.Load(); n != 0 {
+		t.Errorf("expected no downloads for unauthorized senders, got %d", n)
+	}
+
+	r.Handle(attach(channel.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", PreAuthorized: true}))
+	select {
+	case reply := <-outbound:
+		if reply.Text != "Saved: "+filepath.Join(dir, "notes.txt") {
+			t.Errorf("reply = %q", reply.Text)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the upload")
+	}
+	if n := fetched.Load(); n != 1 {
+		t.Errorf("expected one download, got %d", n)
+	}
+}
+
+func TestRoute_SelectGoneSession(t *testing.T) {
+	bridge := startTmux(t, "dev")
+	f, _ := os.CreateTemp("", "subs*.json")
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	subs, _ := state.NewSubscriptions(f.Name())
+	outbound := make(chan channel.OutboundMessage, 10)
+	r := router.New("#", subs, bridge, outbound, nil, nil, nil, 0, 0, 0)
+	r.Attach("web:c", "gone")
+
+	// A bare #select has no argument to report; the session is named instead.
+	r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "u1", Text: "#select", PreAuthorized: true})
+	if reply := <-outbound; !strings.Contains(reply.Text, "Cannot select gone") {
+		t.Errorf("expected #select of a gone session to be refused, got %q", reply.Text)
+	}
+}
+
+func TestRoute_PaneTargets(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "telegram", ChatID: "123", SenderID: "u1", Text: text, PreAuthorized: true})
+		return (<-outbound).Text
+	}
+
+	if got := send("#attach build:"); !strings.Contains(got, "Cannot attach") {
+		t.Errorf("expected an empty window to be rejected, got %q", got)
+	}
+	send("#attach build:1.0")
+	if got := r.Bindings(); len(got) != 1 || got[0].Session != "build:1.0" {
+		t.Fatalf("expected the chat bound to the pane, got %+v", got)
+	}
+
+	send("#select logs.1")
+	if got := r.Bindings()[0].Session; got != "build:logs.1" {
+		t.Errorf("expected #select to keep the session, got %q", got)
+	}
+	if got := send("#select prod:0"); !strings.Contains(got, "#attach") {
+		t.Errorf("expected #select into another session to be refused, got %q", got)
+	}
+	send("#select")
+	if got := r.Bindings()[0].Session; got != "build" {
+		t.Errorf("expected a bare #select to follow the active pane, got %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/history"
+	"github.com/dfbb/im2code/internal/tmux"
+)
+
+// SetRedactor sets the redaction applied to everything written to history,
+// e.g. from config on startup or reload; nil records text verbatim.
+func (r *Router) SetRedactor(rd *history.Redactor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redactor = rd
+}
+
+func (r *Router) redact(text string) string {
+	r.mu.RLock()
+	rd := r.redactor
+	r.mu.RUnlock()
+	return rd.Redact(text)
+}
+
+// logText is msg's text as the debug log may show it.
+func (r *Router) logText(msg channel.InboundMessage) string {
+	r.mu.RLock()
+	armed := r.secretNext[senderKey(chatKey(msg), msg.SenderID)]
+	r.mu.RUnlock()
+	if armed || r.isSecretCommand(msg.Text) {
+		return "(secret)"
+	}
+	return r.redact(msg.Text)
+}
+
+// isSecretCommand reports whether text is "#secret", with or without text.
+func (r *Router) isSecretCommand(text string) bool {
+	rest, ok := strings.CutPrefix(text, r.Prefix())
+	rest = strings.TrimLeft(rest, " \t")
+	if !ok || len(rest) < len("secret") || !strings.EqualFold(rest[:len("secret")], "secret") {
+		return false
+	}
+	rest = rest[len("secret"):]
+	return rest == "" || strings.ContainsAny(rest[:1], " \t\n")
+}
+
+// takeSecret reports whether the sender armed secret mode with a bare
+// #secret, and disarms it: only one message is affected.
+func (r *Router) takeSecret(msg channel.InboundMessage) bool {
+	key := senderKey(chatKey(msg), msg.SenderID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	armed := r.secretNext[key]
+	delete(r.secretNext, key)
+	return armed
+}
+
+// handleSecret implements "#secret <text>", which sends text to the terminal
+// without recording it, and bare "#secret", which does the same for the
+// sender's next message. Neither the text nor the command is recorded.
+func (r *Router) handleSecret(msg channel.InboundMessage) {
+	rest := strings.TrimLeft(strings.TrimPrefix(msg.Text, r.Prefix()), " \t")[len("secret"):]
+	if strings.TrimSpace(rest) == "" {
+		r.mu.Lock()
+		r.secretNext[senderKey(chatKey(msg), msg.SenderID)] = true
+		r.mu.Unlock()
+		r.reply(msg, "Your next message will be sent to the terminal without being recorded.")
+		return
+	}
+	secret := msg
+	secret.Text = rest[1:] // keep the text exactly as typed after the separator
+	r.sendInput(secret, true)
+}
+
+// markSensitive records whether the input about to be typed into target's
+// session is secret. Until the next input that is not, nothing captured from
+// the session is recorded — the snap after the input, #snap, diffs and watch
+// pushes alike — since the screen may still show the secret.
+func (r *Router) markSensitive(target string, secret bool) {
+	session := tmux.SessionOf(target)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if secret {
+		r.sensitive[session] = true
+	} else {
+		delete(r.sensitive, session)
+	}
+}
+
+// isSensitive reports whether the last input to target's session was secret.
+func (r *Router) isSensitive(target string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sensitive[tmux.SessionOf(target)]
+}
@@ -0,0 +1,220 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dfbb/im2code/internal/audit"
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/tmux"
+	"github.com/dfbb/im2code/internal/totp"
+)
+
+// TOTPSettings enable step-up authentication with an authenticator app.
+// With a Secret set, activation needs "#im2code <code>", attaching to a
+// session matching Protected (patterns as in SessionACL) needs
+// "#attach <session> <code>", and a sender idle for longer than ReauthAfter
+// must send "#auth <code>" before anything else.
+type TOTPSettings struct {
+	Secret      string // base32; "" disables TOTP
+	Protected   []string
+	ReauthAfter time.Duration // 0 = never
+}
+
+// A sender who sends maxCodeMisses wrong codes in a row is locked out for
+// codeLockout, doubling with each further lockout up to maxCodeLockout, so
+// the code space cannot be brute-forced.
+const (
+	maxCodeMisses  = 5
+	codeLockout    = time.Minute
+	maxCodeLockout = time.Hour
+)
+
+// codeFailures tracks one sender's wrong TOTP codes.
+type codeFailures struct {
+	misses   int       // since the last lockout
+	lockouts int       // so far, for the backoff
+	until    time.Time // every code is refused until then
+}
+
+type stepUp struct {
+	secret      string
+	protected   []func(string) bool
+	reauthAfter time.Duration
+}
+
+// SetTOTP replaces the TOTP settings, e.g. from config on startup or reload.
+// It fails without changing anything if the secret or a pattern is invalid.
+func (r *Router) SetTOTP(s TOTPSettings) error {
+	var su *stepUp
+	if s.Secret != "" {
+		if _, err := totp.Code(s.Secret, time.Now()); err != nil {
+			return err
+		}
+		protected, err := compilePatterns(s.Protected)
+		if err != nil {
+			return err
+		}
+		su = &stepUp{secret: s.Secret, protected: protected, reauthAfter: s.ReauthAfter}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if su == nil || r.totp == nil || su.secret != r.totp.secret {
+		r.lastCounter = make(map[string]int64)
+	}
+	r.totp = su
+	return nil
+}
+
+func (r *Router) stepUp() *stepUp {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.totp
+}
+
+// checkCode reports whether code, sent by msg's sender, is valid now. Each
+// sender can use a code once: a code from the same or an earlier time step as
+// the sender's last accepted one is refused, so it cannot be replayed. Wrong
+// codes count towards a lockout, during which every code is refused.
+func (r *Router) checkCode(msg channel.InboundMessage, code string) bool {
+	su := r.stepUp()
+	if su == nil {
+		return false
+	}
+	key := senderKey(msg.Channel, msg.SenderID)
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.codeFails[key]
+	if f != nil && now.Before(f.until) {
+		return false
+	}
+	counter, ok := totp.Validate(su.secret, code, now)
+	if !ok {
+		if f == nil {
+			f = &codeFailures{}
+			r.codeFails[key] = f
+		}
+		if f.misses++; f.misses >= maxCodeMisses {
+			f.misses = 0
+			f.until = now.Add(min(codeLockout<<f.lockouts, maxCodeLockout))
+			if f.lockouts < 6 {
+				f.lockouts++
+			}
+		}
+		return false
+	}
+	if counter <= r.lastCounter[key] {
+		return false
+	}
+	r.lastCounter[key] = counter
+	delete(r.codeFails, key)
+	return true
+}
+
+// codeRefusal returns the reply to a refused code: usual, or how long msg's
+// sender is locked out.
+func (r *Router) codeRefusal(msg channel.InboundMessage, usual string) string {
+	r.mu.RLock()
+	f := r.codeFails[senderKey(msg.Channel, msg.SenderID)]
+	r.mu.RUnlock()
+	if f != nil {
+		if wait := time.Until(f.until); wait > 0 {
+			return fmt.Sprintf("Too many wrong codes. Try again in %s.", wait.Round(time.Second))
+		}
+	}
+	return usual
+}
+
+// withoutCode returns text with the TOTP code of "#attach <target> <code>",
+// "#auth <code>" or "#im2code <code>" removed, so history never holds one.
+func (r *Router) withoutCode(text string) string {
+	fields := strings.Fields(text)
+	keep := len(fields)
+	switch p := r.Prefix(); {
+	case len(fields) > 2 && fields[0] == p+"attach":
+		keep = 2
+	case len(fields) > 1 && (fields[0] == p+"auth" || fields[0] == p+"im2code"):
+		keep = 1
+	}
+	if keep == len(fields) {
+		return text
+	}
+	return strings.Join(fields[:keep], " ")
+}
+
+// totpProtected reports whether attaching to target's session needs a code.
+func (r *Router) totpProtected(target string) bool {
+	su := r.stepUp()
+	if su == nil {
+		return false
+	}
+	for _, match := range su.protected {
+		if match(tmux.SessionOf(target)) {
+			return true
+		}
+	}
+	return false
+}
+
+// touch marks the sender of msg as active now.
+func (r *Router) touch(msg channel.InboundMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastActive[senderKey(msg.Channel, msg.SenderID)] = time.Now()
+}
+
+// freshAuth reports whether msg's sender may go on. A sender idle for longer
+// than the re-auth period (or not seen since the daemon started) is asked for
+// "#auth <code>", which is handled here. Otherwise the sender is marked active.
+func (r *Router) freshAuth(msg channel.InboundMessage) bool {
+	su := r.stepUp()
+	if su == nil || su.reauthAfter <= 0 {
+		return true
+	}
+	r.mu.RLock()
+	last, seen := r.lastActive[senderKey(msg.Channel, msg.SenderID)]
+	r.mu.RUnlock()
+	if seen && time.Since(last) <= su.reauthAfter {
+		r.touch(msg)
+		return true
+	}
+
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 2 && fields[0] == r.Prefix()+"auth" {
+		if r.checkCode(msg, fields[1]) {
+			r.touch(msg)
+			r.audit(msg, audit.Event{Action: "auth", Outcome: audit.OK})
+			r.reply(msg, "Authenticated.")
+		} else {
+			r.audit(msg, audit.Event{Action: "auth", Outcome: audit.Denied, Detail: "invalid or reused code"})
+			r.reply(msg, r.codeRefusal(msg, "Invalid or already used code."))
+		}
+		return false
+	}
+	r.audit(msg, audit.Event{Action: "message", Outcome: audit.Denied, Detail: "re-authentication required"})
+	r.reply(msg, fmt.Sprintf("Please authenticate: send %sauth <code> with a code from your authenticator app.", r.Prefix()))
+	return false
+}
+
+// handleAuth implements "#auth <code>" for a sender who is not required to
+// re-authenticate; it just refreshes their activity.
+func (r *Router) handleAuth(msg channel.InboundMessage, args []string) {
+	if r.stepUp() == nil {
+		r.reply(msg, "TOTP is not enabled.")
+		return
+	}
+	if len(args) != 1 {
+		r.reply(msg, fmt.Sprintf("Usage: %sauth <code>", r.Prefix()))
+		return
+	}
+	if !r.checkCode(msg, args[0]) {
+		r.audit(msg, audit.Event{Action: "auth", Outcome: audit.Denied, Detail: "invalid or reused code"})
+		r.reply(msg, r.codeRefusal(msg, "Invalid or already used code."))
+		return
+	}
+	r.touch(msg)
+	r.audit(msg, audit.Event{Action: "auth", Outcome: audit.OK})
+	r.reply(msg, "Authenticated.")
+}
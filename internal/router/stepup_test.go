@@ -0,0 +1,183 @@
+package router_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/channel"
+	"github.com/dfbb/im2code/internal/router"
+	"github.com/dfbb/im2code/internal/state"
+	"github.com/dfbb/im2code/internal/totp"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+func TestTOTP_Activation(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	if err := r.SetTOTP(router.TOTPSettings{Secret: testSecret, Protected: []string{"prod*"}}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: text})
+		return (<-outbound).Text
+	}
+
+	if got := send("#im2code"); !strings.Contains(got, "requires a code") {
+		t.Errorf("expected activation without a code to be refused, got %q", got)
+	}
+	if got := send("#im2code 000000"); !strings.Contains(got, "requires a code") {
+		t.Errorf("expected a wrong code to be refused, got %q", got)
+	}
+	code, _ := totp.Code(testSecret, time.Now())
+	if got := send("#im2code " + code); !strings.Contains(got, "Activated") {
+		t.Fatalf("expected activation with a valid code, got %q", got)
+	}
+	if got := send("#auth " + code); !strings.Contains(got, "already used") {
+		t.Errorf("expected a replayed code to be refused, got %q", got)
+	}
+	if got := send("#attach prod-db"); !strings.Contains(got, "protected") {
+		t.Errorf("expected attach to a protected session to need a code, got %q", got)
+	}
+}
+
+func TestTOTP_Reauth(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetRoles(map[string]string{"web:alice": "owner"})
+	if err := r.SetTOTP(router.TOTPSettings{Secret: testSecret, ReauthAfter: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: text})
+		return (<-outbound).Text
+	}
+
+	// Not seen since startup: everything but #auth is held back.
+	if got := send("#status"); !strings.Contains(got, "Please authenticate") {
+		t.Errorf("expected a re-auth prompt, got %q", got)
+	}
+	code, _ := totp.Code(testSecret, time.Now())
+	if got := send("#auth " + code); got != "Authenticated." {
+		t.Errorf("expected #auth to succeed, got %q", got)
+	}
+	if got := send("#status"); strings.Contains(got, "authenticate") {
+		t.Errorf("expected #status to go through after #auth, got %q", got)
+	}
+}
+
+func TestTOTP_CodesNotRecorded(t *testing.T) {
+	r, outbound, hist := newGuardedRouter(t)
+	r.SetRoles(map[string]string{"web:alice": "owner"})
+	if err := r.SetTOTP(router.TOTPSettings{Secret: testSecret, Protected: []string{"prod*"}}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: text})
+		return (<-outbound).Text
+	}
+
+	code, _ := totp.Code(testSecret, time.Now())
+	if got := send("#attach prod-db " + code); !strings.Contains(got, "Attached") {
+		t.Fatalf("expected attach with a valid code, got %q", got)
+	}
+	send("#detach")
+	// The code was used: within its time step it is refused, wherever it
+	// is sent again.
+	if got := send("#attach prod-db " + code); !strings.Contains(got, "protected") {
+		t.Errorf("expected a reused code to be refused, got %q", got)
+	}
+	if got := send("#auth " + code); !strings.Contains(got, "already used") {
+		t.Errorf("expected a reused code to be refused by #auth, got %q", got)
+	}
+	if !hist.has("#attach prod-db") || !hist.has("#auth") {
+		t.Errorf("expected the commands to be recorded, got %v", hist.rows)
+	}
+	for _, row := range hist.rows {
+		if strings.Contains(row, code) {
+			t.Errorf("history holds the code: %q", row)
+		}
+	}
+}
+
+func TestTOTP_LockoutAndPerSenderReplay(t *testing.T) {
+	r, outbound := newTestRouter(t)
+	r.SetRoles(map[string]string{"web:alice": "owner", "web:bob": "owner"})
+	if err := r.SetTOTP(router.TOTPSettings{Secret: testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(sender, text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: sender, Text: text})
+		return (<-outbound).Text
+	}
+	code, _ := totp.Code(testSecret, time.Now())
+	wrong := "000000"
+	if wrong == code {
+		wrong = "000001"
+	}
+
+	// After five wrong codes even the right one is refused.
+	for i := 0; i < 5; i++ {
+		send("mallory", "#im2code "+wrong)
+	}
+	if got := send("mallory", "#im2code "+code); !strings.Contains(got, "Too many wrong codes") {
+		t.Errorf("expected a locked-out sender to be refused, got %q", got)
+	}
+
+	// The lockout and the replay check are per sender.
+	if got := send("alice", "#auth "+code); got != "Authenticated." {
+		t.Errorf("expected alice's code to be accepted, got %q", got)
+	}
+	if got := send("bob", "#auth "+code); got != "Authenticated." {
+		t.Errorf("expected bob's code in the same time step to be accepted, got %q", got)
+	}
+	if got := send("alice", "#auth "+code); !strings.Contains(got, "already used") {
+		t.Errorf("expected alice's reused code to be refused, got %q", got)
+	}
+}
+
+func TestTOTP_InvalidSecret(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if err := r.SetTOTP(router.TOTPSettings{Secret: "not base32!"}); err == nil {
+		t.Error("expected an invalid secret to be rejected")
+	}
+}
+
+func TestTOTP_ProtectedByResolvedName(t *testing.T) {
+	bridge := startTmux(t, "prod", "dev")
+	f, _ := os.CreateTemp("", "subs*.json")
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	subs, _ := state.NewSubscriptions(f.Name())
+	outbound := make(chan channel.OutboundMessage, 10)
+	r := router.New("#", subs, bridge, outbound, nil, nil, nil, 0, 0, 0)
+	if err := r.SetTOTP(router.TOTPSettings{Secret: testSecret, Protected: []string{"prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetSessionACL(router.SessionACL{Default: []string{"dev", "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(text string) string {
+		r.Handle(channel.InboundMessage{Channel: "web", ChatID: "c", SenderID: "alice", Text: text, PreAuthorized: true})
+		return (<-outbound).Text
+	}
+
+	// tmux would match these to prod by prefix, glob or ID.
+	for _, target := range []string{"pro", "pr*", "$0", "pro:0"} {
+		if got := send("#attach " + target); !strings.Contains(got, "Cannot attach") {
+			t.Errorf("expected #attach %s to be refused, got %q", target, got)
+		}
+	}
+	if got := send("#attach dev:%0"); !strings.Contains(got, "Cannot attach") {
+		t.Errorf("expected a pane of prod named through dev to be refused, got %q", got)
+	}
+	if got := send("#attach prod"); !strings.Contains(got, "protected") {
+		t.Errorf("expected prod to need a code, got %q", got)
+	}
+	if b := r.Bindings(); len(b) != 0 {
+		t.Fatalf("expected no binding, got %+v", b)
+	}
+	if got := send("#attach dev"); !strings.Contains(got, "Attached") {
+		t.Errorf("expected dev to attach, got %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Grant is a role given to a sender from chat: by activating a channel with
+// #im2code or by an owner's #grant.
+type Grant struct {
+	Role      string    `json:"role"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// Grants maps "channel:senderID" → Grant. It keeps authorization made at
+// runtime out of config.yaml, which stays as the user wrote it.
+type Grants struct {
+	mu   sync.RWMutex
+	data map[string]Grant
+	path string
+}
+
+func NewGrants(path string) (*Grants, error) {
+	g := &Grants{
+		data: make(map[string]Grant),
+		path: path,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &g.data); err != nil {
+			return nil, fmt.Errorf("grants: %s: %w", path, err)
+		}
+	}
+	return g, nil
+}
+
+// Roles returns key → role for every grant.
+func (g *Grants) Roles() map[string]string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make(map[string]string, len(g.data))
+	for k, v := range g.data {
+		out[k] = v.Role
+	}
+	return out
+}
+
+// GrantEntry is one row of List.
+type GrantEntry struct {
+	Key string // "channel:senderID"
+	Grant
+}
+
+// List returns every grant sorted by key.
+func (g *Grants) List() []GrantEntry {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make([]GrantEntry, 0, len(g.data))
+	for k, v := range g.data {
+		out = append(out, GrantEntry{Key: k, Grant: v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Set gives key role and writes the store.
+func (g *Grants) Set(key, role string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.data[key] = Grant{Role: role, GrantedAt: time.Now().UTC()}
+	return g.save()
+}
+
+// Delete removes key's grant and writes the store. It reports false if key
+// had none.
+func (g *Grants) Delete(key string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.data[key]; !ok {
+		return false, nil
+	}
+	delete(g.data, key)
+	return true, g.save()
+}
+
+func (g *Grants) save() error {
+	data, err := json.MarshalIndent(g.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("grants: marshal: %w", err)
+	}
+	if err := os.WriteFile(g.path, data, 0600); err != nil {
+		return fmt.Errorf("grants: write: %w", err)
+	}
+	return nil
+}
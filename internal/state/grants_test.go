@@ -0,0 +1,36 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/dfbb/im2code/internal/state"
+)
+
+func TestGrants(t *testing.T) {
+	path := t.TempDir() + "/grants.json"
+	g, err := state.NewGrants(path)
+	if err != nil {
+		t.Fatalf("NewGrants error: %v", err)
+	}
+	if err := g.Set("telegram:1", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Set("telegram:2", "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := g.Delete("telegram:2"); !ok || err != nil {
+		t.Errorf("Delete = %v, %v; want true, nil", ok, err)
+	}
+	if ok, _ := g.Delete("telegram:2"); ok {
+		t.Error("expected a second Delete to report false")
+	}
+
+	g2, err := state.NewGrants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := g2.List()
+	if len(list) != 1 || list[0].Key != "telegram:1" || list[0].Role != "owner" || list[0].GrantedAt.IsZero() {
+		t.Errorf("reloaded grants = %+v", list)
+	}
+}
@@ -2,21 +2,72 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 	"sync"
+	"time"
 )
 
-// Subscriptions maps "channel:chatID" → tmux session name.
+// Binding is one chat's session binding. WatchMin and WatchMax are the chat's
+// own watch intervals; zero means "use the global defaults".
+type Binding struct {
+	Session  string
+	WatchMin time.Duration
+	WatchMax time.Duration
+}
+
+// bindingJSON is the on-disk form of a Binding that has intervals set.
+// Bindings without intervals are stored as a plain session string, which is
+// also the format written by earlier versions.
+type bindingJSON struct {
+	Session  string `json:"session"`
+	WatchMin string `json:"watch_min,omitempty"`
+	WatchMax string `json:"watch_max,omitempty"`
+}
+
+func (b Binding) MarshalJSON() ([]byte, error) {
+	if b.WatchMin == 0 && b.WatchMax == 0 {
+		return json.Marshal(b.Session)
+	}
+	return json.Marshal(bindingJSON{Session: b.Session, WatchMin: b.WatchMin.String(), WatchMax: b.WatchMax.String()})
+}
+
+func (b *Binding) UnmarshalJSON(data []byte) error {
+	var session string
+	if err := json.Unmarshal(data, &session); err == nil {
+		*b = Binding{Session: session}
+		return nil
+	}
+	var bj bindingJSON
+	if err := json.Unmarshal(data, &bj); err != nil {
+		return err
+	}
+	*b = Binding{Session: bj.Session}
+	var err error
+	if bj.WatchMin != "" {
+		if b.WatchMin, err = time.ParseDuration(bj.WatchMin); err != nil {
+			return fmt.Errorf("binding %q: watch_min: %w", bj.Session, err)
+		}
+	}
+	if bj.WatchMax != "" {
+		if b.WatchMax, err = time.ParseDuration(bj.WatchMax); err != nil {
+			return fmt.Errorf("binding %q: watch_max: %w", bj.Session, err)
+		}
+	}
+	return nil
+}
+
+// Subscriptions maps "channel:chatID" → tmux session binding.
 type Subscriptions struct {
 	mu   sync.RWMutex
-	data map[string]string
+	data map[string]Binding
 	path string
 }
 
 func NewSubscriptions(path string) (*Subscriptions, error) {
 	s := &Subscriptions{
-		data: make(map[string]string),
+		data: make(map[string]Binding),
 		path: path,
 	}
 	if err := s.load(); err != nil && !os.IsNotExist(err) {
@@ -26,17 +77,44 @@ func NewSubscriptions(path string) (*Subscriptions, error) {
 }
 
 func (s *Subscriptions) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data[key]
+	return v.Session, ok
+}
+
+// Binding returns the full binding for key, including its intervals.
+func (s *Subscriptions) Binding(key string) (Binding, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	v, ok := s.data[key]
 	return v, ok
 }
 
+// Set binds key to session. Intervals already set for key are kept.
 func (s *Subscriptions) Set(key, session string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[key] = session
+	b := s.data[key]
+	b.Session = session
+	s.data[key] = b
+	s.save()
+}
+
+// SetIntervals stores per-chat watch intervals for an existing binding; zero
+// values reset the chat to the global defaults. It reports false if key is
+// not bound.
+func (s *Subscriptions) SetIntervals(key string, min, max time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.data[key]
+	if !ok {
+		return false
+	}
+	b.WatchMin, b.WatchMax = min, max
+	s.data[key] = b
 	s.save()
+	return true
 }
 
 func (s *Subscriptions) Delete(key string) {
@@ -46,10 +124,22 @@ func (s *Subscriptions) Delete(key string) {
 	s.save()
 }
 
+// All returns key → session for every binding.
 func (s *Subscriptions) All() map[string]string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	out := make(map[string]string, len(s.data))
+	for k, v := range s.data {
+		out[k] = v.Session
+	}
+	return out
+}
+
+// Bindings returns a copy of every binding, including intervals.
+func (s *Subscriptions) Bindings() map[string]Binding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]Binding, len(s.data))
 	for k, v := range s.data {
 		out[k] = v
 	}
@@ -2,7 +2,9 @@ package state_test
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dfbb/im2code/internal/state"
 )
@@ -67,3 +69,49 @@ func TestSubscriptions_All(t *testing.T) {
 		t.Errorf("All() returned %d entries, want 2", len(all))
 	}
 }
+
+func TestSubscriptions_Intervals(t *testing.T) {
+	f, _ := os.CreateTemp("", "subs-*.json")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	store, _ := state.NewSubscriptions(f.Name())
+	if store.SetIntervals("telegram:1", time.Second, 10*time.Second) {
+		t.Error("SetIntervals succeeded for an unbound chat")
+	}
+	store.Set("telegram:1", "dev")
+	store.SetIntervals("telegram:1", time.Second, 10*time.Second)
+	store.Set("telegram:1", "build") // re-attach keeps the chat's intervals
+
+	store2, _ := state.NewSubscriptions(f.Name())
+	b, ok := store2.Binding("telegram:1")
+	want := state.Binding{Session: "build", WatchMin: time.Second, WatchMax: 10 * time.Second}
+	if !ok || b != want {
+		t.Errorf("Binding() = %+v, %v; want %+v", b, ok, want)
+	}
+}
+
+func TestSubscriptions_LegacyFormat(t *testing.T) {
+	f, _ := os.CreateTemp("", "subs-*.json")
+	f.WriteString(`{"telegram:1": "dev", "slack:2": {"session": "ops", "watch_min": "2s", "watch_max": "30s"}}`)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	store, err := state.NewSubscriptions(f.Name())
+	if err != nil {
+		t.Fatalf("NewSubscriptions error: %v", err)
+	}
+	if got, _ := store.Get("telegram:1"); got != "dev" {
+		t.Errorf("legacy binding = %q, want dev", got)
+	}
+	if b, _ := store.Binding("slack:2"); b.WatchMin != 2*time.Second || b.WatchMax != 30*time.Second {
+		t.Errorf("binding with intervals = %+v", b)
+	}
+
+	// Bindings without intervals are still written as plain strings.
+	store.Set("telegram:1", "dev")
+	data, _ := os.ReadFile(f.Name())
+	if !strings.Contains(string(data), `"telegram:1": "dev"`) {
+		t.Errorf("plain binding not written in legacy form:\n%s", data)
+	}
+}
@@ -1,6 +1,7 @@
 package tmux
 
 import (
+	"errors"
 	"os/exec"
 	"regexp"
 	"strings"
@@ -45,9 +46,71 @@ func (b *Bridge) ListSessions() ([]string, error) {
 	return sessions, nil
 }
 
-// Capture returns the current pane content of session, with ANSI stripped and truncated.
-func (b *Bridge) Capture(session string, maxLines int) (string, error) {
-	out, err := exec.Command("tmux", "capture-pane", "-p", "-e", "-t", session).Output()
+// exact returns target with its session matched by exact name only. Without
+// "=" tmux falls back to a unique prefix or a glob of session names, so
+// "pro" would reach "prod" — a session no ACL was checked against.
+func exact(target string) string {
+	if !strings.Contains(target, ":") {
+		target += ":" // a bare "=session" is not accepted as a pane
+	}
+	return "=" + target
+}
+
+// SessionOf returns the session part of a tmux target: "build" for
+// "build", "build:2" and "build:editor.1".
+func SessionOf(target string) string {
+	session, _, _ := strings.Cut(target, ":")
+	return session
+}
+
+// Pane is one pane of a session, as listed by ListPanes.
+type Pane struct {
+	Target  string // session:window.pane
+	Window  string // window name
+	Active  bool   // the pane tmux sends to when only the session is named
+	Command string // command running in the pane
+	Path    string // its working directory
+}
+
+// ListPanes returns every pane of session, in window and pane order.
+func (b *Bridge) ListPanes(session string) ([]Pane, error) {
+	out, err := exec.Command("tmux", "list-panes", "-s", "-t", "="+session, "-F",
+		"#{session_name}:#{window_index}.#{pane_index}\t#{window_name}\t#{window_active}#{pane_active}\t#{pane_current_command}\t#{pane_current_path}").Output()
+	if err != nil {
+		return nil, err
+	}
+	var panes []Pane
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) != 5 {
+			continue
+		}
+		panes = append(panes, Pane{Target: f[0], Window: f[1], Active: f[2] == "11", Command: f[3], Path: f[4]})
+	}
+	return panes, nil
+}
+
+// ResolveTarget returns the pane target points to as session:window.pane,
+// with the window as an index, or an error if there is no such pane.
+func (b *Bridge) ResolveTarget(target string) (string, error) {
+	// display-message falls back to another pane instead of failing, so
+	// list-panes checks the target first.
+	if out, err := exec.Command("tmux", "list-panes", "-t", exact(target), "-F", "").CombinedOutput(); err != nil {
+		return "", errors.New(strings.TrimSpace(string(out)))
+	}
+	out, err := exec.Command("tmux", "display-message", "-p", "-t", exact(target), "#{session_name}:#{window_index}.#{pane_index}").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Capture returns the current content of target's pane, with ANSI stripped
+// and truncated. Like every target below, it is a session (its active pane),
+// session:window or session:window.pane, and the session is matched by exact
+// name.
+func (b *Bridge) Capture(target string, maxLines int) (string, error) {
+	out, err := exec.Command("tmux", "capture-pane", "-p", "-e", "-t", exact(target)).Output()
 	if err != nil {
 		return "", err
 	}
@@ -55,19 +118,38 @@ func (b *Bridge) Capture(session string, maxLines int) (string, error) {
 	return TruncateLines(clean, maxLines), nil
 }
 
-// SendKeys sends text input followed by Enter to the given tmux session.
+// CaptureRaw returns the last maxLines lines of target's pane with escape
+// sequences kept, for rendering with colors.
+func (b *Bridge) CaptureRaw(target string, maxLines int) (string, error) {
+	out, err := exec.Command("tmux", "capture-pane", "-p", "-e", "-t", exact(target)).Output()
+	if err != nil {
+		return "", err
+	}
+	return TruncateLines(strings.TrimRight(string(out), "\n"), maxLines), nil
+}
+
+// PaneDir returns the current working directory of target's pane.
+func (b *Bridge) PaneDir(target string) (string, error) {
+	out, err := exec.Command("tmux", "display-message", "-p", "-t", exact(target), "#{pane_current_path}").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SendKeys sends text input followed by Enter to target's pane.
 // The text is sent with -l (literal) so that any \n or \r in the message is
 // not misinterpreted by tmux as a key sequence (e.g. \n → M-Enter / Option+Enter
 // on macOS). Trailing CR/LF is stripped because Enter is sent explicitly.
-func (b *Bridge) SendKeys(session, text string) error {
+func (b *Bridge) SendKeys(target, text string) error {
 	text = strings.TrimRight(text, "\r\n")
-	if err := exec.Command("tmux", "send-keys", "-t", session, "-l", text).Run(); err != nil {
+	if err := exec.Command("tmux", "send-keys", "-t", exact(target), "-l", text).Run(); err != nil {
 		return err
 	}
-	return exec.Command("tmux", "send-keys", "-t", session, "Enter").Run()
+	return exec.Command("tmux", "send-keys", "-t", exact(target), "Enter").Run()
 }
 
-// SendRawKey sends a tmux key (e.g. "C-c", "C-z") to the session without Enter.
-func (b *Bridge) SendRawKey(session, key string) error {
-	return exec.Command("tmux", "send-keys", "-t", session, key).Run()
+// SendRawKey sends a tmux key (e.g. "C-c", "C-z") to target's pane without Enter.
+func (b *Bridge) SendRawKey(target, key string) error {
+	return exec.Command("tmux", "send-keys", "-t", exact(target), key).Run()
 }
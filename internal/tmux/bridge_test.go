@@ -33,3 +33,15 @@ func TestTruncateLines(t *testing.T) {
 		t.Errorf("TruncateLines returned %d lines, want <= 50", len(lines))
 	}
 }
+
+func TestSessionOf(t *testing.T) {
+	for target, want := range map[string]string{
+		"build":          "build",
+		"build:2":        "build",
+		"build:editor.1": "build",
+	} {
+		if got := tmux.SessionOf(target); got != want {
+			t.Errorf("SessionOf(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package tmux
+
+import "strings"
+
+// DiffLines compares cur with prev, the content pushed last time, and returns
+// the lines of cur that are new: appended below prev, or changed (such as a
+// prompt line that now holds a command).
+//
+// Scrolling is handled by aligning the top of cur with the line of prev it
+// scrolled up to: the alignment with the longest run of matching lines wins.
+// redraw is true when prev is empty or more than threshold (0–1) of cur's lines
+// are new — the screen was cleared or repainted (vim, top, less) and the
+// caller should send cur in full instead.
+func DiffLines(prev, cur string, threshold float64) (added string, redraw bool) {
+	p := trimTrailingBlank(strings.Split(prev, "\n"))
+	c := trimTrailingBlank(strings.Split(cur, "\n"))
+	if len(p) == 0 || len(c) == 0 {
+		return cur, true
+	}
+
+	matched := 0
+	for shift := 0; shift < len(p); shift++ {
+		n := 0
+		for n < len(c) && shift+n < len(p) && c[n] == p[shift+n] {
+			n++
+		}
+		if n > matched {
+			matched = n
+		}
+	}
+
+	fresh := c[matched:]
+	if len(fresh) == 0 {
+		return "", false
+	}
+	if float64(len(fresh))/float64(len(c)) > threshold {
+		return cur, true
+	}
+	return strings.Join(fresh, "\n"), false
+}
+
+func trimTrailingBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
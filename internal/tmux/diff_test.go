@@ -0,0 +1,69 @@
+package tmux_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dfbb/im2code/internal/tmux"
+)
+
+func lines(s ...string) string { return strings.Join(s, "\n") }
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		name       string
+		prev, cur  string
+		wantAdded  string
+		wantRedraw bool
+	}{
+		{
+			name:      "appended below",
+			prev:      lines("$ make", "step 1", "step 2", "", ""),
+			cur:       lines("$ make", "step 1", "step 2", "step 3", ""),
+			wantAdded: "step 3",
+		},
+		{
+			name:      "scrolled up",
+			prev:      lines("a", "b", "c", "d"),
+			cur:       lines("c", "d", "e", "f"),
+			wantAdded: lines("e", "f"),
+		},
+		{
+			name:      "prompt line changed",
+			prev:      lines("out 1", "out 2", "out 3", "$ "),
+			cur:       lines("out 1", "out 2", "out 3", "$ ls", "file"),
+			wantAdded: lines("$ ls", "file"),
+		},
+		{
+			name: "unchanged",
+			prev: lines("a", "b"),
+			cur:  lines("a", "b", ""),
+		},
+		{
+			name:       "cleared",
+			prev:       lines("a", "b", "c", "d"),
+			cur:        lines("$ "),
+			wantAdded:  lines("$ "),
+			wantRedraw: true,
+		},
+		{
+			name:       "repainted",
+			prev:       lines("top - 10:00", "cpu 3%", "mem 40%", "proc 1"),
+			cur:        lines("top - 10:01", "cpu 5%", "mem 41%", "proc 1"),
+			wantAdded:  lines("top - 10:01", "cpu 5%", "mem 41%", "proc 1"),
+			wantRedraw: true,
+		},
+		{
+			name:       "first push",
+			cur:        "hello",
+			wantAdded:  "hello",
+			wantRedraw: true,
+		},
+	}
+	for _, c := range cases {
+		added, redraw := tmux.DiffLines(c.prev, c.cur, 0.6)
+		if added != c.wantAdded || redraw != c.wantRedraw {
+			t.Errorf("%s: DiffLines() = %q, %v; want %q, %v", c.name, added, redraw, c.wantAdded, c.wantRedraw)
+		}
+	}
+}
@@ -9,12 +9,21 @@ import (
 )
 
 // PromptMatcher detects shell prompt lines using configurable patterns.
+// Patterns can be replaced at runtime with SetPatterns.
 type PromptMatcher struct {
-	patterns    []*regexp.Regexp
-	startPats   []*regexp.Regexp
+	mu        sync.RWMutex
+	patterns  []*regexp.Regexp
+	startPats []*regexp.Regexp
 }
 
 func NewPromptMatcher(patterns []string) *PromptMatcher {
+	m := &PromptMatcher{}
+	m.SetPatterns(patterns)
+	return m
+}
+
+// SetPatterns replaces the prompt patterns. Invalid regexes are skipped.
+func (m *PromptMatcher) SetPatterns(patterns []string) {
 	compiled := make([]*regexp.Regexp, 0, len(patterns))
 	startPats := make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
@@ -27,11 +36,16 @@ func NewPromptMatcher(patterns []string) *PromptMatcher {
 			startPats = append(startPats, r)
 		}
 	}
-	return &PromptMatcher{patterns: compiled, startPats: startPats}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patterns = compiled
+	m.startPats = startPats
 }
 
 // Match returns true if line matches any prompt pattern (end-of-line or start-of-line).
 func (m *PromptMatcher) Match(line string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, r := range m.patterns {
 		if r.MatchString(line) {
 			return true
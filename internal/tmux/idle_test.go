@@ -47,3 +47,17 @@ func TestANSIActivityDetector(t *testing.T) {
 		t.Error("expected IsAnimating() = false after idle period")
 	}
 }
+
+func TestPromptMatcher_SetPatterns(t *testing.T) {
+	matcher := tmux.NewPromptMatcher([]string{`\$\s*$`})
+	if matcher.Match("(venv) % ") {
+		t.Fatal("zsh-style prompt matched before SetPatterns")
+	}
+	matcher.SetPatterns([]string{`%\s*$`})
+	if !matcher.Match("(venv) % ") {
+		t.Error("new pattern not applied")
+	}
+	if matcher.Match("user@host:~$ ") {
+		t.Error("old pattern still applied")
+	}
+}
@@ -0,0 +1,88 @@
+// Package totp implements RFC 6238 time-based one-time passwords as used by
+// authenticator apps: HMAC-SHA1, 6 digits, 30-second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	digits = 6
+	step   = 30 // seconds
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random 160-bit secret, base32 encoded.
+func GenerateSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(key), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.ReplaceAll(strings.TrimRight(secret, "="), " ", "")))
+	if err != nil {
+		return nil, fmt.Errorf("totp: invalid secret: %w", err)
+	}
+	return key, nil
+}
+
+// Counter returns the time step t falls in.
+func Counter(t time.Time) int64 { return t.Unix() / step }
+
+func code(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, v%1000000)
+}
+
+// Code returns the code for secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Counter(t)), nil
+}
+
+// Validate checks code against secret at time t, allowing one step of clock
+// drift either way. It returns the matching time step, which callers use to
+// refuse a code that was already accepted.
+func Validate(secret, c string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(c) != digits {
+		return 0, false
+	}
+	now := Counter(t)
+	for _, counter := range []int64{now, now - 1, now + 1} {
+		if hmac.Equal([]byte(code(key, counter)), []byte(c)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// URI authenticator apps import, usually as a QR
+// code.
+func URI(secret, issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
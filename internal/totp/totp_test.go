@@ -0,0 +1,63 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dfbb/im2code/internal/totp"
+)
+
+// RFC 6238 appendix B test secret, truncated to 6 digits.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := totp.Code(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	c, _ := totp.Code(rfcSecret, now)
+	if counter, ok := totp.Validate(rfcSecret, c, now.Add(30*time.Second)); !ok || counter != totp.Counter(now) {
+		t.Errorf("expected one step of drift to be accepted, got %d %v", counter, ok)
+	}
+	if _, ok := totp.Validate(rfcSecret, c, now.Add(90*time.Second)); ok {
+		t.Error("expected a code three steps old to be rejected")
+	}
+	if _, ok := totp.Validate(rfcSecret, "12345", now); ok {
+		t.Error("expected a short code to be rejected")
+	}
+	if _, ok := totp.Validate("not base32!", c, now); ok {
+		t.Error("expected an invalid secret to be rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	s, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 32 {
+		t.Errorf("expected 32 base32 characters, got %q", s)
+	}
+	if _, err := totp.Code(s, time.Now()); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+	if uri := totp.URI(s, "im2code", "me@host"); !strings.HasPrefix(uri, "otpauth://totp/im2code:me@host?") {
+		t.Errorf("unexpected URI %q", uri)
+	}
+}